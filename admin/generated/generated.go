@@ -43,11 +43,11 @@ type DirectiveRoot struct {
 
 type ComplexityRoot struct {
 	Mutation struct {
-		PurgeAll            func(childComplexity int) int
-		PurgeOperation      func(childComplexity int, name string) int
-		PurgeQueryRootField func(childComplexity int, field string) int
-		PurgeType           func(childComplexity int, typeArg string) int
-		PurgeTypeKey        func(childComplexity int, typeArg string, field string, key string) int
+		PurgeAll            func(childComplexity int, soft bool) int
+		PurgeOperation      func(childComplexity int, name string, soft bool) int
+		PurgeQueryRootField func(childComplexity int, field string, soft bool) int
+		PurgeType           func(childComplexity int, typeArg string, soft bool) int
+		PurgeTypeKey        func(childComplexity int, typeArg string, field string, key string, soft bool) int
 	}
 
 	Query struct {
@@ -56,11 +56,11 @@ type ComplexityRoot struct {
 }
 
 type MutationResolver interface {
-	PurgeAll(ctx context.Context) (bool, error)
-	PurgeOperation(ctx context.Context, name string) (bool, error)
-	PurgeTypeKey(ctx context.Context, typeArg string, field string, key string) (bool, error)
-	PurgeQueryRootField(ctx context.Context, field string) (bool, error)
-	PurgeType(ctx context.Context, typeArg string) (bool, error)
+	PurgeAll(ctx context.Context, soft bool) (bool, error)
+	PurgeOperation(ctx context.Context, name string, soft bool) (bool, error)
+	PurgeTypeKey(ctx context.Context, typeArg string, field string, key string, soft bool) (bool, error)
+	PurgeQueryRootField(ctx context.Context, field string, soft bool) (bool, error)
+	PurgeType(ctx context.Context, typeArg string, soft bool) (bool, error)
 }
 type QueryResolver interface {
 	Dummy(ctx context.Context) (string, error)
@@ -86,7 +86,12 @@ func (e *executableSchema) Complexity(typeName, field string, childComplexity in
 			break
 		}
 
-		return e.complexity.Mutation.PurgeAll(childComplexity), true
+		args, err := ec.field_Mutation_purgeAll_args(context.TODO(), rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.PurgeAll(childComplexity, args["soft"].(bool)), true
 
 	case "Mutation.purgeOperation":
 		if e.complexity.Mutation.PurgeOperation == nil {
@@ -98,7 +103,7 @@ func (e *executableSchema) Complexity(typeName, field string, childComplexity in
 			return 0, false
 		}
 
-		return e.complexity.Mutation.PurgeOperation(childComplexity, args["name"].(string)), true
+		return e.complexity.Mutation.PurgeOperation(childComplexity, args["name"].(string), args["soft"].(bool)), true
 
 	case "Mutation.purgeQueryRootField":
 		if e.complexity.Mutation.PurgeQueryRootField == nil {
@@ -110,7 +115,7 @@ func (e *executableSchema) Complexity(typeName, field string, childComplexity in
 			return 0, false
 		}
 
-		return e.complexity.Mutation.PurgeQueryRootField(childComplexity, args["field"].(string)), true
+		return e.complexity.Mutation.PurgeQueryRootField(childComplexity, args["field"].(string), args["soft"].(bool)), true
 
 	case "Mutation.purgeType":
 		if e.complexity.Mutation.PurgeType == nil {
@@ -122,7 +127,7 @@ func (e *executableSchema) Complexity(typeName, field string, childComplexity in
 			return 0, false
 		}
 
-		return e.complexity.Mutation.PurgeType(childComplexity, args["type"].(string)), true
+		return e.complexity.Mutation.PurgeType(childComplexity, args["type"].(string), args["soft"].(bool)), true
 
 	case "Mutation.purgeTypeKey":
 		if e.complexity.Mutation.PurgeTypeKey == nil {
@@ -134,7 +139,7 @@ func (e *executableSchema) Complexity(typeName, field string, childComplexity in
 			return 0, false
 		}
 
-		return e.complexity.Mutation.PurgeTypeKey(childComplexity, args["type"].(string), args["field"].(string), args["key"].(string)), true
+		return e.complexity.Mutation.PurgeTypeKey(childComplexity, args["type"].(string), args["field"].(string), args["key"].(string), args["soft"].(bool)), true
 
 	case "Query.dummy":
 		if e.complexity.Query.Dummy == nil {
@@ -211,12 +216,16 @@ var sources = []*ast.Source{
     dummy: String!
 }
 
+"""
+Purge mutations delete query results by default, when soft is true query results will be marked as stale
+instead and still be served while fresh data is being fetched in the background.
+"""
 type Mutation {
-    purgeAll: Boolean!
-    purgeOperation(name: String!): Boolean!
-    purgeTypeKey(type: String!, field: String!, key: ID!): Boolean!
-    purgeQueryRootField(field: String!): Boolean!
-    purgeType(type: String!): Boolean!
+    purgeAll(soft: Boolean! = false): Boolean!
+    purgeOperation(name: String!, soft: Boolean! = false): Boolean!
+    purgeTypeKey(type: String!, field: String!, key: ID!, soft: Boolean! = false): Boolean!
+    purgeQueryRootField(field: String!, soft: Boolean! = false): Boolean!
+    purgeType(type: String!, soft: Boolean! = false): Boolean!
 }`, BuiltIn: false},
 }
 var parsedSchema = gqlparser.MustLoadSchema(sources...)
@@ -225,6 +234,21 @@ var parsedSchema = gqlparser.MustLoadSchema(sources...)
 
 // region    ***************************** args.gotpl *****************************
 
+func (ec *executionContext) field_Mutation_purgeAll_args(ctx context.Context, rawArgs map[string]interface{}) (map[string]interface{}, error) {
+	var err error
+	args := map[string]interface{}{}
+	var arg0 bool
+	if tmp, ok := rawArgs["soft"]; ok {
+		ctx := graphql.WithPathContext(ctx, graphql.NewPathWithField("soft"))
+		arg0, err = ec.unmarshalNBoolean2bool(ctx, tmp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	args["soft"] = arg0
+	return args, nil
+}
+
 func (ec *executionContext) field_Mutation_purgeOperation_args(ctx context.Context, rawArgs map[string]interface{}) (map[string]interface{}, error) {
 	var err error
 	args := map[string]interface{}{}
@@ -237,6 +261,15 @@ func (ec *executionContext) field_Mutation_purgeOperation_args(ctx context.Conte
 		}
 	}
 	args["name"] = arg0
+	var arg1 bool
+	if tmp, ok := rawArgs["soft"]; ok {
+		ctx := graphql.WithPathContext(ctx, graphql.NewPathWithField("soft"))
+		arg1, err = ec.unmarshalNBoolean2bool(ctx, tmp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	args["soft"] = arg1
 	return args, nil
 }
 
@@ -252,6 +285,15 @@ func (ec *executionContext) field_Mutation_purgeQueryRootField_args(ctx context.
 		}
 	}
 	args["field"] = arg0
+	var arg1 bool
+	if tmp, ok := rawArgs["soft"]; ok {
+		ctx := graphql.WithPathContext(ctx, graphql.NewPathWithField("soft"))
+		arg1, err = ec.unmarshalNBoolean2bool(ctx, tmp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	args["soft"] = arg1
 	return args, nil
 }
 
@@ -285,6 +327,15 @@ func (ec *executionContext) field_Mutation_purgeTypeKey_args(ctx context.Context
 		}
 	}
 	args["key"] = arg2
+	var arg3 bool
+	if tmp, ok := rawArgs["soft"]; ok {
+		ctx := graphql.WithPathContext(ctx, graphql.NewPathWithField("soft"))
+		arg3, err = ec.unmarshalNBoolean2bool(ctx, tmp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	args["soft"] = arg3
 	return args, nil
 }
 
@@ -300,6 +351,15 @@ func (ec *executionContext) field_Mutation_purgeType_args(ctx context.Context, r
 		}
 	}
 	args["type"] = arg0
+	var arg1 bool
+	if tmp, ok := rawArgs["soft"]; ok {
+		ctx := graphql.WithPathContext(ctx, graphql.NewPathWithField("soft"))
+		arg1, err = ec.unmarshalNBoolean2bool(ctx, tmp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	args["soft"] = arg1
 	return args, nil
 }
 
@@ -372,9 +432,16 @@ func (ec *executionContext) _Mutation_purgeAll(ctx context.Context, field graphq
 	}
 
 	ctx = graphql.WithFieldContext(ctx, fc)
+	rawArgs := field.ArgumentMap(ec.Variables)
+	args, err := ec.field_Mutation_purgeAll_args(ctx, rawArgs)
+	if err != nil {
+		ec.Error(ctx, err)
+		return graphql.Null
+	}
+	fc.Args = args
 	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (interface{}, error) {
 		ctx = rctx // use context from middleware stack in children
-		return ec.resolvers.Mutation().PurgeAll(rctx)
+		return ec.resolvers.Mutation().PurgeAll(rctx, args["soft"].(bool))
 	})
 	if err != nil {
 		ec.Error(ctx, err)
@@ -416,7 +483,7 @@ func (ec *executionContext) _Mutation_purgeOperation(ctx context.Context, field
 	fc.Args = args
 	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (interface{}, error) {
 		ctx = rctx // use context from middleware stack in children
-		return ec.resolvers.Mutation().PurgeOperation(rctx, args["name"].(string))
+		return ec.resolvers.Mutation().PurgeOperation(rctx, args["name"].(string), args["soft"].(bool))
 	})
 	if err != nil {
 		ec.Error(ctx, err)
@@ -458,7 +525,7 @@ func (ec *executionContext) _Mutation_purgeTypeKey(ctx context.Context, field gr
 	fc.Args = args
 	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (interface{}, error) {
 		ctx = rctx // use context from middleware stack in children
-		return ec.resolvers.Mutation().PurgeTypeKey(rctx, args["type"].(string), args["field"].(string), args["key"].(string))
+		return ec.resolvers.Mutation().PurgeTypeKey(rctx, args["type"].(string), args["field"].(string), args["key"].(string), args["soft"].(bool))
 	})
 	if err != nil {
 		ec.Error(ctx, err)
@@ -500,7 +567,7 @@ func (ec *executionContext) _Mutation_purgeQueryRootField(ctx context.Context, f
 	fc.Args = args
 	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (interface{}, error) {
 		ctx = rctx // use context from middleware stack in children
-		return ec.resolvers.Mutation().PurgeQueryRootField(rctx, args["field"].(string))
+		return ec.resolvers.Mutation().PurgeQueryRootField(rctx, args["field"].(string), args["soft"].(bool))
 	})
 	if err != nil {
 		ec.Error(ctx, err)
@@ -542,7 +609,7 @@ func (ec *executionContext) _Mutation_purgeType(ctx context.Context, field graph
 	fc.Args = args
 	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (interface{}, error) {
 		ctx = rctx // use context from middleware stack in children
-		return ec.resolvers.Mutation().PurgeType(rctx, args["type"].(string))
+		return ec.resolvers.Mutation().PurgeType(rctx, args["type"].(string), args["soft"].(bool))
 	})
 	if err != nil {
 		ec.Error(ctx, err)
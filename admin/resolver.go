@@ -10,12 +10,13 @@ import (
 	"go.uber.org/zap"
 )
 
+// QueryResultCachePurger purges query results, they will be marked as stale instead of deleted when soft is true.
 type QueryResultCachePurger interface {
-	PurgeQueryResultBySchema(context.Context, *graphql.Schema) error
-	PurgeQueryResultByOperationName(context.Context, string) error
-	PurgeQueryResultByTypeName(context.Context, string) error
-	PurgeQueryResultByTypeField(ctx context.Context, typeName, fieldName string) error
-	PurgeQueryResultByTypeKey(ctx context.Context, typeName, fieldName string, value interface{}) error
+	PurgeQueryResultBySchema(ctx context.Context, schema *graphql.Schema, soft bool) error
+	PurgeQueryResultByOperationName(ctx context.Context, name string, soft bool) error
+	PurgeQueryResultByTypeName(ctx context.Context, name string, soft bool) error
+	PurgeQueryResultByTypeField(ctx context.Context, typeName, fieldName string, soft bool) error
+	PurgeQueryResultByTypeKey(ctx context.Context, typeName, fieldName string, value interface{}, soft bool) error
 }
 
 type Resolver struct {
@@ -10,8 +10,8 @@ import (
 	"go.uber.org/zap"
 )
 
-func (r *mutationResolver) PurgeAll(ctx context.Context) (bool, error) {
-	if err := r.purger.PurgeQueryResultBySchema(ctx, r.upstreamSchema); err != nil {
+func (r *mutationResolver) PurgeAll(ctx context.Context, soft bool) (bool, error) {
+	if err := r.purger.PurgeQueryResultBySchema(ctx, r.upstreamSchema, soft); err != nil {
 		r.logger.Warn("fail to purge query result by operation name", zap.Error(err))
 
 		return false, nil
@@ -20,8 +20,8 @@ func (r *mutationResolver) PurgeAll(ctx context.Context) (bool, error) {
 	return true, nil
 }
 
-func (r *mutationResolver) PurgeOperation(ctx context.Context, name string) (bool, error) {
-	if err := r.purger.PurgeQueryResultByOperationName(ctx, name); err != nil {
+func (r *mutationResolver) PurgeOperation(ctx context.Context, name string, soft bool) (bool, error) {
+	if err := r.purger.PurgeQueryResultByOperationName(ctx, name, soft); err != nil {
 		r.logger.Warn("fail to purge query result by operation name", zap.Error(err))
 
 		return false, nil
@@ -30,8 +30,8 @@ func (r *mutationResolver) PurgeOperation(ctx context.Context, name string) (boo
 	return true, nil
 }
 
-func (r *mutationResolver) PurgeTypeKey(ctx context.Context, typeArg string, field string, key string) (bool, error) {
-	if err := r.purger.PurgeQueryResultByTypeKey(ctx, typeArg, field, key); err != nil {
+func (r *mutationResolver) PurgeTypeKey(ctx context.Context, typeArg string, field string, key string, soft bool) (bool, error) {
+	if err := r.purger.PurgeQueryResultByTypeKey(ctx, typeArg, field, key, soft); err != nil {
 		r.logger.Warn("fail to purge query result by type key", zap.Error(err))
 
 		return false, nil
@@ -40,8 +40,8 @@ func (r *mutationResolver) PurgeTypeKey(ctx context.Context, typeArg string, fie
 	return true, nil
 }
 
-func (r *mutationResolver) PurgeQueryRootField(ctx context.Context, field string) (bool, error) {
-	if err := r.purger.PurgeQueryResultByTypeField(ctx, r.upstreamSchema.QueryTypeName(), field); err != nil {
+func (r *mutationResolver) PurgeQueryRootField(ctx context.Context, field string, soft bool) (bool, error) {
+	if err := r.purger.PurgeQueryResultByTypeField(ctx, r.upstreamSchema.QueryTypeName(), field, soft); err != nil {
 		r.logger.Warn("fail to purge query result by root field", zap.Error(err))
 
 		return false, nil
@@ -50,8 +50,8 @@ func (r *mutationResolver) PurgeQueryRootField(ctx context.Context, field string
 	return true, nil
 }
 
-func (r *mutationResolver) PurgeType(ctx context.Context, typeArg string) (bool, error) {
-	if err := r.purger.PurgeQueryResultByTypeName(ctx, typeArg); err != nil {
+func (r *mutationResolver) PurgeType(ctx context.Context, typeArg string, soft bool) (bool, error) {
+	if err := r.purger.PurgeQueryResultByTypeName(ctx, typeArg, soft); err != nil {
 		r.logger.Warn("fail to purge query result by type", zap.Error(err))
 
 		return false, err
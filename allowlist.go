@@ -0,0 +1,229 @@
+package gbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jensneuse/graphql-go-tools/pkg/astparser"
+	"github.com/jensneuse/graphql-go-tools/pkg/astprinter"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+)
+
+const (
+	AllowlistModeEnforce = "enforce"
+	AllowlistModeLogOnly = "log-only"
+
+	apolloPersistedQueryManifestFormat = "apollo-persisted-query-manifest"
+)
+
+// Allowlist only allow operations in pre-registered documents (trusted documents) to be executed.
+type Allowlist struct {
+	// Directory contains documents, `.graphql` and `.gql` files will be loaded as documents,
+	// `.json` files will be loaded as manifests.
+	Dir string `json:"dir,omitempty"`
+
+	// Manifest files support Apollo persisted query manifest format:
+	// {"format":"apollo-persisted-query-manifest","version":1,"operations":[{"id":"...","body":"..."}]}
+	// and Relay persisted queries format:
+	// {"<document id>":"<document>"}
+	Manifests []string `json:"manifests,omitempty"`
+
+	// Mode `enforce` will reject operations not in allowlist, `log-only` will log and collect metrics only,
+	// `enforce` by default.
+	Mode string `json:"mode,omitempty"`
+
+	documents map[string]string
+	hashes    map[string]struct{}
+}
+
+type apolloPersistedQueryManifest struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Operations []struct {
+		ID   string `json:"id"`
+		Body string `json:"body"`
+	} `json:"operations"`
+}
+
+func (a *Allowlist) provision() error {
+	a.documents = make(map[string]string)
+	a.hashes = make(map[string]struct{})
+
+	if a.Mode == "" {
+		a.Mode = AllowlistModeEnforce
+	}
+
+	if a.Dir != "" {
+		if err := a.loadDir(a.Dir); err != nil {
+			return err
+		}
+	}
+
+	for _, manifest := range a.Manifests {
+		if err := a.loadManifest(manifest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *Allowlist) validate() error {
+	if a.Mode != AllowlistModeEnforce && a.Mode != AllowlistModeLogOnly {
+		return fmt.Errorf("allowlist mode must be %s or %s, got %s", AllowlistModeEnforce, AllowlistModeLogOnly, a.Mode)
+	}
+
+	if a.Dir == "" && len(a.Manifests) == 0 {
+		return errors.New("allowlist dir or manifests must be set")
+	}
+
+	return nil
+}
+
+func (a *Allowlist) loadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".graphql", ".gql":
+			var document []byte
+			document, err = ioutil.ReadFile(path)
+
+			if err != nil {
+				return err
+			}
+
+			if err = a.addDocument(entry.Name(), string(document)); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		case ".json":
+			if err = a.loadManifest(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a *Allowlist) loadManifest(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	apolloManifest := new(apolloPersistedQueryManifest)
+
+	if err = json.Unmarshal(data, apolloManifest); err == nil && apolloManifest.Format == apolloPersistedQueryManifestFormat {
+		for _, operation := range apolloManifest.Operations {
+			if err = a.addDocument(operation.ID, operation.Body); err != nil {
+				return fmt.Errorf("%s: operation %s: %w", path, operation.ID, err)
+			}
+		}
+
+		return nil
+	}
+
+	relayManifest := make(map[string]string)
+
+	if err = json.Unmarshal(data, &relayManifest); err != nil {
+		return fmt.Errorf("%s: unsupported manifest format: %w", path, err)
+	}
+
+	for id, document := range relayManifest {
+		if err = a.addDocument(id, document); err != nil {
+			return fmt.Errorf("%s: document %s: %w", path, id, err)
+		}
+	}
+
+	return nil
+}
+
+func (a *Allowlist) addDocument(id, document string) error {
+	hash, err := allowlistDocumentHash(document)
+	if err != nil {
+		return err
+	}
+
+	a.hashes[hash] = struct{}{}
+	a.documents[id] = document
+
+	return nil
+}
+
+// resolveQuery lookup query of request by document id given in request body,
+// returns true if query had been loaded from allowlist documents.
+func (a *Allowlist) resolveQuery(r *graphql.Request, body map[string]json.RawMessage) bool {
+	var ids []string
+
+	for _, key := range []string{"documentId", "doc_id", "id"} {
+		var id string
+
+		if err := json.Unmarshal(body[key], &id); err == nil && id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	if ext, ok := body["extensions"]; ok {
+		apqExt := new(apqExtensions)
+
+		if err := json.Unmarshal(ext, apqExt); err == nil && apqExt.PersistedQuery != nil {
+			ids = append(ids, apqExt.PersistedQuery.Sha256Hash)
+		}
+	}
+
+	for _, id := range ids {
+		if document, ok := a.documents[id]; ok {
+			r.Query = document
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *Allowlist) allowed(r *graphql.Request) bool {
+	hash, err := allowlistDocumentHash(r.Query)
+	if err != nil {
+		return false
+	}
+
+	_, ok := a.hashes[hash]
+
+	return ok
+}
+
+// allowlistDocumentHash compute sha256 hash of document printed, so whitespaces and comments not affect to the hash.
+func allowlistDocumentHash(document string) (string, error) {
+	doc, report := astparser.ParseGraphqlDocumentString(document)
+
+	if report.HasErrors() {
+		return "", &report
+	}
+
+	printed, err := astprinter.PrintString(&doc, nil)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(printed))
+
+	return hex.EncodeToString(sum[:]), nil
+}
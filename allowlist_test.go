@@ -0,0 +1,116 @@
+package gbox
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAllowlist(t *testing.T) *Allowlist {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"users.graphql": `
+# get users
+query GetUsers {
+	users { name }
+}
+`,
+		"apollo.json": `{
+	"format": "apollo-persisted-query-manifest",
+	"version": 1,
+	"operations": [{"id": "books", "name": "GetBooks", "type": "query", "body": "query GetBooks { books { title } }"}]
+}`,
+		"relay.json":  `{"user_ids": "query GetUserIds { users { id } }"}`,
+		"ignored.txt": `query Ignored { users { id name } }`,
+	}
+
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	a := &Allowlist{Dir: dir}
+
+	require.NoError(t, a.provision())
+	require.NoError(t, a.validate())
+
+	return a
+}
+
+func TestAllowlist_Allowed(t *testing.T) {
+	a := newTestAllowlist(t)
+	testCases := map[string]struct {
+		query   string
+		allowed bool
+	}{
+		"document_file_with_different_whitespaces": {
+			query:   `query GetUsers { users { name } }`,
+			allowed: true,
+		},
+		"apollo_manifest": {
+			query:   "query GetBooks {\n  books {\n    title\n  }\n}",
+			allowed: true,
+		},
+		"relay_manifest": {
+			query:   `query GetUserIds { users { id } }`,
+			allowed: true,
+		},
+		"ignored_file": {
+			query: `query Ignored { users { id name } }`,
+		},
+		"different_selection_set": {
+			query: `query GetUsers { users { name id } }`,
+		},
+		"invalid_query": {
+			query: `query {`,
+		},
+	}
+
+	for name, testCase := range testCases {
+		require.Equalf(t, testCase.allowed, a.allowed(&graphql.Request{Query: testCase.query}), "case %s: unexpected result", name)
+	}
+}
+
+func TestAllowlist_ResolveQuery(t *testing.T) {
+	a := newTestAllowlist(t)
+	testCases := map[string]struct {
+		body          string
+		expectedQuery string
+	}{
+		"document_id": {
+			body:          `{"documentId": "books"}`,
+			expectedQuery: `query GetBooks { books { title } }`,
+		},
+		"relay_doc_id": {
+			body:          `{"doc_id": "user_ids"}`,
+			expectedQuery: `query GetUserIds { users { id } }`,
+		},
+		"persisted_query_hash": {
+			body:          `{"extensions": {"persistedQuery": {"version": 1, "sha256Hash": "books"}}}`,
+			expectedQuery: `query GetBooks { books { title } }`,
+		},
+		"unknown_id": {
+			body: `{"id": "unknown"}`,
+		},
+	}
+
+	for name, testCase := range testCases {
+		body := make(map[string]json.RawMessage)
+		r := new(graphql.Request)
+
+		require.NoError(t, json.Unmarshal([]byte(testCase.body), &body))
+		require.Equalf(t, testCase.expectedQuery != "", a.resolveQuery(r, body), "case %s: unexpected result", name)
+		require.Equalf(t, testCase.expectedQuery, r.Query, "case %s: unexpected query", name)
+	}
+}
+
+func TestAllowlist_Validate(t *testing.T) {
+	require.Error(t, (&Allowlist{Mode: "unknown", Dir: "/tmp"}).validate())
+	require.Error(t, (&Allowlist{Mode: AllowlistModeEnforce}).validate())
+	require.NoError(t, (&Allowlist{Mode: AllowlistModeLogOnly, Manifests: []string{"a.json"}}).validate())
+}
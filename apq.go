@@ -0,0 +1,115 @@
+package gbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/eko/gocache/v2/store"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+)
+
+const (
+	apqQueryCacheKeyPattern = "gbox_apq_%s"
+	apqSupportedVersion     = 1
+)
+
+var (
+	// ErrPersistedQueryNotFound message and code are defined by Apollo APQ protocol, clients will resend request
+	// with full query text when got it.
+	ErrPersistedQueryNotFound           = &codedError{message: "PersistedQueryNotFound", code: "PERSISTED_QUERY_NOT_FOUND"}
+	ErrPersistedQueryHashMismatch       = errors.New("provided sha does not match query")
+	ErrPersistedQueryUnsupportedVersion = errors.New("unsupported persisted query version")
+)
+
+// APQ implements Apollo automatic persisted queries protocol,
+// see https://www.apollographql.com/docs/apollo-server/performance/apq
+type APQ struct {
+	// Storage DSN using to store persisted queries, see caching store dsn for supported formats.
+	// If not set, caching store dsn will be used when caching enabled
+	// otherwise it will be freecache://?cache_size=104857600 (cache size 100MB).
+	StoreDsn string `json:"store_dsn,omitempty"`
+
+	// How long persisted queries should be store, if not set queries will be store until evicted by the store.
+	MaxAge caddy.Duration `json:"max_age,omitempty"`
+
+	store *CachingStore
+}
+
+type apqExtensions struct {
+	PersistedQuery *struct {
+		Version    int    `json:"version"`
+		Sha256Hash string `json:"sha256Hash"`
+	} `json:"persistedQuery,omitempty"`
+}
+
+func (a *APQ) provision(c *Caching) (err error) {
+	repl := caddy.NewReplacer()
+	a.StoreDsn = repl.ReplaceKnown(a.StoreDsn, "")
+
+	if a.StoreDsn == "" && c != nil {
+		a.StoreDsn = c.StoreDsn
+	}
+
+	if a.StoreDsn == "" {
+		a.StoreDsn = defaultCachingStoreDsn
+	}
+
+	a.store, err = loadCachingStore(a.StoreDsn)
+
+	return err
+}
+
+func (a *APQ) cleanup() error {
+	_, err := cachingStores.Delete(a.StoreDsn)
+
+	return err
+}
+
+// resolveQuery lookup query by hash of persisted query extension when query of request is empty,
+// otherwise register query of request with the hash given. Returns true if query had been loaded from store.
+func (a *APQ) resolveQuery(ctx context.Context, r *graphql.Request, extensions json.RawMessage) (loaded bool, err error) {
+	if len(extensions) == 0 {
+		return false, nil
+	}
+
+	ext := new(apqExtensions)
+
+	if err = json.Unmarshal(extensions, ext); err != nil || ext.PersistedQuery == nil {
+		return false, nil // nolint:nilerr
+	}
+
+	if ext.PersistedQuery.Version != apqSupportedVersion {
+		return false, ErrPersistedQueryUnsupportedVersion
+	}
+
+	hash := ext.PersistedQuery.Sha256Hash
+	cacheKey := fmt.Sprintf(apqQueryCacheKeyPattern, hash)
+
+	if r.Query == "" {
+		var query string
+
+		if _, err = a.store.Get(ctx, cacheKey, &query); err != nil || query == "" {
+			return false, ErrPersistedQueryNotFound
+		}
+
+		r.Query = query
+
+		return true, nil
+	}
+
+	sum := sha256.Sum256([]byte(r.Query))
+
+	if hex.EncodeToString(sum[:]) != hash {
+		return false, ErrPersistedQueryHashMismatch
+	}
+
+	return false, a.store.Set(ctx, cacheKey, r.Query, &store.Options{
+		Expiration: time.Duration(a.MaxAge),
+	})
+}
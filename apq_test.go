@@ -0,0 +1,90 @@
+package gbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAPQ(t *testing.T) *APQ {
+	t.Helper()
+
+	a := &APQ{
+		StoreDsn: "freecache://?cache_size=1000000",
+	}
+
+	require.NoError(t, a.provision(nil))
+	t.Cleanup(func() {
+		a.cleanup()
+	})
+
+	return a
+}
+
+func TestAPQ_ResolveQuery(t *testing.T) {
+	const query = `query { users { name } }`
+	sum := sha256.Sum256([]byte(query))
+	hash := hex.EncodeToString(sum[:])
+	extensions := []byte(`{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}`)
+	a := newTestAPQ(t)
+	ctx := context.Background()
+
+	r := &graphql.Request{}
+	loaded, err := a.resolveQuery(ctx, r, extensions)
+	require.Equal(t, ErrPersistedQueryNotFound, err)
+	require.False(t, loaded)
+
+	r = &graphql.Request{Query: `query { books { title } }`}
+	_, err = a.resolveQuery(ctx, r, extensions)
+	require.Equal(t, ErrPersistedQueryHashMismatch, err)
+
+	r = &graphql.Request{}
+	_, err = a.resolveQuery(ctx, r, []byte(`{"persistedQuery":{"version":2,"sha256Hash":"`+hash+`"}}`))
+	require.Equal(t, ErrPersistedQueryUnsupportedVersion, err)
+
+	r = &graphql.Request{Query: query}
+	loaded, err = a.resolveQuery(ctx, r, extensions)
+	require.NoError(t, err)
+	require.False(t, loaded)
+
+	r = &graphql.Request{}
+	loaded, err = a.resolveQuery(ctx, r, extensions)
+	require.NoError(t, err)
+	require.True(t, loaded)
+	require.Equal(t, query, r.Query)
+
+	r = &graphql.Request{}
+	loaded, err = a.resolveQuery(ctx, r, []byte(`{"other":true}`))
+	require.NoError(t, err)
+	require.False(t, loaded)
+	require.Empty(t, r.Query)
+}
+
+func TestHandler_ResolvePersistedQuery(t *testing.T) {
+	const query = `query { users { name } }`
+	sum := sha256.Sum256([]byte(query))
+	hash := hex.EncodeToString(sum[:])
+	h := &Handler{APQ: newTestAPQ(t)}
+	gqlRequest := &graphql.Request{Query: query}
+	extensions := []byte(`{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}`)
+	_, err := h.APQ.resolveQuery(context.Background(), gqlRequest, extensions)
+	require.NoError(t, err)
+
+	rawBody := `{"extensions":` + string(extensions) + `}`
+	r, _ := http.NewRequest("POST", "http://localhost:9090/graphql", strings.NewReader(rawBody))
+	gqlRequest = &graphql.Request{}
+
+	require.NoError(t, h.resolvePersistedQuery(r, []byte(rawBody), gqlRequest))
+	require.Equal(t, query, gqlRequest.Query)
+
+	body, _ := ioutil.ReadAll(r.Body)
+	require.JSONEq(t, `{"query":"query { users { name } }","extensions":`+string(extensions)+`}`, string(body))
+	require.Equal(t, int64(len(body)), r.ContentLength)
+}
@@ -0,0 +1,313 @@
+package gbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+var ErrEmptyBatchRequest = errors.New("batch request must contain at least one operation")
+
+// Batching settings for requests contain array of operations.
+type Batching struct {
+	// Max number of operations per batch request, unlimited if not set.
+	MaxSize int `json:"max_size,omitempty"`
+
+	// Whether to forward operations missing cache to upstream as a single batch request,
+	// upstream must support batching. Operations will be forwarded separately and concurrently by default.
+	UpstreamBatch bool `json:"upstream_batch,omitempty"`
+}
+
+// isBatchHTTPRequest peeks the first non-whitespace byte of body without consuming it, so body will be read once
+// by handler of request.
+func isBatchHTTPRequest(r *http.Request) bool {
+	if r.Body == nil {
+		return false
+	}
+
+	br := bufio.NewReader(r.Body)
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{br, r.Body}
+
+	for n := 1; ; n++ {
+		peeked, err := br.Peek(n)
+		if err != nil {
+			return false
+		}
+
+		switch peeked[n-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[':
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// handleBatchRequest handle each operation of batch request independently and write array of results in order.
+func (h *Handler) handleBatchRequest(w http.ResponseWriter, r *http.Request, upstream caddyhttp.HandlerFunc) error {
+	var operations []json.RawMessage
+	rawBody, _ := ioutil.ReadAll(r.Body)
+
+	if err := json.Unmarshal(rawBody, &operations); err != nil {
+		return writeResponseErrors(err, w)
+	}
+
+	if len(operations) == 0 {
+		return writeResponseErrors(ErrEmptyBatchRequest, w)
+	}
+
+	if h.Batching.MaxSize > 0 && len(operations) > h.Batching.MaxSize {
+		return writeResponseErrors(fmt.Errorf("batch max size is %d, current %d", h.Batching.MaxSize, len(operations)), w)
+	}
+
+	var wg sync.WaitGroup
+	var batch *batchUpstream
+	writers := make([]*cachingResponseWriter, len(operations))
+
+	if h.Batching.UpstreamBatch {
+		batch = newBatchUpstream(r, upstream, len(operations))
+	}
+
+	for i, operation := range operations {
+		writers[i] = newCachingResponseWriter(new(bytes.Buffer))
+		operationRequest := prepareHTTPRequest(r.Context(), r, writers[i])
+		operationRequest.Body = ioutil.NopCloser(bytes.NewBuffer(operation))
+		operationRequest.ContentLength = int64(len(operation))
+		operationRequest.Header.Set("content-length", strconv.Itoa(len(operation)))
+		// results of operations will be merged in single array, they must not be served compressed.
+		operationRequest.Header.Del("accept-encoding")
+		operationUpstream := upstream
+
+		if batch != nil {
+			operationUpstream = batch.handlerFor(i)
+			index := i
+			release := func() { batch.release(index) }
+			operationRequest = operationRequest.WithContext(context.WithValue(operationRequest.Context(), upstreamWaitCtxKey, release))
+		}
+
+		wg.Add(1)
+
+		go func(i int, rw *cachingResponseWriter, or *http.Request, ou caddyhttp.HandlerFunc) {
+			defer wg.Done()
+
+			if batch != nil {
+				defer batch.release(i)
+			}
+
+			if err := h.handleRequest(rw, or, ou); err != nil {
+				h.logger.Debug("fail to handle operation of batch request", zap.Int("index", i), zap.Error(err))
+				rw.buffer.Reset()
+				writeResponseErrors(err, rw)
+			}
+		}(i, writers[i], operationRequest, operationUpstream)
+	}
+
+	wg.Wait()
+
+	return writeBatchResponse(w, writers)
+}
+
+func writeBatchResponse(w http.ResponseWriter, writers []*cachingResponseWriter) error {
+	status := writers[0].Status()
+	body := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(body)
+	body.Reset()
+	body.WriteByte('[')
+
+	for i, rw := range writers {
+		if i > 0 {
+			body.WriteByte(',')
+		}
+
+		if rw.Status() != status {
+			status = http.StatusOK
+		}
+
+		mergeResponseHeader(w.Header(), rw.Header())
+		body.Write(bytes.TrimSpace(rw.buffer.Bytes()))
+	}
+
+	body.WriteByte(']')
+
+	// per operation headers are meaningless for batch response.
+	w.Header().Del("age")
+	w.Header().Del("cache-control")
+	w.Header().Del("content-length")
+	w.Header().Set("content-type", "application/json")
+
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	w.WriteHeader(status)
+	_, err := w.Write(body.Bytes())
+
+	return err
+}
+
+// mergeResponseHeader adds headers of sub response to merged response, `x-cache` values added in order,
+// other values added once.
+func mergeResponseHeader(dst, src http.Header) {
+	for name, values := range src {
+		if name == "X-Cache" {
+			dst[name] = append(dst[name], values...)
+
+			continue
+		}
+
+	valuesLoop:
+		for _, value := range values {
+			for _, existing := range dst[name] {
+				if existing == value {
+					continue valuesLoop
+				}
+			}
+
+			dst.Add(name, value)
+		}
+	}
+}
+
+// batchUpstream collect operations of batch request need to forward to upstream and forward them as single batch request
+// when all operations had been resolved (forwarding or served by cache).
+type batchUpstream struct {
+	mu       sync.Mutex
+	request  *http.Request
+	upstream caddyhttp.HandlerFunc
+	pending  int
+	flushed  bool
+	resolved []bool
+	waiters  []*batchUpstreamWaiter
+}
+
+type batchUpstreamWaiter struct {
+	w    http.ResponseWriter
+	body []byte
+	done chan error
+}
+
+func newBatchUpstream(r *http.Request, upstream caddyhttp.HandlerFunc, size int) *batchUpstream {
+	return &batchUpstream{
+		request:  r,
+		upstream: upstream,
+		pending:  size,
+		resolved: make([]bool, size),
+	}
+}
+
+func (b *batchUpstream) handlerFor(i int) caddyhttp.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		b.mu.Lock()
+
+		// forward directly in cases operation already resolved like swr in background.
+		if b.flushed || b.resolved[i] {
+			b.mu.Unlock()
+
+			return b.upstream(w, r)
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		waiter := &batchUpstreamWaiter{
+			w:    w,
+			body: body,
+			done: make(chan error, 1),
+		}
+		b.waiters = append(b.waiters, waiter)
+		b.resolve(i)
+		b.mu.Unlock()
+
+		return <-waiter.done
+	}
+}
+
+// release mark operation resolved without forwarding to upstream.
+func (b *batchUpstream) release(i int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.resolve(i)
+}
+
+func (b *batchUpstream) resolve(i int) {
+	if b.resolved[i] {
+		return
+	}
+
+	b.resolved[i] = true
+	b.pending--
+
+	if b.pending > 0 {
+		return
+	}
+
+	b.flushed = true
+
+	if len(b.waiters) > 0 {
+		go b.flush(b.waiters)
+	}
+}
+
+func (b *batchUpstream) flush(waiters []*batchUpstreamWaiter) {
+	bodies := make([]json.RawMessage, len(waiters))
+
+	for i, waiter := range waiters {
+		bodies[i] = waiter.body
+	}
+
+	rawBody, _ := json.Marshal(bodies) // nolint:errchkjson
+	buff := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buff)
+	buff.Reset()
+
+	rw := newCachingResponseWriter(buff)
+	r := prepareHTTPRequest(b.request.Context(), b.request, rw)
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(rawBody))
+	r.ContentLength = int64(len(rawBody))
+	r.Header.Set("content-length", strconv.Itoa(len(rawBody)))
+
+	if err := b.upstream(rw, r); err != nil {
+		for _, waiter := range waiters {
+			waiter.done <- err
+		}
+
+		return
+	}
+
+	var results []json.RawMessage
+
+	if err := json.Unmarshal(buff.Bytes(), &results); err != nil || len(results) != len(waiters) {
+		// upstream not support batching or something went wrong, all operations will get the same response.
+		results = make([]json.RawMessage, len(waiters))
+
+		for i := range results {
+			results[i] = buff.Bytes()
+		}
+	}
+
+	for i, waiter := range waiters {
+		for name, values := range rw.Header().Clone() {
+			waiter.w.Header()[name] = values
+		}
+
+		waiter.w.Header().Del("content-length")
+		waiter.w.WriteHeader(rw.Status())
+		_, err := waiter.w.Write(results[i])
+		waiter.done <- err
+	}
+}
@@ -0,0 +1,130 @@
+package gbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsBatchHTTPRequest(t *testing.T) {
+	testCases := map[string]struct {
+		body     string
+		expected bool
+	}{
+		"batch":            {body: `[{"query": "query { users { name } }"}]`, expected: true},
+		"batch_whitespace": {body: " \n\t[{\"query\": \"query { users { name } }\"}]", expected: true},
+		"single":           {body: `{"query": "query { users { name } }"}`},
+		"empty":            {body: ""},
+	}
+
+	for name, testCase := range testCases {
+		r, _ := http.NewRequest(http.MethodPost, "http://localhost:9090/graphql", strings.NewReader(testCase.body)) // nolint:noctx
+
+		require.Equalf(t, testCase.expected, isBatchHTTPRequest(r), "case %s: unexpected result", name)
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoErrorf(t, err, "case %s", name)
+		require.Equalf(t, testCase.body, string(body), "case %s: body should not be consumed", name)
+	}
+}
+
+func TestBatchUpstream(t *testing.T) {
+	var forwardedBodies []string
+	upstream := func(w http.ResponseWriter, r *http.Request) error {
+		body, _ := ioutil.ReadAll(r.Body)
+		forwardedBodies = append(forwardedBodies, string(body))
+		var operations []json.RawMessage
+
+		if err := json.Unmarshal(body, &operations); err != nil {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, err = w.Write([]byte(`{"data":{"single":true}}`))
+
+			return err
+		}
+
+		results := make([]string, len(operations))
+
+		for i, operation := range operations {
+			results[i] = fmt.Sprintf(`{"data":{"operation":%s}}`, operation)
+		}
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("[" + strings.Join(results, ",") + "]"))
+
+		return err
+	}
+
+	r, _ := http.NewRequest("POST", "http://localhost:9090/graphql", nil)
+	r = r.WithContext(context.WithValue(r.Context(), caddyhttp.ServerCtxKey, new(caddyhttp.Server)))
+	b := newBatchUpstream(r, upstream, 3)
+	writers := make([]*cachingResponseWriter, 3)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 3; i++ {
+		writers[i] = newCachingResponseWriter(new(bytes.Buffer))
+
+		if i == 1 {
+			b.release(i) // simulate cache hit
+
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			or, _ := http.NewRequest("POST", "http://localhost:9090/graphql", strings.NewReader(fmt.Sprintf(`{"query":"query Q%d { a }"}`, i)))
+			require.NoError(t, b.handlerFor(i)(writers[i], or))
+		}(i)
+	}
+
+	wg.Wait()
+
+	require.Len(t, forwardedBodies, 1)
+	require.Contains(t, forwardedBodies[0], `query Q0 { a }`)
+	require.Contains(t, forwardedBodies[0], `query Q2 { a }`)
+	require.Equal(t, http.StatusOK, writers[0].Status())
+	require.JSONEq(t, `{"data":{"operation":{"query":"query Q0 { a }"}}}`, writers[0].buffer.String())
+	require.JSONEq(t, `{"data":{"operation":{"query":"query Q2 { a }"}}}`, writers[2].buffer.String())
+	require.Empty(t, writers[1].buffer.String())
+
+	// operation already resolved will be forwarded directly.
+	or, _ := http.NewRequest("POST", "http://localhost:9090/graphql", strings.NewReader(`{"query":"query Q1 { a }"}`))
+	require.NoError(t, b.handlerFor(1)(writers[1], or))
+	require.Len(t, forwardedBodies, 2)
+	require.JSONEq(t, `{"data":{"single":true}}`, writers[1].buffer.String())
+}
+
+func TestWriteBatchResponse(t *testing.T) {
+	writers := make([]*cachingResponseWriter, 2)
+
+	for i, status := range []CachingStatus{CachingStatusHit, CachingStatusMiss} {
+		writers[i] = newCachingResponseWriter(new(bytes.Buffer))
+		writers[i].Header().Set("x-cache", string(status))
+		writers[i].Header().Set("cache-control", "public")
+		writers[i].Header().Set("content-type", "application/json")
+		writers[i].WriteHeader(http.StatusOK)
+		writers[i].Write([]byte(fmt.Sprintf(`{"data":{"index":%d}}`+"\n", i)))
+	}
+
+	w := newCachingResponseWriter(new(bytes.Buffer))
+
+	require.NoError(t, writeBatchResponse(w, writers))
+	require.Equal(t, http.StatusOK, w.Status())
+	require.Equal(t, `[{"data":{"index":0}},{"data":{"index":1}}]`, w.buffer.String())
+	require.Equal(t, []string{"HIT", "MISS"}, w.Header().Values("x-cache"))
+	require.Equal(t, []string{"application/json"}, w.Header().Values("content-type"))
+	require.Empty(t, w.Header().Get("cache-control"))
+}
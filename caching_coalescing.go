@@ -0,0 +1,97 @@
+package gbox
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// cachingFlight is an in-flight upstream request of a query result cache key, identical requests missing cache
+// can wait for its response instead of forwarding to upstream.
+type cachingFlight struct {
+	done   chan struct{}
+	status int
+	header http.Header
+	body   []byte
+	err    error
+}
+
+// resolve stores response of upstream request, must be called before flight leaving.
+func (f *cachingFlight) resolve(rw *cachingResponseWriter, err error) {
+	if err != nil {
+		f.err = err
+
+		return
+	}
+
+	f.status = rw.Status()
+	f.header = rw.Header().Clone()
+	f.body = append([]byte(nil), rw.buffer.Bytes()...)
+}
+
+func (f *cachingFlight) writeResponse(w http.ResponseWriter) error {
+	for name, values := range f.header {
+		w.Header()[name] = values
+	}
+
+	w.WriteHeader(f.status)
+	_, err := w.Write(f.body)
+
+	return err
+}
+
+type cachingFlights struct {
+	mu      sync.Mutex
+	flights map[string]*cachingFlight
+}
+
+// join returns in-flight request of key given, leader is true when there is not any request in-flight,
+// and caller must leave the flight after resolved it.
+func (f *cachingFlights) join(key string) (flight *cachingFlight, leader bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.flights == nil {
+		f.flights = make(map[string]*cachingFlight)
+	}
+
+	if flight, ok := f.flights[key]; ok {
+		return flight, false
+	}
+
+	flight = &cachingFlight{
+		done: make(chan struct{}),
+	}
+	f.flights[key] = flight
+
+	return flight, true
+}
+
+func (f *cachingFlights) leave(key string, flight *cachingFlight) {
+	f.mu.Lock()
+	delete(f.flights, key)
+	f.mu.Unlock()
+
+	close(flight.done)
+}
+
+// waitFlight waits for in-flight request resolved, returns false when waiting timeout or request failed,
+// in this case caller should forward request to upstream itself.
+func (c *Caching) waitFlight(r *cachingRequest, flight *cachingFlight) bool {
+	// waiting request will not be forwarded to upstream as part of batch request.
+	if release, ok := r.httpRequest.Context().Value(upstreamWaitCtxKey).(func()); ok {
+		release()
+	}
+
+	timer := time.NewTimer(time.Duration(c.CoalescingTimeout))
+	defer timer.Stop()
+
+	select {
+	case <-flight.done:
+		return flight.err == nil
+	case <-timer.C:
+		return false
+	case <-r.httpRequest.Context().Done():
+		return false
+	}
+}
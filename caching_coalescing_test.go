@@ -0,0 +1,69 @@
+package gbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingFlights(t *testing.T) {
+	flights := new(cachingFlights)
+	flight, leader := flights.join("a")
+	require.True(t, leader)
+
+	joined, leader := flights.join("a")
+	require.False(t, leader, "identical key should join in-flight request")
+	require.Same(t, flight, joined)
+
+	_, leader = flights.join("b")
+	require.True(t, leader, "different key should not join in-flight request")
+
+	rw := newCachingResponseWriter(bytes.NewBufferString(`{"data": {}}`))
+	rw.Header().Set("content-type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	flight.resolve(rw, nil)
+	rw.buffer.Reset()
+	flights.leave("a", flight)
+
+	<-joined.done
+
+	recorder := httptest.NewRecorder()
+	require.NoError(t, joined.writeResponse(recorder))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/json", recorder.Header().Get("content-type"))
+	require.Equal(t, `{"data": {}}`, recorder.Body.String(), "body should be copied on resolving")
+
+	_, leader = flights.join("a")
+	require.True(t, leader, "key should be free after leaving")
+}
+
+func TestCaching_WaitFlight(t *testing.T) {
+	c := &Caching{CoalescingTimeout: caddy.Duration(50 * time.Millisecond)}
+	released := false
+	ctx := context.WithValue(context.Background(), upstreamWaitCtxKey, func() { released = true })
+	r := &cachingRequest{httpRequest: httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx)}
+	flights := new(cachingFlights)
+
+	flight, _ := flights.join("timeout")
+	require.False(t, c.waitFlight(r, flight), "should be false when waiting timeout")
+	require.True(t, released, "batch upstream slot should be released before waiting")
+
+	flight, _ = flights.join("failed")
+	flight.resolve(nil, errors.New("failed"))
+	flights.leave("failed", flight)
+	require.False(t, c.waitFlight(r, flight), "should be false when in-flight request failed")
+
+	flight, _ = flights.join("succeed")
+	go func() {
+		flight.resolve(newCachingResponseWriter(new(bytes.Buffer)), nil)
+		flights.leave("succeed", flight)
+	}()
+	require.True(t, c.waitFlight(r, flight))
+}
@@ -0,0 +1,169 @@
+package gbox
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CachingCompressionGzip = "gzip"
+	CachingCompressionZstd = "zstd"
+
+	defaultCachingCompressionMinSize = 1024
+)
+
+var (
+	zstdEncoder     *zstd.Encoder
+	zstdDecoder     *zstd.Decoder
+	zstdEncoderErr  error
+	zstdDecoderErr  error
+	zstdEncoderOnce sync.Once
+	zstdDecoderOnce sync.Once
+)
+
+// loadZstdEncoder returns shared zstd encoder, error of creating it will be returned on every call.
+func loadZstdEncoder() (*zstd.Encoder, error) {
+	zstdEncoderOnce.Do(func() {
+		zstdEncoder, zstdEncoderErr = zstd.NewWriter(nil)
+	})
+
+	return zstdEncoder, zstdEncoderErr
+}
+
+// loadZstdDecoder returns shared zstd decoder, error of creating it will be returned on every call.
+func loadZstdDecoder() (*zstd.Decoder, error) {
+	zstdDecoderOnce.Do(func() {
+		zstdDecoder, zstdDecoderErr = zstd.NewReader(nil)
+	})
+
+	return zstdDecoder, zstdDecoderErr
+}
+
+// CachingCompression settings compress query results before storing, compressed query results will be served
+// as is to clients accept the encoding and decompressed for others.
+type CachingCompression struct {
+	// Compression algorithm, it can be `gzip` or `zstd`, `gzip` by default.
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// Min size in bytes of query results to compress, 1024 by default.
+	MinSize int `json:"min_size,omitempty"`
+}
+
+func (c *CachingCompression) validate() error {
+	switch c.Algorithm {
+	case "", CachingCompressionGzip, CachingCompressionZstd:
+	default:
+		return fmt.Errorf("caching compression algorithm %s is not supported", c.Algorithm)
+	}
+
+	if c.MinSize < 0 {
+		return fmt.Errorf("caching compression min size must not be negative")
+	}
+
+	return nil
+}
+
+// compress compresses body given when it is large enough, encoding will be empty if body is not compressed.
+func (c *CachingCompression) compress(body []byte) (compressed []byte, encoding string, err error) {
+	if c == nil {
+		return body, "", nil
+	}
+
+	minSize := c.MinSize
+
+	if minSize == 0 {
+		minSize = defaultCachingCompressionMinSize
+	}
+
+	if len(body) < minSize {
+		return body, "", nil
+	}
+
+	switch c.Algorithm {
+	case CachingCompressionZstd:
+		var encoder *zstd.Encoder
+
+		if encoder, err = loadZstdEncoder(); err != nil {
+			return nil, "", err
+		}
+
+		return encoder.EncodeAll(body, nil), CachingCompressionZstd, nil
+	default:
+		buff := new(bytes.Buffer)
+		w := gzip.NewWriter(buff)
+
+		if _, err = w.Write(body); err != nil {
+			return nil, "", err
+		}
+
+		if err = w.Close(); err != nil {
+			return nil, "", err
+		}
+
+		return buff.Bytes(), CachingCompressionGzip, nil
+	}
+}
+
+func decompressCachingQueryResultBody(body []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return body, nil
+	case CachingCompressionZstd:
+		decoder, err := loadZstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.DecodeAll(body, nil)
+	case CachingCompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		defer r.Close()
+
+		return ioutil.ReadAll(r)
+	default:
+		return nil, fmt.Errorf("caching query result encoding %s is not supported", encoding)
+	}
+}
+
+// acceptEncoding check encoding given is acceptable by `accept-encoding` header value.
+// https://datatracker.ietf.org/doc/html/rfc7231#section-5.3.4
+func acceptEncoding(header, encoding string) bool {
+	accepted := false
+
+	for _, value := range strings.Split(header, ",") {
+		parts := strings.SplitN(value, ";", 2)
+		coding := strings.ToLower(strings.TrimSpace(parts[0]))
+
+		if coding != encoding && coding != "*" {
+			continue
+		}
+
+		qValue := 1.0
+
+		if len(parts) == 2 && strings.HasPrefix(strings.TrimSpace(parts[1]), "q=") {
+			if v, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(parts[1]), "q="), 64); err == nil {
+				qValue = v
+			}
+		}
+
+		// explicit coding takes precedence over wildcard.
+		if coding == encoding {
+			return qValue > 0
+		}
+
+		accepted = qValue > 0
+	}
+
+	return accepted
+}
@@ -0,0 +1,105 @@
+package gbox
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingCompression_Compress(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"data":{"users":[{"name":"A"}]}}`), 100)
+
+	for _, algorithm := range []string{"", CachingCompressionGzip, CachingCompressionZstd} {
+		c := &CachingCompression{Algorithm: algorithm}
+		compressed, encoding, err := c.compress(body)
+		require.NoError(t, err)
+		require.NotEmpty(t, encoding)
+		require.Less(t, len(compressed), len(body))
+
+		decompressed, err := decompressCachingQueryResultBody(compressed, encoding)
+		require.NoError(t, err)
+		require.Equal(t, body, decompressed)
+	}
+
+	compressed, encoding, err := (&CachingCompression{MinSize: len(body) + 1}).compress(body)
+	require.NoError(t, err)
+	require.Empty(t, encoding, "body smaller than min size should not be compressed")
+	require.Equal(t, body, compressed)
+
+	compressed, encoding, err = (*CachingCompression)(nil).compress(body)
+	require.NoError(t, err)
+	require.Empty(t, encoding)
+	require.Equal(t, body, compressed)
+}
+
+func TestCachingCompression_Validate(t *testing.T) {
+	require.NoError(t, (&CachingCompression{Algorithm: CachingCompressionZstd}).validate())
+	require.EqualError(t, (&CachingCompression{Algorithm: "br"}).validate(), "caching compression algorithm br is not supported")
+	require.Error(t, (&CachingCompression{MinSize: -1}).validate())
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	testCases := map[string]struct {
+		header   string
+		encoding string
+		expected bool
+	}{
+		"empty":             {header: "", encoding: "gzip", expected: false},
+		"exact":             {header: "gzip, deflate", encoding: "gzip", expected: true},
+		"case insensitive":  {header: "GZIP", encoding: "gzip", expected: true},
+		"other":             {header: "gzip, br", encoding: "zstd", expected: false},
+		"q zero":            {header: "gzip;q=0, br", encoding: "gzip", expected: false},
+		"wildcard":          {header: "*", encoding: "zstd", expected: true},
+		"explicit rejected": {header: "*, zstd;q=0", encoding: "zstd", expected: false},
+	}
+
+	for name, testCase := range testCases {
+		require.Equalf(t, testCase.expected, acceptEncoding(testCase.header, testCase.encoding), "case %s", name)
+	}
+}
+
+func TestCaching_HandleQueryRequestCompression(t *testing.T) {
+	body := `{"data": {"users": [{"name": "A"}]}}`
+	c := newTestCaching(t, CachingRules{
+		"default": &CachingRule{
+			MaxAge: caddy.Duration(time.Hour),
+		},
+	})
+	c.Compression = &CachingCompression{Algorithm: CachingCompressionGzip, MinSize: 1}
+	upstream := func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("content-type", "application/json")
+		w.Header().Set("content-length", "36")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(body))
+
+		return err
+	}
+
+	w := httptest.NewRecorder()
+	require.NoError(t, c.handleQueryRequest(w, newTestCachingRequest(), upstream))
+	require.Equal(t, string(CachingStatusMiss), w.Header().Get("x-cache"))
+	require.Empty(t, w.Header().Get("content-encoding"), "miss response should not be compressed")
+
+	w = httptest.NewRecorder()
+	r := newTestCachingRequest()
+	r.acceptEncoding = "gzip, br"
+	require.NoError(t, c.handleQueryRequest(w, r, upstream))
+	require.Equal(t, string(CachingStatusHit), w.Header().Get("x-cache"))
+	require.Equal(t, CachingCompressionGzip, w.Header().Get("content-encoding"))
+	require.Empty(t, w.Header().Get("content-length"))
+
+	decompressed, err := decompressCachingQueryResultBody(w.Body.Bytes(), CachingCompressionGzip)
+	require.NoError(t, err)
+	require.JSONEq(t, body, string(decompressed))
+
+	w = httptest.NewRecorder()
+	require.NoError(t, c.handleQueryRequest(w, newTestCachingRequest(), upstream))
+	require.Equal(t, string(CachingStatusHit), w.Header().Get("x-cache"))
+	require.Empty(t, w.Header().Get("content-encoding"), "query result should be decompressed for clients not accept encoding")
+	require.JSONEq(t, body, w.Body.String())
+}
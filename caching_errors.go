@@ -0,0 +1,128 @@
+package gbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+const (
+	// CachingErrorsPolicyNever query results contain errors will not be cached.
+	CachingErrorsPolicyNever = "never"
+
+	// CachingErrorsPolicyMaxAge query results contain errors will be cached with errors max age.
+	CachingErrorsPolicyMaxAge = "max_age"
+
+	// CachingErrorsPolicyCodes query results will be cached with errors max age
+	// only when all errors have `extensions.code` in errors codes list.
+	CachingErrorsPolicyCodes = "codes"
+)
+
+// CachingErrors is policy of caching query results contain errors.
+type CachingErrors struct {
+	// Policy of caching query results contain errors, it can be `never`, `max_age` or `codes`, `never` by default.
+	Policy string `json:"policy,omitempty"`
+
+	// How long query results contain errors should be stored, it will be capped by max age of rules.
+	// If not set max age of rules will be used.
+	MaxAge caddy.Duration `json:"max_age,omitempty"`
+
+	// Errors codes (`extensions.code`) allowed to cache in `codes` policy.
+	Codes []string `json:"codes,omitempty"`
+
+	// Deterministic errors codes like `NOT_FOUND`, query results only contain them will be cached with
+	// negative max age whatever policy is.
+	NegativeCodes []string `json:"negative_codes,omitempty"`
+
+	// How long query results only contain negative errors codes should be stored.
+	NegativeMaxAge caddy.Duration `json:"negative_max_age,omitempty"`
+}
+
+func (e *CachingErrors) validate() error {
+	switch e.Policy {
+	case "", CachingErrorsPolicyNever, CachingErrorsPolicyMaxAge:
+	case CachingErrorsPolicyCodes:
+		if len(e.Codes) == 0 {
+			return fmt.Errorf("caching errors codes must be set in %s policy", CachingErrorsPolicyCodes)
+		}
+	default:
+		return fmt.Errorf("caching errors policy %s is not supported", e.Policy)
+	}
+
+	if len(e.NegativeCodes) > 0 && e.NegativeMaxAge <= 0 {
+		return errors.New("caching errors negative max age must greater than zero")
+	}
+
+	return nil
+}
+
+// apply returns max age of query result given, cacheable is false when it should not be cached.
+func (e *CachingErrors) apply(body []byte, maxAge caddy.Duration) (_ caddy.Duration, cacheable bool) {
+	var result struct {
+		Errors []struct {
+			Extensions struct {
+				Code string `json:"code"`
+			} `json:"extensions"`
+		} `json:"errors"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, false
+	}
+
+	if len(result.Errors) == 0 {
+		return maxAge, true
+	}
+
+	if e == nil {
+		return 0, false
+	}
+
+	codes := make([]string, len(result.Errors))
+
+	for i, err := range result.Errors {
+		codes[i] = err.Extensions.Code
+	}
+
+	if len(e.NegativeCodes) > 0 && allIn(codes, e.NegativeCodes) {
+		return e.NegativeMaxAge, true
+	}
+
+	switch e.Policy {
+	case CachingErrorsPolicyMaxAge:
+	case CachingErrorsPolicyCodes:
+		if !allIn(codes, e.Codes) {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if e.MaxAge > 0 && e.MaxAge < maxAge {
+		maxAge = e.MaxAge
+	}
+
+	return maxAge, true
+}
+
+func allIn(values, set []string) bool {
+	for _, value := range values {
+		found := false
+
+		for _, item := range set {
+			if value == item {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,106 @@
+package gbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingErrors_Apply(t *testing.T) {
+	ruleMaxAge := caddy.Duration(time.Hour)
+	notFound := `{"data": {"user": null}, "errors": [{"message": "not found", "extensions": {"code": "NOT_FOUND"}}]}`
+	internal := `{"data": {"user": null}, "errors": [{"message": "internal"}]}`
+	testCases := map[string]struct {
+		errors            *CachingErrors
+		body              string
+		expectedMaxAge    caddy.Duration
+		expectedCacheable bool
+	}{
+		"without_errors": {
+			body:              `{"data": {"user": {"id": 1}}}`,
+			expectedMaxAge:    ruleMaxAge,
+			expectedCacheable: true,
+		},
+		"default_policy": {
+			body: notFound,
+		},
+		"never_policy": {
+			errors: &CachingErrors{Policy: CachingErrorsPolicyNever},
+			body:   notFound,
+		},
+		"max_age_policy": {
+			errors:            &CachingErrors{Policy: CachingErrorsPolicyMaxAge, MaxAge: caddy.Duration(time.Second)},
+			body:              internal,
+			expectedMaxAge:    caddy.Duration(time.Second),
+			expectedCacheable: true,
+		},
+		"max_age_policy_capped_by_rule": {
+			errors:            &CachingErrors{Policy: CachingErrorsPolicyMaxAge, MaxAge: caddy.Duration(2 * time.Hour)},
+			body:              internal,
+			expectedMaxAge:    ruleMaxAge,
+			expectedCacheable: true,
+		},
+		"codes_policy_matched": {
+			errors:            &CachingErrors{Policy: CachingErrorsPolicyCodes, Codes: []string{"NOT_FOUND"}},
+			body:              notFound,
+			expectedMaxAge:    ruleMaxAge,
+			expectedCacheable: true,
+		},
+		"codes_policy_unmatched": {
+			errors: &CachingErrors{Policy: CachingErrorsPolicyCodes, Codes: []string{"NOT_FOUND"}},
+			body:   internal,
+		},
+		"negative_codes": {
+			errors:            &CachingErrors{NegativeCodes: []string{"NOT_FOUND"}, NegativeMaxAge: caddy.Duration(time.Minute)},
+			body:              notFound,
+			expectedMaxAge:    caddy.Duration(time.Minute),
+			expectedCacheable: true,
+		},
+		"negative_codes_unmatched": {
+			errors: &CachingErrors{NegativeCodes: []string{"NOT_FOUND"}, NegativeMaxAge: caddy.Duration(time.Minute)},
+			body:   internal,
+		},
+	}
+
+	for name, testCase := range testCases {
+		maxAge, cacheable := testCase.errors.apply([]byte(testCase.body), ruleMaxAge)
+
+		require.Equalf(t, testCase.expectedCacheable, cacheable, "case %s: unexpected cacheable", name)
+		require.Equalf(t, testCase.expectedMaxAge, maxAge, "case %s: unexpected max age", name)
+	}
+}
+
+func TestCachingErrors_Validate(t *testing.T) {
+	testCases := map[string]struct {
+		errors           *CachingErrors
+		expectedErrorMsg string
+	}{
+		"valid": {
+			errors: &CachingErrors{Policy: CachingErrorsPolicyMaxAge},
+		},
+		"unknown_policy": {
+			errors:           &CachingErrors{Policy: "unknown"},
+			expectedErrorMsg: "caching errors policy unknown is not supported",
+		},
+		"codes_policy_without_codes": {
+			errors:           &CachingErrors{Policy: CachingErrorsPolicyCodes},
+			expectedErrorMsg: "caching errors codes must be set in codes policy",
+		},
+		"negative_codes_without_max_age": {
+			errors:           &CachingErrors{NegativeCodes: []string{"NOT_FOUND"}},
+			expectedErrorMsg: "caching errors negative max age must greater than zero",
+		},
+	}
+
+	for name, testCase := range testCases {
+		err := testCase.errors.validate()
+
+		if testCase.expectedErrorMsg == "" {
+			require.NoErrorf(t, err, "case %s: unexpected error", name)
+		} else {
+			require.EqualErrorf(t, err, testCase.expectedErrorMsg, "case %s: unexpected error message", name)
+		}
+	}
+}
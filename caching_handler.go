@@ -27,6 +27,12 @@ func (c *Caching) HandleRequest(w http.ResponseWriter, r *cachingRequest, h cadd
 	// nolint:exhaustive
 	switch operationType {
 	case graphql.OperationTypeQuery:
+		if c.PartialCaching {
+			if q, err := newCachingPartialQuery(r); err == nil {
+				return c.handlePartialQueryRequest(w, q, h)
+			}
+		}
+
 		return c.handleQueryRequest(w, r, h)
 	case graphql.OperationTypeMutation:
 		return c.handleMutationRequest(w, r, h)
@@ -47,17 +53,60 @@ func (c *Caching) handleQueryRequest(w http.ResponseWriter, r *cachingRequest, h
 	}
 
 	status, result := c.resolvePlan(r, plan)
-	defer c.addMetricsCaching(r.gqlRequest, status)
+	defer func() {
+		c.addMetricsCaching(r.gqlRequest, status)
+	}()
 
 	switch status {
 	case CachingStatusMiss:
+		var flight *cachingFlight
+		stale := result
+		result = nil
+
+		if c.CoalescingTimeout > 0 {
+			var leader bool
+			flight, leader = c.flights.join(plan.queryResultCacheKey)
+
+			if !leader && c.waitFlight(r, flight) {
+				c.addMetricsCachingCoalesced(r.gqlRequest)
+
+				if flight.status >= http.StatusInternalServerError && c.validIfError(r, stale) {
+					status = CachingStatusStale
+
+					return c.writeCachingQueryResult(w, r, status, stale, plan)
+				}
+
+				c.addCachingResponseHeaders(status, result, plan, w.Header())
+
+				return flight.writeResponse(w)
+			}
+
+			if leader {
+				defer c.flights.leave(plan.queryResultCacheKey, flight)
+			} else {
+				flight = nil
+			}
+		}
+
 		bodyBuff := bufferPool.Get().(*bytes.Buffer)
 		defer bufferPool.Put(bodyBuff)
 		bodyBuff.Reset()
 
 		crw := newCachingResponseWriter(bodyBuff)
+		err = h(crw, r.httpRequest)
+
+		if flight != nil {
+			flight.resolve(crw, err)
+		}
 
-		if err = h(crw, r.httpRequest); err != nil {
+		if (err != nil || crw.Status() >= http.StatusInternalServerError) && c.validIfError(r, stale) {
+			c.logger.Warn("upstream failed, serving stale query result", zap.String("cache_key", plan.queryResultCacheKey), zap.Int("status", crw.Status()), zap.Error(err))
+			status = CachingStatusStale
+
+			return c.writeCachingQueryResult(w, r, status, stale, plan)
+		}
+
+		if err != nil {
 			return err
 		}
 
@@ -85,22 +134,22 @@ func (c *Caching) handleQueryRequest(w http.ResponseWriter, r *cachingRequest, h
 			c.logger.Info("caching query result successful", zap.String("cache_key", plan.queryResultCacheKey))
 		}
 	case CachingStatusHit:
-		for header, values := range result.Header {
-			w.Header()[header] = values
+		if err = c.writeCachingQueryResult(w, r, status, result, plan); err != nil || result.Status() != CachingQueryResultStale {
+			return err
 		}
 
-		c.addCachingResponseHeaders(status, result, plan, w.Header())
-		w.WriteHeader(http.StatusOK)
-		_, err = w.Write(result.Body)
+		flight, leader := c.flights.join(plan.queryResultCacheKey)
 
-		if err != nil || result.Status() != CachingQueryResultStale {
-			return err
+		if !leader {
+			return nil // query result is revalidating.
 		}
 
-		r.httpRequest = prepareSwrHTTPRequest(c.ctxBackground, r.httpRequest, w)
+		r.httpRequest = prepareHTTPRequest(c.ctxBackground, r.httpRequest, w)
 
 		go func() {
-			if err := c.swrQueryResult(c.ctxBackground, result, r, h); err != nil {
+			defer c.flights.leave(plan.queryResultCacheKey, flight)
+
+			if err := c.swrQueryResult(c.ctxBackground, result, r, h, flight); err != nil {
 				c.logger.Error("swr failed, can not update query result", zap.String("cache_key", plan.queryResultCacheKey), zap.Error(err))
 			} else {
 				c.logger.Info("swr query result successful", zap.String("cache_key", plan.queryResultCacheKey))
@@ -121,16 +170,47 @@ func (c *Caching) resolvePlan(r *cachingRequest, p *cachingPlan) (CachingStatus,
 
 	result, _ := c.getCachingQueryResult(r.httpRequest.Context(), p)
 
-	if result != nil && (r.cacheControl == nil || result.ValidFor(r.cacheControl)) {
-		err := c.increaseQueryResultHitTimes(r.httpRequest.Context(), result)
-		if err != nil {
-			c.logger.Error("increase query result hit times failed", zap.String("cache_key", p.queryResultCacheKey), zap.Error(err))
-		}
+	if result == nil {
+		return CachingStatusMiss, nil
+	}
+
+	if result.Revalidatable() && (r.cacheControl == nil || result.ValidFor(r.cacheControl)) {
+		c.increaseQueryResultHitTimes(r.httpRequest.Context(), result)
 
 		return CachingStatusHit, result
 	}
 
-	return CachingStatusMiss, nil
+	// result can not be served but it may be used when upstream fails.
+	return CachingStatusMiss, result
+}
+
+func (c *Caching) validIfError(r *cachingRequest, result *cachingQueryResult) bool {
+	return result != nil && result.ValidIfError(r.cacheControl)
+}
+
+func (c *Caching) writeCachingQueryResult(w http.ResponseWriter, r *cachingRequest, s CachingStatus, result *cachingQueryResult, p *cachingPlan) (err error) {
+	body := result.Body
+
+	for header, values := range result.Header {
+		w.Header()[header] = values
+	}
+
+	if result.Encoding != "" {
+		w.Header().Del("content-length")
+		w.Header().Add("vary", "accept-encoding")
+
+		if acceptEncoding(r.acceptEncoding, result.Encoding) {
+			w.Header().Set("content-encoding", result.Encoding)
+		} else if body, err = decompressCachingQueryResultBody(body, result.Encoding); err != nil {
+			return err
+		}
+	}
+
+	c.addCachingResponseHeaders(s, result, p, w.Header())
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body)
+
+	return err
 }
 
 func (c *Caching) addCachingResponseHeaders(s CachingStatus, r *cachingQueryResult, p *cachingPlan, h http.Header) {
@@ -148,9 +228,20 @@ func (c *Caching) addCachingResponseHeaders(s CachingStatus, r *cachingQueryResu
 		for _, v := range c.Varies[name].Cookies {
 			h.Add("vary", fmt.Sprintf("cookie:%s", v))
 		}
+
+		if claims := c.Varies[name].Claims; claims != nil {
+			switch {
+			case claims.Cookie != "":
+				h.Add("vary", fmt.Sprintf("cookie:%s", claims.Cookie))
+			case claims.Header != "":
+				h.Add("vary", claims.Header)
+			default:
+				h.Add("vary", defaultCachingVaryClaimsHeader)
+			}
+		}
 	}
 
-	if s == CachingStatusHit {
+	if s == CachingStatusHit || s == CachingStatusStale {
 		age := int64(r.Age().Seconds())
 		maxAge := int64(time.Duration(r.MaxAge).Seconds())
 		cacheControl := []string{"public", fmt.Sprintf("s-maxage=%d", maxAge)}
@@ -160,8 +251,13 @@ func (c *Caching) addCachingResponseHeaders(s CachingStatus, r *cachingQueryResu
 			cacheControl = append(cacheControl, fmt.Sprintf("stale-while-revalidate=%d", swr))
 		}
 
+		if r.StaleIfError > 0 {
+			staleIfError := int64(time.Duration(r.StaleIfError).Seconds())
+			cacheControl = append(cacheControl, fmt.Sprintf("stale-if-error=%d", staleIfError))
+		}
+
 		h.Set("age", fmt.Sprintf("%d", age))
-		h.Set("cache-control", strings.Join(cacheControl, "; "))
+		h.Set("cache-control", strings.Join(cacheControl, ", "))
 		h.Set("x-cache-hits", fmt.Sprintf("%d", r.HitTime))
 	}
 
@@ -181,7 +277,7 @@ func (c *Caching) addCachingResponseHeaders(s CachingStatus, r *cachingQueryResu
 }
 
 func (c *Caching) handleMutationRequest(w http.ResponseWriter, r *cachingRequest, h caddyhttp.HandlerFunc) (err error) {
-	if !c.AutoInvalidate {
+	if !c.AutoInvalidate && len(c.Invalidation) == 0 {
 		return h(w, r.httpRequest)
 	}
 
@@ -206,26 +302,42 @@ func (c *Caching) handleMutationRequest(w http.ResponseWriter, r *cachingRequest
 		return err
 	}
 
-	foundTags := make(cachingTags)
-	tagAnalyzer := newCachingTagAnalyzer(r, c.TypeKeys)
+	purgeTags := make(cachingTags)
 
-	if aErr := tagAnalyzer.AnalyzeResult(crw.buffer.Bytes(), nil, foundTags); aErr != nil {
-		c.logger.Info("fail to analyze result tags", zap.Error(aErr))
+	if c.AutoInvalidate {
+		foundTags := make(cachingTags)
+		tagAnalyzer := newCachingTagAnalyzer(r, c.TypeKeys)
 
-		return err
+		if aErr := tagAnalyzer.AnalyzeResult(crw.buffer.Bytes(), nil, foundTags); aErr != nil {
+			c.logger.Info("fail to analyze result tags", zap.Error(aErr))
+		}
+
+		for tag := range foundTags.TypeKeys() {
+			purgeTags[tag] = struct{}{}
+		}
 	}
 
-	purgeTags := foundTags.TypeKeys().ToSlice()
+	invalidationTags, iErr := c.Invalidation.tags(r)
+
+	if iErr != nil {
+		c.logger.Info("fail to collect invalidation rules tags", zap.Error(iErr))
+	}
+
+	for tag := range invalidationTags {
+		purgeTags[tag] = struct{}{}
+	}
 
 	if len(purgeTags) == 0 {
 		return err
 	}
 
+	tags := purgeTags.ToSlice()
+
 	if c.DebugHeaders {
-		w.Header().Set("x-debug-purged-tags", strings.Join(purgeTags, "; "))
+		w.Header().Set("x-debug-purged-tags", strings.Join(tags, ", "))
 	}
 
-	if err = c.purgeQueryResultByTags(c.ctxBackground, purgeTags); err != nil {
+	if err = c.purgeQueryResultByTags(c.ctxBackground, tags); err != nil {
 		c.logger.Error("fail to purge query result by tags", zap.Error(err))
 	}
 
@@ -0,0 +1,85 @@
+package gbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"github.com/pquerna/cachecontrol/cacheobject"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type testCachingMetrics struct{}
+
+func (testCachingMetrics) addMetricsCaching(*graphql.Request, CachingStatus) {}
+
+func (testCachingMetrics) addMetricsCachingCoalesced(*graphql.Request) {}
+
+func newTestCaching(t *testing.T, rules CachingRules) *Caching {
+	t.Helper()
+
+	u, _ := url.Parse("freecache://?cache_size=1000000")
+	s, err := NewCachingStore(u)
+	require.NoError(t, err)
+
+	return &Caching{
+		Rules:          rules,
+		store:          s,
+		logger:         zap.NewNop(),
+		ctxBackground:  context.Background(),
+		cachingMetrics: testCachingMetrics{},
+	}
+}
+
+func TestCaching_HandleQueryRequestStaleIfError(t *testing.T) {
+	c := newTestCaching(t, CachingRules{
+		"default": &CachingRule{
+			MaxAge:       caddy.Duration(time.Millisecond),
+			StaleIfError: caddy.Duration(time.Hour),
+		},
+	})
+	upstream := func(status int, err error) func(w http.ResponseWriter, r *http.Request) error {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			if err != nil {
+				return err
+			}
+
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(status)
+			_, e := w.Write([]byte(`{"data": {"users": [{"name": "A"}]}}`))
+
+			return e
+		}
+	}
+
+	w := httptest.NewRecorder()
+	require.NoError(t, c.handleQueryRequest(w, newTestCachingRequest(), upstream(http.StatusOK, nil)))
+	require.Equal(t, string(CachingStatusMiss), w.Header().Get("x-cache"))
+
+	time.Sleep(5 * time.Millisecond)
+
+	w = httptest.NewRecorder()
+	require.NoError(t, c.handleQueryRequest(w, newTestCachingRequest(), upstream(http.StatusBadGateway, nil)))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, string(CachingStatusStale), w.Header().Get("x-cache"))
+	require.Contains(t, w.Header().Get("cache-control"), "stale-if-error=3600")
+	require.JSONEq(t, `{"data": {"users": [{"name": "A"}]}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	require.NoError(t, c.handleQueryRequest(w, newTestCachingRequest(), upstream(0, errors.New("timeout"))))
+	require.Equal(t, string(CachingStatusStale), w.Header().Get("x-cache"))
+
+	w = httptest.NewRecorder()
+	r := newTestCachingRequest()
+	r.cacheControl, _ = cacheobject.ParseRequestCacheControl("stale-if-error=0")
+	require.NoError(t, c.handleQueryRequest(w, r, upstream(http.StatusBadGateway, nil)))
+	require.Equal(t, http.StatusBadGateway, w.Code, "client stale-if-error directive should be respected")
+	require.Equal(t, string(CachingStatusMiss), w.Header().Get("x-cache"))
+}
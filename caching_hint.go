@@ -0,0 +1,186 @@
+package gbox
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/jensneuse/graphql-go-tools/pkg/ast"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"github.com/jensneuse/graphql-go-tools/pkg/pool"
+	"github.com/pquerna/cachecontrol/cacheobject"
+)
+
+const (
+	cachingHintDirective    = "cacheControl"
+	cachingHintScopePrivate = "PRIVATE"
+)
+
+// cachingHint is caching policy hinted by upstream via response Cache-Control header,
+// `extensions.cacheControl` of response body or `@cacheControl` directive of schema.
+type cachingHint struct {
+	// Max age hinted, negative value means max age not hinted.
+	MaxAge caddy.Duration `json:"max_age"`
+
+	// Query results must not be cached (private scope or no-store).
+	NoStore bool `json:"no_store"`
+}
+
+func newCachingHint() *cachingHint {
+	return &cachingHint{
+		MaxAge: -1,
+	}
+}
+
+func (h *cachingHint) merge(other *cachingHint) {
+	if other.NoStore {
+		h.NoStore = true
+	}
+
+	if other.MaxAge >= 0 && (h.MaxAge < 0 || other.MaxAge < h.MaxAge) {
+		h.MaxAge = other.MaxAge
+	}
+}
+
+// apply returns minimum of max age given and max age hinted, cacheable is false when query results should not be cached.
+func (h *cachingHint) apply(maxAge caddy.Duration) (_ caddy.Duration, cacheable bool) {
+	if h.NoStore {
+		return 0, false
+	}
+
+	if h.MaxAge >= 0 && h.MaxAge < maxAge {
+		maxAge = h.MaxAge
+	}
+
+	return maxAge, maxAge > 0
+}
+
+// newResponseCachingHint collects hints of upstream response from Cache-Control header and Apollo-style
+// `extensions.cacheControl` hints https://github.com/apollographql/apollo-cache-control.
+func newResponseCachingHint(header http.Header, body []byte) *cachingHint {
+	hint := newCachingHint()
+
+	if cc, err := cacheobject.ParseResponseCacheControl(header.Get("cache-control")); err == nil {
+		hint.NoStore = cc.NoStore || cc.PrivatePresent
+
+		switch {
+		case cc.NoCachePresent:
+			// no-cache responses may be stored but must be revalidated before reuse, same as zero max age.
+			hint.MaxAge = 0
+		case cc.SMaxAge != -1:
+			hint.MaxAge = caddy.Duration(time.Duration(cc.SMaxAge) * time.Second)
+		case cc.MaxAge != -1:
+			hint.MaxAge = caddy.Duration(time.Duration(cc.MaxAge) * time.Second)
+		}
+	}
+
+	var result struct {
+		Extensions struct {
+			CacheControl struct {
+				Hints []struct {
+					MaxAge *int64 `json:"maxAge"`
+					Scope  string `json:"scope"`
+				} `json:"hints"`
+			} `json:"cacheControl"`
+		} `json:"extensions"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return hint
+	}
+
+	for _, h := range result.Extensions.CacheControl.Hints {
+		fieldHint := newCachingHint()
+		fieldHint.NoStore = h.Scope == cachingHintScopePrivate
+
+		if h.MaxAge != nil {
+			fieldHint.MaxAge = caddy.Duration(time.Duration(*h.MaxAge) * time.Second)
+		}
+
+		hint.merge(fieldHint)
+	}
+
+	return hint
+}
+
+// cachingSchemaHints are hints of `@cacheControl(maxAge: Int, scope: CacheControlScope)` directive,
+// map key is type name for type hints and `type.field` for field hints.
+type cachingSchemaHints map[string]*cachingHint
+
+func newCachingSchemaHints(document *ast.Document) cachingSchemaHints {
+	hints := make(cachingSchemaHints)
+	add := func(key string, directiveRefs []int) {
+		for _, ref := range directiveRefs {
+			if document.DirectiveNameString(ref) != cachingHintDirective {
+				continue
+			}
+
+			hint := newCachingHint()
+
+			if value, ok := document.DirectiveArgumentValueByName(ref, []byte("maxAge")); ok && value.Kind == ast.ValueKindInteger {
+				hint.MaxAge = caddy.Duration(time.Duration(document.IntValueAsInt(value.Ref)) * time.Second)
+			}
+
+			if value, ok := document.DirectiveArgumentValueByName(ref, []byte("scope")); ok && value.Kind == ast.ValueKindEnum {
+				hint.NoStore = document.EnumValueNameString(value.Ref) == cachingHintScopePrivate
+			}
+
+			hints[key] = hint
+		}
+	}
+	addFields := func(typeName string, fieldRefs []int) {
+		for _, ref := range fieldRefs {
+			add(typeName+"."+document.FieldDefinitionNameString(ref), document.FieldDefinitions[ref].Directives.Refs)
+		}
+	}
+
+	for ref, definition := range document.ObjectTypeDefinitions {
+		name := document.ObjectTypeDefinitionNameString(ref)
+		add(name, definition.Directives.Refs)
+		addFields(name, definition.FieldsDefinition.Refs)
+	}
+
+	for ref, definition := range document.InterfaceTypeDefinitions {
+		name := document.InterfaceTypeDefinitionNameString(ref)
+		add(name, definition.Directives.Refs)
+		addFields(name, definition.FieldsDefinition.Refs)
+	}
+
+	return hints
+}
+
+// hintFor returns merged hints of types and fields requested.
+func (hints cachingSchemaHints) hintFor(types graphql.RequestTypes) *cachingHint {
+	hint := newCachingHint()
+
+	for typeName, fields := range types {
+		if typeHint, ok := hints[typeName]; ok {
+			hint.merge(typeHint)
+		}
+
+		for field := range fields {
+			if fieldHint, ok := hints[typeName+"."+field]; ok {
+				hint.merge(fieldHint)
+			}
+		}
+	}
+
+	return hint
+}
+
+func (hints cachingSchemaHints) hash() (uint64, error) {
+	if len(hints) == 0 {
+		return 0, nil
+	}
+
+	hash := pool.Hash64.Get()
+	hash.Reset()
+	defer pool.Hash64.Put(hash)
+
+	if err := json.NewEncoder(hash).Encode(hints); err != nil {
+		return 0, err
+	}
+
+	return hash.Sum64(), nil
+}
@@ -0,0 +1,143 @@
+package gbox
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/jensneuse/graphql-go-tools/pkg/astparser"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewResponseCachingHint(t *testing.T) {
+	testCases := map[string]struct {
+		cacheControl      string
+		body              string
+		expectedMaxAge    caddy.Duration
+		expectedCacheable bool
+	}{
+		"without_hints": {
+			body:              `{"data": {}}`,
+			expectedMaxAge:    caddy.Duration(time.Hour),
+			expectedCacheable: true,
+		},
+		"header_max_age": {
+			cacheControl:      "public, max-age=60",
+			body:              `{"data": {}}`,
+			expectedMaxAge:    caddy.Duration(time.Minute),
+			expectedCacheable: true,
+		},
+		"header_s_maxage": {
+			cacheControl:      "max-age=60, s-maxage=30",
+			body:              `{"data": {}}`,
+			expectedMaxAge:    caddy.Duration(30 * time.Second),
+			expectedCacheable: true,
+		},
+		"header_private": {
+			cacheControl: "private, max-age=60",
+			body:         `{"data": {}}`,
+		},
+		"header_no_store": {
+			cacheControl: "no-store",
+			body:         `{"data": {}}`,
+		},
+		"header_no_cache": {
+			cacheControl: "no-cache, max-age=60",
+			body:         `{"data": {}}`,
+		},
+		"extensions_max_age": {
+			cacheControl:      "max-age=60",
+			body:              `{"data": {}, "extensions": {"cacheControl": {"version": 1, "hints": [{"path": ["users"], "maxAge": 20}, {"path": ["books"], "maxAge": 10}]}}}`,
+			expectedMaxAge:    caddy.Duration(10 * time.Second),
+			expectedCacheable: true,
+		},
+		"extensions_private": {
+			body: `{"data": {}, "extensions": {"cacheControl": {"version": 1, "hints": [{"path": ["me"], "maxAge": 20, "scope": "PRIVATE"}]}}}`,
+		},
+		"extensions_zero_max_age": {
+			body: `{"data": {}, "extensions": {"cacheControl": {"version": 1, "hints": [{"path": ["me"], "maxAge": 0}]}}}`,
+		},
+	}
+
+	for name, testCase := range testCases {
+		header := make(http.Header)
+		header.Set("cache-control", testCase.cacheControl)
+		maxAge, cacheable := newResponseCachingHint(header, []byte(testCase.body)).apply(caddy.Duration(time.Hour))
+
+		require.Equalf(t, testCase.expectedCacheable, cacheable, "case %s: unexpected cacheable", name)
+
+		if cacheable {
+			require.Equalf(t, testCase.expectedMaxAge, maxAge, "case %s: unexpected max age", name)
+		}
+	}
+
+	header := make(http.Header)
+	header.Set("cache-control", "no-cache")
+	hint := newResponseCachingHint(header, []byte(`{"data": {}}`))
+
+	require.False(t, hint.NoStore, "no-cache should not be treated as no-store")
+	require.Equal(t, caddy.Duration(0), hint.MaxAge)
+}
+
+func TestCachingSchemaHints(t *testing.T) {
+	document, report := astparser.ParseGraphqlDocumentString(`
+type Query {
+	users: [User!]! @cacheControl(maxAge: 60)
+	me: User @cacheControl(scope: PRIVATE)
+	books: [Book!]!
+}
+
+type User @cacheControl(maxAge: 30) {
+	name: String!
+	email: String! @cacheControl(maxAge: 10)
+}
+
+type Book {
+	title: String!
+}
+`)
+	require.False(t, report.HasErrors())
+
+	hints := newCachingSchemaHints(&document)
+	hash, err := hints.hash()
+
+	require.NoError(t, err)
+	require.NotZero(t, hash)
+
+	testCases := map[string]struct {
+		types             graphql.RequestTypes
+		expectedMaxAge    caddy.Duration
+		expectedCacheable bool
+	}{
+		"without_hints": {
+			types:             graphql.RequestTypes{"Query": {"books": {}}, "Book": {"title": {}}},
+			expectedMaxAge:    caddy.Duration(time.Hour),
+			expectedCacheable: true,
+		},
+		"type_hint": {
+			types:             graphql.RequestTypes{"Query": {"users": {}}, "User": {"name": {}}},
+			expectedMaxAge:    caddy.Duration(30 * time.Second),
+			expectedCacheable: true,
+		},
+		"field_hint": {
+			types:             graphql.RequestTypes{"Query": {"users": {}}, "User": {"name": {}, "email": {}}},
+			expectedMaxAge:    caddy.Duration(10 * time.Second),
+			expectedCacheable: true,
+		},
+		"private_scope": {
+			types: graphql.RequestTypes{"Query": {"me": {}}, "User": {"name": {}}},
+		},
+	}
+
+	for name, testCase := range testCases {
+		maxAge, cacheable := hints.hintFor(testCase.types).apply(caddy.Duration(time.Hour))
+
+		require.Equalf(t, testCase.expectedCacheable, cacheable, "case %s: unexpected cacheable", name)
+
+		if cacheable {
+			require.Equalf(t, testCase.expectedMaxAge, maxAge, "case %s: unexpected max age", name)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package gbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const cachingHitTimesFlushInterval = time.Second
+
+// cachingHitTimes aggregates hit times of query results in memory, they are flushed periodically
+// to sibling keys of query results instead of rewriting whole query results on every hit.
+type cachingHitTimes struct {
+	mu      sync.Mutex
+	entries map[string]*cachingHitTimesEntry
+}
+
+type cachingHitTimesEntry struct {
+	// generation is created time of query result in unix nano, hit times of query results re-cached
+	// are counted under their own generation, so late flushes of previous generation can not affect them.
+	generation int64
+
+	// hit times had not been flushed yet.
+	pending uint64
+
+	// hit times of store at the last flush, include hit times of other instances sharing store.
+	flushed  uint64
+	expireAt time.Time
+}
+
+// seeded reports whether hit times of query result cache key and generation given had been seeded from store.
+func (h *cachingHitTimes) seeded(key string, generation int64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entry, ok := h.entries[key]
+
+	return ok && entry.generation == generation
+}
+
+// seed sets hit times of store to entry of query result cache key and generation given, entry of previous generation
+// will be replaced.
+func (h *cachingHitTimes) seed(key string, generation int64, flushed uint64, expireAt time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.entries == nil {
+		h.entries = make(map[string]*cachingHitTimesEntry)
+	}
+
+	entry, ok := h.entries[key]
+
+	if !ok || entry.generation != generation {
+		h.entries[key] = &cachingHitTimesEntry{generation: generation, flushed: flushed, expireAt: expireAt}
+
+		return
+	}
+
+	if flushed > entry.flushed {
+		entry.flushed = flushed
+	}
+}
+
+// add increases pending hit times of query result cache key and generation given and returns total of flushed
+// and pending hit times.
+func (h *cachingHitTimes) add(key string, generation int64, expireAt time.Time) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.entries == nil {
+		h.entries = make(map[string]*cachingHitTimesEntry)
+	}
+
+	entry, ok := h.entries[key]
+
+	if !ok || entry.generation != generation {
+		entry = &cachingHitTimesEntry{generation: generation, expireAt: expireAt}
+		h.entries[key] = entry
+	}
+
+	entry.pending++
+
+	return entry.flushed + entry.pending
+}
+
+// reset drops hit times of query result cache key given.
+func (h *cachingHitTimes) reset(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.entries, key)
+}
+
+// take returns pending hit times and clear them, entries of expired query results will be dropped.
+func (h *cachingHitTimes) take() map[string]cachingHitTimesEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pending := make(map[string]cachingHitTimesEntry)
+	now := time.Now()
+
+	for key, entry := range h.entries {
+		if !entry.expireAt.After(now) {
+			delete(h.entries, key)
+
+			continue
+		}
+
+		if entry.pending == 0 {
+			continue
+		}
+
+		pending[key] = *entry
+		entry.pending = 0
+	}
+
+	return pending
+}
+
+// setFlushed sets hit times of store after flushed of query result cache key and generation given,
+// it will be ignored when query result had been reset or re-cached during flush.
+func (h *cachingHitTimes) setFlushed(key string, generation int64, flushed uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if entry, ok := h.entries[key]; ok && entry.generation == generation {
+		entry.flushed = flushed
+	}
+}
+
+func queryResultHitTimesCacheKey(queryResultCacheKey string, generation int64) string {
+	return fmt.Sprintf("%s_hits_%d", queryResultCacheKey, generation)
+}
+
+// increaseQueryResultHitTimes increases hit times of query result given in memory,
+// and set hit times of it include hit times of the last flush and pending hit times.
+// Hit times of store will be looked up on first access of query result only.
+func (c *Caching) increaseQueryResultHitTimes(ctx context.Context, r *cachingQueryResult) {
+	key := r.plan.queryResultCacheKey
+	generation := r.CreatedAt.UnixNano()
+	expireAt := r.CreatedAt.Add(r.Expiration)
+
+	if ttl := time.Until(expireAt); ttl > 0 && !c.hitTimes.seeded(key, generation) {
+		// increase by zero to read counter, since counters of some stores are not encoded by marshaler.
+		flushed, err := c.store.increment(ctx, queryResultHitTimesCacheKey(key, generation), 0, ttl)
+		if err != nil {
+			c.logger.Debug("fail to seed query result hit times", zap.String("cache_key", key), zap.Error(err))
+		}
+
+		c.hitTimes.seed(key, generation, flushed, expireAt)
+	}
+
+	r.HitTime = c.hitTimes.add(key, generation, expireAt)
+}
+
+// resetQueryResultHitTimes resets hit times of query result cache key given when query result had been re-cached,
+// hit times of previous generation in store will be expired with it.
+func (c *Caching) resetQueryResultHitTimes(key string) {
+	c.hitTimes.reset(key)
+}
+
+// flushQueryResultHitTimes adds pending hit times to hit times of query results still alive in store.
+func (c *Caching) flushQueryResultHitTimes(ctx context.Context) {
+	for key, entry := range c.hitTimes.take() {
+		ttl := time.Until(entry.expireAt)
+
+		if ttl <= 0 {
+			continue
+		}
+
+		flushed, err := c.store.increment(ctx, queryResultHitTimesCacheKey(key, entry.generation), entry.pending, ttl)
+		if err != nil {
+			c.logger.Error("flush query result hit times failed", zap.String("cache_key", key), zap.Error(err))
+
+			continue
+		}
+
+		c.hitTimes.setFlushed(key, entry.generation, flushed)
+	}
+}
+
+func (c *Caching) runQueryResultHitTimesFlusher(ctx context.Context) {
+	ticker := time.NewTicker(cachingHitTimesFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.flushQueryResultHitTimes(ctx)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package gbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coocood/freecache"
+	"github.com/eko/gocache/v2/marshaler"
+	"github.com/eko/gocache/v2/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaching_IncreaseQueryResultHitTimes(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCaching(t, nil)
+	result := &cachingQueryResult{
+		CreatedAt:  time.Now(),
+		Expiration: time.Hour,
+		plan:       &cachingPlan{queryResultCacheKey: "test"},
+	}
+
+	c.increaseQueryResultHitTimes(ctx, result)
+	require.Equal(t, uint64(1), result.HitTime)
+
+	c.increaseQueryResultHitTimes(ctx, result)
+	require.Equal(t, uint64(2), result.HitTime)
+
+	c.flushQueryResultHitTimes(ctx)
+	require.Zero(t, c.hitTimes.entries["test"].pending)
+	require.Equal(t, uint64(2), c.hitTimes.entries["test"].flushed)
+
+	generation := result.CreatedAt.UnixNano()
+	var flushed uint64
+	_, err := c.store.Get(ctx, queryResultHitTimesCacheKey("test", generation), &flushed)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), flushed)
+
+	c.increaseQueryResultHitTimes(ctx, result)
+	require.Equal(t, uint64(3), result.HitTime, "hit times should include flushed and pending hit times")
+
+	// simulate hit times flushed by other instance sharing store.
+	_, err = c.store.increment(ctx, queryResultHitTimesCacheKey("test", generation), 10, time.Hour)
+	require.NoError(t, err)
+
+	c.flushQueryResultHitTimes(ctx)
+	c.increaseQueryResultHitTimes(ctx, result)
+	require.Equal(t, uint64(14), result.HitTime, "hit times should include hit times flushed by other instances")
+
+	other := newTestCaching(t, nil)
+	other.store = c.store
+	other.increaseQueryResultHitTimes(ctx, result)
+	require.Equal(t, uint64(14), result.HitTime, "hit times should be seeded from store on first access")
+
+	c.resetQueryResultHitTimes("test")
+	recached := &cachingQueryResult{
+		CreatedAt:  result.CreatedAt.Add(time.Second),
+		Expiration: time.Hour,
+		plan:       result.plan,
+	}
+	c.increaseQueryResultHitTimes(ctx, recached)
+	require.Equal(t, uint64(1), recached.HitTime, "hit times should be reset when query result re-cached")
+
+	other.increaseQueryResultHitTimes(ctx, recached)
+	require.Equal(t, uint64(1), recached.HitTime, "hit times of previous query result should not be counted by other instances")
+
+	expired := &cachingQueryResult{
+		CreatedAt:  time.Now().Add(-time.Hour),
+		Expiration: time.Minute,
+		plan:       &cachingPlan{queryResultCacheKey: "expired"},
+	}
+	c.increaseQueryResultHitTimes(ctx, expired)
+	c.flushQueryResultHitTimes(ctx)
+
+	_, err = c.store.Get(ctx, queryResultHitTimesCacheKey("expired", expired.CreatedAt.UnixNano()), &flushed)
+	require.Error(t, err, "hit times of expired query results should not be flushed")
+	require.NotContains(t, c.hitTimes.entries, "expired")
+}
+
+func TestCaching_IncreaseQueryResultHitTimesWithoutStoreLookup(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCaching(t, nil)
+	counting := &testCountingCachingStore{
+		StoreInterface: store.NewFreecache(freecache.NewCache(1000000), nil),
+		gets:           make(map[interface{}]int),
+	}
+	c.store = &CachingStore{Marshaler: marshaler.New(counting)}
+	result := &cachingQueryResult{
+		CreatedAt:  time.Now(),
+		Expiration: time.Hour,
+		plan:       &cachingPlan{queryResultCacheKey: "test"},
+	}
+
+	c.increaseQueryResultHitTimes(ctx, result)
+	require.Equal(t, 1, counting.gets[queryResultHitTimesCacheKey("test", result.CreatedAt.UnixNano())], "hit times should be seeded on first access")
+
+	for key := range counting.gets {
+		delete(counting.gets, key)
+	}
+
+	c.increaseQueryResultHitTimes(ctx, result)
+	c.increaseQueryResultHitTimes(ctx, result)
+
+	require.Equal(t, uint64(3), result.HitTime)
+	require.Empty(t, counting.gets, "hit times should not be looked up on next hits")
+}
+
+func TestCaching_ResetQueryResultHitTimesConcurrentFlush(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCaching(t, nil)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("test_%d", i)
+		result := &cachingQueryResult{
+			CreatedAt:  time.Now(),
+			Expiration: time.Hour,
+			plan:       &cachingPlan{queryResultCacheKey: key},
+		}
+		recached := &cachingQueryResult{
+			CreatedAt:  result.CreatedAt.Add(time.Second),
+			Expiration: time.Hour,
+			plan:       result.plan,
+		}
+
+		for j := 0; j < 10; j++ {
+			c.increaseQueryResultHitTimes(ctx, result)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			c.flushQueryResultHitTimes(ctx)
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			c.resetQueryResultHitTimes(key)
+
+			for j := 0; j < 5; j++ {
+				c.increaseQueryResultHitTimes(ctx, recached)
+			}
+		}()
+
+		wg.Wait()
+		c.flushQueryResultHitTimes(ctx)
+
+		var flushed uint64
+		_, err := c.store.Get(ctx, queryResultHitTimesCacheKey(key, recached.CreatedAt.UnixNano()), &flushed)
+		require.NoError(t, err)
+		require.Equal(t, uint64(5), flushed, "late flush should not affect hit times after reset")
+
+		c.increaseQueryResultHitTimes(ctx, recached)
+		require.Equal(t, uint64(6), recached.HitTime)
+	}
+}
@@ -0,0 +1,219 @@
+package gbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jensneuse/graphql-go-tools/pkg/ast"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+)
+
+// CachingInvalidationRule maps mutation fields to purge actions, it's useful for mutations
+// their results do not contain type keys of changed objects, ex: `deleteUser(id: 1): Boolean!`.
+type CachingInvalidationRule struct {
+	// Mutation fields trigger the rule, ex: `deleteUser`.
+	Fields []string `json:"fields,omitempty"`
+
+	// Types names to purge query results contain them.
+	Types []string `json:"types,omitempty"`
+
+	// Type fields to purge query results contain them, ex: `User { name }` will purge query results have field `name` of type User.
+	TypeFields graphql.RequestTypes `json:"type_fields,omitempty"`
+
+	// Operation names to purge query results of them.
+	OperationNames []string `json:"operation_names,omitempty"`
+
+	// Type keys to purge, type key values taken from mutation field arguments,
+	// ex: `User:id:$id` will purge query results contain User has id equals to `id` argument,
+	// nested arguments can be accessed by dot, ex: `User:id:$input.id`.
+	TypeKeys []string `json:"type_keys,omitempty"`
+}
+
+type CachingInvalidationRules map[string]*CachingInvalidationRule
+
+func (r *CachingInvalidationRule) validate() error {
+	if len(r.Fields) == 0 {
+		return errors.New("fields must be set")
+	}
+
+	if len(r.Types) == 0 && len(r.TypeFields) == 0 && len(r.OperationNames) == 0 && len(r.TypeKeys) == 0 {
+		return errors.New("at least one of types, type fields, operation names or type keys must be set")
+	}
+
+	for _, typeKey := range r.TypeKeys {
+		if _, _, _, err := parseCachingInvalidationTypeKey(typeKey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matchField reports whether mutation field name given triggers the rule.
+func (r *CachingInvalidationRule) matchField(name string) bool {
+	for _, field := range r.Fields {
+		if field == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collectTags adds purging tags of the rule to tags given, type keys values will be taken from arguments given.
+func (r *CachingInvalidationRule) collectTags(arguments map[string]interface{}, tags cachingTags) {
+	for _, typeName := range r.Types {
+		tags[fmt.Sprintf(cachingTagTypePattern, typeName)] = struct{}{}
+	}
+
+	for typeName, fields := range r.TypeFields {
+		for field := range fields {
+			tags[fmt.Sprintf(cachingTagTypeFieldPattern, typeName, field)] = struct{}{}
+		}
+	}
+
+	for _, name := range r.OperationNames {
+		tags[fmt.Sprintf(cachingTagOperationPattern, name)] = struct{}{}
+	}
+
+	for _, typeKey := range r.TypeKeys {
+		typeName, field, path, _ := parseCachingInvalidationTypeKey(typeKey)
+
+		for _, value := range cachingInvalidationArgumentValues(arguments, path) {
+			tags[fmt.Sprintf(cachingTagTypeKeyPattern, typeName, field, value)] = struct{}{}
+		}
+	}
+}
+
+// parseCachingInvalidationTypeKey parses type key template, ex: `User:id:$input.id`.
+func parseCachingInvalidationTypeKey(typeKey string) (typeName, field string, path []string, err error) {
+	parts := strings.SplitN(typeKey, ":", 3)
+
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || len(parts[2]) < 2 || !strings.HasPrefix(parts[2], "$") {
+		return "", "", nil, fmt.Errorf("invalid type key %s, it should be in format `Type:field:$argument`", typeKey)
+	}
+
+	return parts[0], parts[1], strings.Split(parts[2][1:], "."), nil
+}
+
+// cachingInvalidationArgumentValues returns string values of argument at path given, list values will be flattened.
+func cachingInvalidationArgumentValues(data interface{}, path []string) []string {
+	switch v := data.(type) {
+	case []interface{}:
+		var values []string
+
+		for _, item := range v {
+			values = append(values, cachingInvalidationArgumentValues(item, path)...)
+		}
+
+		return values
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return nil
+		}
+
+		return cachingInvalidationArgumentValues(v[path[0]], path[1:])
+	case string:
+		if len(path) == 0 {
+			return []string{v}
+		}
+	case float64:
+		if len(path) == 0 {
+			return []string{strconv.FormatInt(int64(v), 10)}
+		}
+	}
+
+	return nil
+}
+
+// tags returns purging tags of rules triggered by root fields of mutation request given.
+func (rules CachingInvalidationRules) tags(r *cachingRequest) (cachingTags, error) {
+	tags := make(cachingTags)
+
+	if len(rules) == 0 {
+		return tags, nil
+	}
+
+	if err := r.initOperation(); err != nil {
+		return nil, err
+	}
+
+	operation := r.operation
+	ref, ok := partialOperationDefinitionRef(operation, r.gqlRequest.OperationName)
+
+	if !ok {
+		return tags, nil
+	}
+
+	variables := make(map[string]json.RawMessage)
+
+	if len(operation.Input.Variables) > 0 {
+		if err := json.Unmarshal(operation.Input.Variables, &variables); err != nil {
+			return nil, err
+		}
+	}
+
+	selectionSet := operation.OperationDefinitions[ref].SelectionSet
+
+	for _, selection := range operation.SelectionSets[selectionSet].SelectionRefs {
+		if operation.Selections[selection].Kind != ast.SelectionKindField {
+			continue
+		}
+
+		field := operation.Selections[selection].Ref
+		fieldName := operation.FieldNameString(field)
+		var arguments map[string]interface{}
+
+		for _, rule := range rules {
+			if !rule.matchField(fieldName) {
+				continue
+			}
+
+			if arguments == nil {
+				var err error
+
+				if arguments, err = cachingInvalidationFieldArguments(operation, field, variables); err != nil {
+					return nil, err
+				}
+			}
+
+			rule.collectTags(arguments, tags)
+		}
+	}
+
+	return tags, nil
+}
+
+// cachingInvalidationFieldArguments returns arguments of field given, variables will be resolved by values given.
+func cachingInvalidationFieldArguments(operation *ast.Document, field int, variables map[string]json.RawMessage) (map[string]interface{}, error) {
+	arguments := make(map[string]interface{})
+
+	for _, argument := range operation.FieldArguments(field) {
+		var raw []byte
+		var err error
+		value := operation.ArgumentValue(argument)
+
+		if value.Kind == ast.ValueKindVariable {
+			raw = variables[operation.VariableValueNameString(value.Ref)]
+		} else if raw, err = operation.ValueToJSON(value); err != nil {
+			return nil, err
+		}
+
+		if len(raw) == 0 {
+			continue
+		}
+
+		var v interface{}
+
+		if err = json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+
+		arguments[operation.ArgumentNameString(argument)] = v
+	}
+
+	return arguments, nil
+}
@@ -0,0 +1,144 @@
+package gbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eko/gocache/v2/store"
+	"github.com/jensneuse/graphql-go-tools/pkg/astparser"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCachingMutationRequest(t *testing.T, query, variables string) *cachingRequest {
+	t.Helper()
+
+	s, err := graphql.NewSchemaFromString(`
+type Query {
+	users: [User!]!
+}
+
+type Mutation {
+	deleteUser(id: ID!): Boolean!
+	deleteUsers(ids: [ID!]!): Boolean!
+	updateUser(input: UpdateUserInput!): Boolean!
+}
+
+input UpdateUserInput {
+	id: ID!
+	name: String!
+}
+
+type User {
+	id: ID!
+	name: String!
+}
+`)
+	require.NoError(t, err)
+	s.Normalize()
+
+	d, _ := astparser.ParseGraphqlDocumentBytes(s.Document())
+	r, _ := http.NewRequest("POST", "http://localhost:9090/graphql", strings.NewReader(`{}`))
+	gqlRequest := &graphql.Request{
+		Query:     query,
+		Variables: json.RawMessage(variables),
+	}
+	require.NoError(t, normalizeGraphqlRequest(s, gqlRequest))
+
+	return newCachingRequest(r, &d, s, gqlRequest)
+}
+
+func TestCachingInvalidationRules_Tags(t *testing.T) {
+	rules := CachingInvalidationRules{
+		"delete_user": &CachingInvalidationRule{
+			Fields:         []string{"deleteUser", "deleteUsers"},
+			OperationNames: []string{"GetUsers"},
+			TypeKeys:       []string{"User:id:$id", "User:id:$ids"},
+		},
+		"update_user": &CachingInvalidationRule{
+			Fields:     []string{"updateUser"},
+			Types:      []string{"Book"},
+			TypeFields: graphql.RequestTypes{"User": {"name": {}}},
+			TypeKeys:   []string{"User:id:$input.id"},
+		},
+	}
+
+	testCases := map[string]struct {
+		query     string
+		variables string
+		expected  []string
+	}{
+		"literal argument": {
+			query:    `mutation { deleteUser(id: 1) }`,
+			expected: []string{"key:User:id:1", "operation:GetUsers"},
+		},
+		"variable argument": {
+			query:     `mutation DeleteUser($id: ID!) { deleteUser(id: $id) }`,
+			variables: `{"id": "2"}`,
+			expected:  []string{"key:User:id:2", "operation:GetUsers"},
+		},
+		"list argument": {
+			query:     `mutation DeleteUsers($ids: [ID!]!) { deleteUsers(ids: $ids) }`,
+			variables: `{"ids": [1, 2]}`,
+			expected:  []string{"key:User:id:1", "key:User:id:2", "operation:GetUsers"},
+		},
+		"nested argument": {
+			query:     `mutation UpdateUser($input: UpdateUserInput!) { updateUser(input: $input) }`,
+			variables: `{"input": {"id": 3, "name": "A"}}`,
+			expected:  []string{"field:User:name", "key:User:id:3", "type:Book"},
+		},
+		"aliased fields": {
+			query:    `mutation { a: deleteUser(id: 1) b: updateUser(input: {id: 4, name: "B"}) }`,
+			expected: []string{"field:User:name", "key:User:id:1", "key:User:id:4", "operation:GetUsers", "type:Book"},
+		},
+	}
+
+	for name, testCase := range testCases {
+		tags, err := rules.tags(newTestCachingMutationRequest(t, testCase.query, testCase.variables))
+		require.NoErrorf(t, err, "case %s", name)
+		require.Equalf(t, testCase.expected, tags.ToSlice(), "case %s", name)
+	}
+}
+
+func TestCachingInvalidationRule_Validate(t *testing.T) {
+	require.NoError(t, (&CachingInvalidationRule{Fields: []string{"deleteUser"}, TypeKeys: []string{"User:id:$id"}}).validate())
+	require.EqualError(t, (&CachingInvalidationRule{TypeKeys: []string{"User:id:$id"}}).validate(), "fields must be set")
+	require.Error(t, (&CachingInvalidationRule{Fields: []string{"deleteUser"}}).validate())
+	require.EqualError(t, (&CachingInvalidationRule{Fields: []string{"deleteUser"}, TypeKeys: []string{"User:id"}}).validate(), "invalid type key User:id, it should be in format `Type:field:$argument`")
+}
+
+func TestCaching_HandleMutationRequestInvalidation(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCaching(t, nil)
+	c.DebugHeaders = true
+	c.Invalidation = CachingInvalidationRules{
+		"delete_user": &CachingInvalidationRule{
+			Fields:   []string{"deleteUser"},
+			TypeKeys: []string{"User:id:$id"},
+		},
+	}
+
+	require.NoError(t, c.store.Set(ctx, "test", "result", &store.Options{Tags: []string{"key:User:id:1"}}))
+
+	upstream := func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"data": {"deleteUser": true}}`))
+
+		return err
+	}
+
+	w := httptest.NewRecorder()
+	r := newTestCachingMutationRequest(t, `mutation { deleteUser(id: 1) }`, "")
+	require.NoError(t, c.handleMutationRequest(w, r, upstream))
+	require.Equal(t, "key:User:id:1", w.Header().Get("x-debug-purged-tags"))
+	require.JSONEq(t, `{"data": {"deleteUser": true}}`, w.Body.String())
+
+	var v string
+	_, err := c.store.Get(ctx, "test", &v)
+	require.Error(t, err, "query result should be purged")
+}
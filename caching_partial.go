@@ -0,0 +1,565 @@
+package gbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jensneuse/graphql-go-tools/pkg/ast"
+	"github.com/jensneuse/graphql-go-tools/pkg/astnormalization"
+	"github.com/jensneuse/graphql-go-tools/pkg/astparser"
+	"github.com/jensneuse/graphql-go-tools/pkg/astprinter"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"go.uber.org/zap"
+)
+
+var errCachingPartialQueryUnsplittable = errors.New("query operation can not be split by root fields")
+
+// cachingPartialQuery is query operation split by its root fields, result of each root field
+// will be cached independently under its own plan and tags.
+type cachingPartialQuery struct {
+	request       *cachingRequest
+	operationName string
+	query         string
+	variables     []byte
+	fields        []string
+	requests      []*graphql.Request
+}
+
+func newCachingPartialQuery(r *cachingRequest) (*cachingPartialQuery, error) {
+	if err := r.initOperation(); err != nil {
+		return nil, err
+	}
+
+	ref, ok := partialOperationDefinitionRef(r.operation, r.gqlRequest.OperationName)
+
+	if !ok {
+		return nil, errCachingPartialQueryUnsplittable
+	}
+
+	selectionSet := r.operation.OperationDefinitions[ref].SelectionSet
+	selections := r.operation.SelectionSets[selectionSet].SelectionRefs
+
+	if len(selections) < 2 {
+		return nil, errCachingPartialQueryUnsplittable
+	}
+
+	fields := make([]string, len(selections))
+	seen := make(map[string]struct{}, len(selections))
+
+	for i, selection := range selections {
+		if r.operation.Selections[selection].Kind != ast.SelectionKindField {
+			return nil, errCachingPartialQueryUnsplittable
+		}
+
+		fields[i] = r.operation.FieldAliasOrNameString(r.operation.Selections[selection].Ref)
+
+		if _, exists := seen[fields[i]]; exists {
+			return nil, errCachingPartialQueryUnsplittable
+		}
+
+		seen[fields[i]] = struct{}{}
+	}
+
+	query, err := astprinter.PrintString(r.operation, r.definition)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &cachingPartialQuery{
+		request:       r,
+		operationName: r.gqlRequest.OperationName,
+		query:         query,
+		variables:     r.operation.Input.Variables,
+		fields:        fields,
+		requests:      make([]*graphql.Request, len(fields)),
+	}
+
+	for i := range fields {
+		if q.requests[i], err = q.gqlRequest(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return q, nil
+}
+
+func partialOperationDefinitionRef(operation *ast.Document, name string) (int, bool) {
+	for _, node := range operation.RootNodes {
+		if node.Kind != ast.NodeKindOperationDefinition {
+			continue
+		}
+
+		if name == "" || operation.OperationDefinitionNameString(node.Ref) == name {
+			return node.Ref, true
+		}
+	}
+
+	return -1, false
+}
+
+// gqlRequest builds GraphQL request of operation only contains root fields at indexes given,
+// unused variables will be removed.
+func (q *cachingPartialQuery) gqlRequest(indexes ...int) (*graphql.Request, error) {
+	operation, report := astparser.ParseGraphqlDocumentString(q.query)
+
+	if report.HasErrors() {
+		return nil, &report
+	}
+
+	ref, ok := partialOperationDefinitionRef(&operation, q.operationName)
+
+	if !ok {
+		return nil, errCachingPartialQueryUnsplittable
+	}
+
+	selectionSet := operation.OperationDefinitions[ref].SelectionSet
+	selections := operation.SelectionSets[selectionSet].SelectionRefs
+	selected := make([]int, len(indexes))
+
+	for i, index := range indexes {
+		selected[i] = selections[index]
+	}
+
+	operation.SelectionSets[selectionSet].SelectionRefs = selected
+	operation.Input.Variables = append([]byte(nil), q.variables...)
+	normalizer := astnormalization.NewWithOpts(astnormalization.WithRemoveUnusedVariables())
+	normalizer.NormalizeOperation(&operation, q.request.definition, &report)
+
+	if report.HasErrors() {
+		return nil, &report
+	}
+
+	query, err := astprinter.PrintString(&operation, q.request.definition)
+	if err != nil {
+		return nil, err
+	}
+
+	gqlRequest := &graphql.Request{
+		OperationName: q.operationName,
+		Query:         query,
+	}
+
+	if len(bytes.TrimSpace(operation.Input.Variables)) > 0 {
+		gqlRequest.Variables = operation.Input.Variables
+	}
+
+	if err = normalizeGraphqlRequest(q.request.schema, gqlRequest); err != nil {
+		return nil, err
+	}
+
+	return gqlRequest, nil
+}
+
+// body marshals GraphQL request of root fields given with extensions of original request, persisted query extension
+// will be dropped since its hash does not match query of root fields.
+func (q *cachingPartialQuery) body(gqlRequest *graphql.Request) ([]byte, error) {
+	var extensions map[string]json.RawMessage
+
+	for name, value := range q.request.extensions {
+		if name == "persistedQuery" {
+			continue
+		}
+
+		if extensions == nil {
+			extensions = make(map[string]json.RawMessage)
+		}
+
+		extensions[name] = value
+	}
+
+	return json.Marshal(struct {
+		*graphql.Request
+		Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+	}{
+		Request:    gqlRequest,
+		Extensions: extensions,
+	})
+}
+
+// handlePartialQueryRequest handles each root field of query operation as independent query operation,
+// root fields missing cache will be forwarded to upstream as single operation and results will be merged in order.
+func (c *Caching) handlePartialQueryRequest(w http.ResponseWriter, q *cachingPartialQuery, h caddyhttp.HandlerFunc) error {
+	var wg sync.WaitGroup
+	r := q.request.httpRequest
+	partial := newCachingPartialUpstream(q, h)
+	writers := make([]*cachingResponseWriter, len(q.requests))
+
+	// extensions of original request will be forwarded with root field requests.
+	if err := q.request.initExtensions(); err != nil {
+		return err
+	}
+
+	// root field queries declare variables extracted from inline arguments, only variables declared by client
+	// can be ignored by caching rules.
+	if err := q.request.initDeclaredVariables(); err != nil {
+		return err
+	}
+
+	for i, gqlRequest := range q.requests {
+		body, err := q.body(gqlRequest)
+		if err != nil {
+			return err
+		}
+
+		index := i
+		release := func() { partial.release(index) }
+		writers[i] = newCachingResponseWriter(new(bytes.Buffer))
+		fieldRequest := prepareHTTPRequest(r.Context(), r, writers[i])
+		fieldRequest = fieldRequest.WithContext(context.WithValue(fieldRequest.Context(), upstreamWaitCtxKey, release))
+		fieldRequest.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+		fieldRequest.ContentLength = int64(len(body))
+		fieldRequest.Header.Set("content-length", strconv.Itoa(len(body)))
+		fieldCachingRequest := newCachingRequest(fieldRequest, q.request.definition, q.request.schema, gqlRequest)
+		fieldCachingRequest.extensions = q.request.extensions
+		fieldCachingRequest.declaredVariables = q.request.declaredVariables
+
+		wg.Add(1)
+
+		go func(i int, rw *cachingResponseWriter, cr *cachingRequest) {
+			defer wg.Done()
+			defer partial.release(i)
+
+			if err := c.handleQueryRequest(rw, cr, partial.handlerFor(i)); err != nil {
+				c.logger.Debug("fail to handle root field of partial query", zap.String("field", q.fields[i]), zap.Error(err))
+				rw.buffer.Reset()
+				writeResponseErrors(err, rw)
+			}
+		}(i, writers[i], fieldCachingRequest)
+	}
+
+	wg.Wait()
+
+	return writePartialResponse(w, writers)
+}
+
+// cachingPartialResult is GraphQL response of a root field or set of root fields.
+type cachingPartialResult struct {
+	Data       json.RawMessage   `json:"data,omitempty"`
+	Errors     []json.RawMessage `json:"errors,omitempty"`
+	Extensions json.RawMessage   `json:"extensions,omitempty"`
+}
+
+// writePartialResponse merges root field responses in order, response of the first root field
+// failed to be resolved will be written as is.
+func writePartialResponse(w http.ResponseWriter, writers []*cachingResponseWriter) error {
+	var hasData, nullData bool
+	results := make([]cachingPartialResult, len(writers))
+
+	for i, rw := range writers {
+		mt, _, _ := mime.ParseMediaType(rw.Header().Get("content-type"))
+
+		if (rw.Status() != http.StatusOK && rw.Status() != 0) || mt != "application/json" {
+			return rw.WriteResponse(w)
+		}
+
+		if err := json.Unmarshal(rw.buffer.Bytes(), &results[i]); err != nil {
+			return rw.WriteResponse(w)
+		}
+
+		if len(results[i].Data) > 0 {
+			hasData = true
+			nullData = nullData || bytes.Equal(bytes.TrimSpace(results[i].Data), []byte("null"))
+		}
+	}
+
+	body := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(body)
+	body.Reset()
+	body.WriteByte('{')
+
+	if hasData {
+		body.WriteString(`"data":`)
+
+		if nullData {
+			body.WriteString("null")
+		} else {
+			writePartialData(body, results)
+		}
+	}
+
+	var errs []json.RawMessage
+
+errorsLoop:
+	for _, result := range results {
+		for _, e := range result.Errors {
+			// errors without path are shared by all root fields.
+			for _, existing := range errs {
+				if bytes.Equal(existing, e) {
+					continue errorsLoop
+				}
+			}
+
+			errs = append(errs, e)
+		}
+	}
+
+	if len(errs) > 0 {
+		if hasData {
+			body.WriteByte(',')
+		}
+
+		rawErrors, _ := json.Marshal(errs) // nolint:errchkjson
+		body.WriteString(`"errors":`)
+		body.Write(rawErrors)
+	}
+
+	body.WriteByte('}')
+
+	for _, rw := range writers {
+		mergeResponseHeader(w.Header(), rw.Header())
+	}
+
+	// per root field headers are meaningless for merged response.
+	w.Header().Del("age")
+	w.Header().Del("cache-control")
+	w.Header().Del("content-length")
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(body.Bytes())
+
+	return err
+}
+
+func writePartialData(body *bytes.Buffer, results []cachingPartialResult) {
+	first := true
+	body.WriteByte('{')
+
+	for _, result := range results {
+		data := bytes.TrimSpace(result.Data)
+
+		// trim braces of root field data object to concat them in order.
+		if len(data) < 2 || data[0] != '{' {
+			continue
+		}
+
+		fields := bytes.TrimSpace(data[1 : len(data)-1])
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if !first {
+			body.WriteByte(',')
+		}
+
+		body.Write(fields)
+		first = false
+	}
+
+	body.WriteByte('}')
+}
+
+// cachingPartialUpstream collect root fields of partial query need to forward to upstream and forward them
+// as single operation when all root fields had been resolved (forwarding or served by cache).
+type cachingPartialUpstream struct {
+	mu       sync.Mutex
+	query    *cachingPartialQuery
+	upstream caddyhttp.HandlerFunc
+	pending  int
+	flushed  bool
+	resolved []bool
+	waiters  []*cachingPartialUpstreamWaiter
+}
+
+type cachingPartialUpstreamWaiter struct {
+	index int
+	w     http.ResponseWriter
+	done  chan error
+}
+
+func newCachingPartialUpstream(q *cachingPartialQuery, upstream caddyhttp.HandlerFunc) *cachingPartialUpstream {
+	return &cachingPartialUpstream{
+		query:    q,
+		upstream: upstream,
+		pending:  len(q.fields),
+		resolved: make([]bool, len(q.fields)),
+	}
+}
+
+func (p *cachingPartialUpstream) handlerFor(i int) caddyhttp.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		p.mu.Lock()
+
+		// forward directly in cases root field already resolved like swr in background.
+		if p.flushed || p.resolved[i] {
+			p.mu.Unlock()
+
+			return p.upstream(w, r)
+		}
+
+		waiter := &cachingPartialUpstreamWaiter{
+			index: i,
+			w:     w,
+			done:  make(chan error, 1),
+		}
+		p.waiters = append(p.waiters, waiter)
+		p.resolve(i)
+		p.mu.Unlock()
+
+		return <-waiter.done
+	}
+}
+
+// release mark root field resolved without forwarding to upstream.
+func (p *cachingPartialUpstream) release(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.resolve(i)
+}
+
+func (p *cachingPartialUpstream) resolve(i int) {
+	if p.resolved[i] {
+		return
+	}
+
+	p.resolved[i] = true
+	p.pending--
+
+	if p.pending > 0 {
+		return
+	}
+
+	p.flushed = true
+
+	if len(p.waiters) > 0 {
+		go p.flush(p.waiters)
+
+		return
+	}
+
+	// whole operation served without forwarding, it should not block batch request contains it.
+	if release, ok := p.query.request.httpRequest.Context().Value(upstreamWaitCtxKey).(func()); ok {
+		release()
+	}
+}
+
+func (p *cachingPartialUpstream) flush(waiters []*cachingPartialUpstreamWaiter) {
+	sort.Slice(waiters, func(i, j int) bool {
+		return waiters[i].index < waiters[j].index
+	})
+
+	indexes := make([]int, len(waiters))
+
+	for i, waiter := range waiters {
+		indexes[i] = waiter.index
+	}
+
+	gqlRequest, err := p.query.gqlRequest(indexes...)
+	if err != nil {
+		p.fail(waiters, err)
+
+		return
+	}
+
+	rawBody, err := p.query.body(gqlRequest)
+	if err != nil {
+		p.fail(waiters, err)
+
+		return
+	}
+
+	buff := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buff)
+	buff.Reset()
+
+	original := p.query.request.httpRequest
+	rw := newCachingResponseWriter(buff)
+	r := prepareHTTPRequest(original.Context(), original, rw)
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(rawBody))
+	r.ContentLength = int64(len(rawBody))
+	r.Header.Set("content-length", strconv.Itoa(len(rawBody)))
+
+	if err = p.upstream(rw, r); err != nil {
+		p.fail(waiters, err)
+
+		return
+	}
+
+	bodies := p.split(rw, waiters)
+
+	for i, waiter := range waiters {
+		for name, values := range rw.Header().Clone() {
+			waiter.w.Header()[name] = values
+		}
+
+		waiter.w.Header().Del("content-length")
+		waiter.w.WriteHeader(rw.Status())
+		_, err = waiter.w.Write(bodies[i])
+		waiter.done <- err
+	}
+}
+
+// split splits upstream response by root fields of waiters, all of them will get the same response
+// when upstream response is not successful.
+func (p *cachingPartialUpstream) split(rw *cachingResponseWriter, waiters []*cachingPartialUpstreamWaiter) [][]byte {
+	var result cachingPartialResult
+	var data map[string]json.RawMessage
+	bodies := make([][]byte, len(waiters))
+	mt, _, _ := mime.ParseMediaType(rw.Header().Get("content-type"))
+
+	if rw.Status() != http.StatusOK || mt != "application/json" ||
+		json.Unmarshal(rw.buffer.Bytes(), &result) != nil ||
+		json.Unmarshal(result.Data, &data) != nil && len(result.Data) > 0 {
+		for i := range bodies {
+			bodies[i] = rw.buffer.Bytes()
+		}
+
+		return bodies
+	}
+
+	for i, waiter := range waiters {
+		field := p.query.fields[waiter.index]
+		fieldResult := cachingPartialResult{
+			Data:       result.Data,
+			Extensions: result.Extensions,
+		}
+
+		if data != nil {
+			value, ok := data[field]
+
+			if !ok {
+				value = json.RawMessage("null")
+			}
+
+			fieldResult.Data, _ = json.Marshal(map[string]json.RawMessage{field: value}) // nolint:errchkjson
+		}
+
+		for _, e := range result.Errors {
+			var gqlError struct {
+				Path []json.RawMessage `json:"path"`
+			}
+
+			_ = json.Unmarshal(e, &gqlError)
+
+			if len(gqlError.Path) > 0 {
+				var root string
+
+				if json.Unmarshal(gqlError.Path[0], &root) == nil && root != field {
+					continue
+				}
+			}
+
+			fieldResult.Errors = append(fieldResult.Errors, e)
+		}
+
+		bodies[i], _ = json.Marshal(fieldResult) // nolint:errchkjson
+	}
+
+	return bodies
+}
+
+func (p *cachingPartialUpstream) fail(waiters []*cachingPartialUpstreamWaiter, err error) {
+	for _, waiter := range waiters {
+		waiter.done <- err
+	}
+}
@@ -0,0 +1,210 @@
+package gbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jensneuse/graphql-go-tools/pkg/astparser"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCachingPartialRequest(t *testing.T, query string) *cachingRequest {
+	t.Helper()
+
+	s, err := graphql.NewSchemaFromString(`
+type Query {
+	posts(first: Int): [Post!]!
+	me: User
+}
+
+type Post {
+	title: String!
+}
+
+type User {
+	name: String!
+}
+`)
+	require.NoError(t, err)
+	s.Normalize()
+	_, err = s.Hash() // schema hash computed lazily, compute it before handling root fields concurrently.
+	require.NoError(t, err)
+
+	d, _ := astparser.ParseGraphqlDocumentBytes(s.Document())
+	r, _ := http.NewRequest("POST", "http://localhost:9090/graphql", nil)
+	r = r.WithContext(context.WithValue(r.Context(), caddyhttp.ServerCtxKey, new(caddyhttp.Server)))
+	gqlRequest := &graphql.Request{
+		OperationName: "Dashboard",
+		Query:         query,
+		Variables:     json.RawMessage(`{"first": 2}`),
+	}
+	require.NoError(t, normalizeGraphqlRequest(s, gqlRequest))
+
+	return newCachingRequest(r, &d, s, gqlRequest)
+}
+
+func TestNewCachingPartialQuery(t *testing.T) {
+	q, err := newCachingPartialQuery(newTestCachingPartialRequest(t, `query Dashboard($first: Int) { posts(first: $first) { title } viewer: me { name } }`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"posts", "viewer"}, q.fields)
+	require.Len(t, q.requests, 2)
+	require.Contains(t, q.requests[0].Query, "posts")
+	require.NotContains(t, q.requests[0].Query, "viewer")
+	require.JSONEq(t, `{"first": 2}`, string(q.requests[0].Variables))
+	require.Contains(t, q.requests[1].Query, "viewer: me")
+	require.NotContains(t, q.requests[1].Query, "$first")
+	require.JSONEq(t, `{}`, string(q.requests[1].Variables))
+
+	_, err = newCachingPartialQuery(newTestCachingPartialRequest(t, `query Dashboard { posts { title } }`))
+	require.ErrorIs(t, err, errCachingPartialQueryUnsplittable)
+}
+
+func TestCaching_HandlePartialQueryRequest(t *testing.T) {
+	var mu sync.Mutex
+	var forwardedQueries []string
+	upstream := func(w http.ResponseWriter, r *http.Request) error {
+		gqlRequest := new(graphql.Request)
+		body, _ := ioutil.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(body, gqlRequest))
+
+		mu.Lock()
+		forwardedQueries = append(forwardedQueries, gqlRequest.Query)
+		mu.Unlock()
+
+		var fields []string
+
+		if strings.Contains(gqlRequest.Query, "posts") {
+			fields = append(fields, `"posts":[{"title":"A"}]`)
+		}
+
+		if strings.Contains(gqlRequest.Query, "me") {
+			fields = append(fields, `"me":null`)
+		}
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"data":{` + strings.Join(fields, ",") + `},"errors":[{"message":"unauthorized","path":["me"]}]}`))
+
+		return err
+	}
+	c := newTestCaching(t, CachingRules{
+		"posts": &CachingRule{
+			Types:  graphql.RequestTypes{"Post": {}},
+			MaxAge: caddy.Duration(3600000000000),
+		},
+	})
+	c.PartialCaching = true
+	query := `query Dashboard { posts { title } me { name } }`
+
+	w := httptest.NewRecorder()
+	require.NoError(t, c.HandleRequest(w, newTestCachingPartialRequest(t, query), upstream))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, []string{"MISS", "PASS"}, w.Header().Values("x-cache"))
+	require.JSONEq(t, `{"data":{"posts":[{"title":"A"}],"me":null},"errors":[{"message":"unauthorized","path":["me"]}]}`, w.Body.String())
+	require.Len(t, forwardedQueries, 1, "root fields missing cache should be forwarded as single operation")
+	require.Contains(t, forwardedQueries[0], "posts")
+	require.Contains(t, forwardedQueries[0], "me")
+
+	w = httptest.NewRecorder()
+	require.NoError(t, c.HandleRequest(w, newTestCachingPartialRequest(t, query), upstream))
+	require.Equal(t, []string{"HIT", "PASS"}, w.Header().Values("x-cache"))
+	require.JSONEq(t, `{"data":{"posts":[{"title":"A"}],"me":null},"errors":[{"message":"unauthorized","path":["me"]}]}`, w.Body.String())
+	require.Empty(t, w.Header().Get("cache-control"))
+	require.Len(t, forwardedQueries, 2)
+	require.NotContains(t, forwardedQueries[1], "posts", "cached root fields should not be forwarded")
+}
+
+func TestCaching_HandlePartialQueryRequestExtensions(t *testing.T) {
+	var forwarded []map[string]json.RawMessage
+	upstream := func(w http.ResponseWriter, r *http.Request) error {
+		body := struct {
+			Extensions map[string]json.RawMessage `json:"extensions"`
+		}{}
+		data, _ := ioutil.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(data, &body))
+
+		forwarded = append(forwarded, body.Extensions)
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"data":{"posts":[{"title":"A"}],"me":null}}`))
+
+		return err
+	}
+	c := newTestCaching(t, nil)
+	c.PartialCaching = true
+	r := newTestCachingPartialRequest(t, `query Dashboard { posts { title } me { name } }`)
+	r.httpRequest.Body = ioutil.NopCloser(strings.NewReader(`{"extensions": {"tenant": "1", "persistedQuery": {"version": 1, "sha256Hash": "test"}}}`))
+
+	w := httptest.NewRecorder()
+	require.NoError(t, c.HandleRequest(w, r, upstream))
+	require.Len(t, forwarded, 1)
+	require.JSONEq(t, `"1"`, string(forwarded[0]["tenant"]), "extensions should be forwarded with root fields")
+	require.NotContains(t, forwarded[0], "persistedQuery", "persisted query hash does not match query of root fields")
+}
+
+func TestWritePartialResponse(t *testing.T) {
+	newWriter := func(status int, body string) *cachingResponseWriter {
+		rw := newCachingResponseWriter(bytes.NewBufferString(body))
+		rw.Header().Set("content-type", "application/json")
+		rw.WriteHeader(status)
+
+		return rw
+	}
+
+	w := httptest.NewRecorder()
+	require.NoError(t, writePartialResponse(w, []*cachingResponseWriter{
+		newWriter(http.StatusOK, `{"data":{"a":1}}`),
+		newWriter(http.StatusOK, `{"data":null,"errors":[{"message":"b"}]}`),
+	}))
+	require.Equal(t, `{"data":null,"errors":[{"message":"b"}]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	require.NoError(t, writePartialResponse(w, []*cachingResponseWriter{
+		newWriter(http.StatusOK, `{"data":{"a":1}}`),
+		newWriter(http.StatusBadGateway, `bad gateway`),
+	}))
+	require.Equal(t, http.StatusBadGateway, w.Code)
+	require.Equal(t, `bad gateway`, w.Body.String())
+}
+
+func TestCaching_HandlePartialQueryRequestInlineArguments(t *testing.T) {
+	upstream := func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"data":{"posts":[{"title":"A"}],"me":null}}`))
+
+		return err
+	}
+	c := newTestCaching(t, CachingRules{
+		"posts": &CachingRule{
+			Types:     graphql.RequestTypes{"Post": {}},
+			MaxAge:    caddy.Duration(3600000000000),
+			Variables: []string{"first"},
+		},
+	})
+	c.PartialCaching = true
+
+	for _, query := range []string{
+		`query Dashboard { posts(first: 1) { title } me { name } }`,
+		`query Dashboard { posts(first: 2) { title } me { name } }`,
+	} {
+		w := httptest.NewRecorder()
+		require.NoError(t, c.HandleRequest(w, newTestCachingPartialRequest(t, query), upstream))
+		require.Equalf(t, []string{"MISS", "PASS"}, w.Header().Values("x-cache"), "inline arguments should be part of cache key: %s", query)
+	}
+
+	w := httptest.NewRecorder()
+	require.NoError(t, c.HandleRequest(w, newTestCachingPartialRequest(t, `query Dashboard { posts(first: 1) { title } me { name } }`), upstream))
+	require.Equal(t, []string{"HIT", "PASS"}, w.Header().Values("x-cache"))
+}
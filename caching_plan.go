@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"sort"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/eko/gocache/v2/store"
@@ -22,13 +24,17 @@ var (
 )
 
 type cachingPlan struct {
-	MaxAge      caddy.Duration
-	Swr         caddy.Duration
-	VaryNames   []string
-	Types       map[string]struct{}
-	RulesHash   uint64
-	VariesHash  uint64
-	Passthrough bool
+	MaxAge           caddy.Duration
+	Swr              caddy.Duration
+	StaleIfError     caddy.Duration
+	VaryNames        []string
+	IgnoredVariables []string
+	Extensions       []string
+	Types            map[string]struct{}
+	RulesHash        uint64
+	VariesHash       uint64
+	HintsHash        uint64
+	Passthrough      bool
 
 	queryResultCacheKey string
 }
@@ -51,7 +57,15 @@ func newCachingPlanner(r *cachingRequest, c *Caching) (*cachingPlanner, error) {
 
 	hash.Write([]byte(fmt.Sprintf("schema=%d; ", schemaHash)))
 
+	// rules may match request headers, so plans depend on their values.
+	for _, name := range c.Rules.requestHeaders() {
+		values, _ := json.Marshal(r.httpRequest.Header.Values(name)) // nolint:errchkjson
+		hash.Write([]byte(fmt.Sprintf("header:%s=%s; ", name, values)))
+	}
+
+	// variables are not part of plan, they will be used to compute query result cache key by rules matched.
 	gqlRequestClone := *r.gqlRequest
+	gqlRequestClone.Variables = nil
 	documentBuffer := bufferPool.Get().(*bytes.Buffer)
 	defer bufferPool.Put(documentBuffer)
 	documentBuffer.Reset()
@@ -101,9 +115,14 @@ func (p *cachingPlanner) getPlan() (plan *cachingPlan, err error) {
 		var queryResultCacheKey string
 		queryResultCacheKey, err = p.calcQueryResultCacheKey(plan)
 
-		if err == nil {
+		switch {
+		case err == nil:
 			plan.queryResultCacheKey = queryResultCacheKey
-		} else {
+		case errors.Is(err, ErrCachingVaryInvalidToken):
+			// query results of requests with invalid token should not be cached.
+			plan.Passthrough = true
+			err = nil
+		default:
 			plan = nil
 		}
 	}()
@@ -145,6 +164,10 @@ func (p *cachingPlanner) getCached() (*cachingPlan, error) {
 		return nil, errors.New("invalid checksum varies")
 	}
 
+	if _, hintsHash := p.caching.getSchemaHints(); hintsHash != cachedPlan.HintsHash {
+		return nil, errors.New("invalid checksum schema hints")
+	}
+
 	return cachedPlan, nil
 }
 
@@ -178,11 +201,22 @@ func (p *cachingPlanner) computePlan() (*cachingPlan, error) {
 	extractor := graphql.NewExtractor()
 	extractor.ExtractFieldsFromRequest(p.request.gqlRequest, p.request.schema, &operationreport.Report{}, requestFieldTypes)
 
+	var matchedRules []*CachingRule
+	var pass bool
+
 	for _, rule := range p.caching.Rules {
 		if !p.matchRule(requestFieldTypes, rule) {
 			continue
 		}
 
+		if rule.Action == CachingRuleActionPass {
+			pass = true
+
+			continue
+		}
+
+		matchedRules = append(matchedRules, rule)
+
 		if plan.MaxAge == 0 || plan.MaxAge > rule.MaxAge {
 			plan.MaxAge = rule.MaxAge
 		}
@@ -191,6 +225,10 @@ func (p *cachingPlanner) computePlan() (*cachingPlan, error) {
 			plan.Swr = rule.Swr
 		}
 
+		if plan.StaleIfError == 0 || (plan.StaleIfError > rule.StaleIfError && rule.StaleIfError > 0) {
+			plan.StaleIfError = rule.StaleIfError
+		}
+
 		varyNames = append(varyNames, rule.Varies...)
 
 		if rule.Types == nil {
@@ -206,11 +244,35 @@ func (p *cachingPlanner) computePlan() (*cachingPlan, error) {
 
 	plan.VaryNames = varyNames
 	plan.Types = types
+	plan.Extensions = p.matchedExtensions(matchedRules)
+
+	if plan.IgnoredVariables, err = p.ignoredVariables(matchedRules); err != nil {
+		return nil, err
+	}
+
+	hints, hintsHash := p.caching.getSchemaHints()
+	plan.HintsHash = hintsHash
+
+	if pass {
+		plan.Passthrough = true
+	}
+
+	if !plan.Passthrough {
+		var cacheable bool
+
+		if plan.MaxAge, cacheable = hints.hintFor(requestFieldTypes).apply(plan.MaxAge); !cacheable {
+			plan.Passthrough = true
+		}
+	}
 
 	return plan, nil
 }
 
 func (p *cachingPlanner) matchRule(requestTypes graphql.RequestTypes, rule *CachingRule) bool {
+	if !rule.matchRequest(p.request.gqlRequest.OperationName, p.request.httpRequest.Header) {
+		return false
+	}
+
 mainLoop:
 	for name, fields := range rule.Types {
 		compareFields, typeExist := requestTypes[name]
@@ -231,6 +293,120 @@ mainLoop:
 	return rule.Types == nil
 }
 
+// ignoredVariables returns names of variables declared by client operation but not used by any rule matched,
+// variables extracted from inline arguments are always kept.
+func (p *cachingPlanner) ignoredVariables(rules []*CachingRule) ([]string, error) {
+	var restricted bool
+
+	for _, rule := range rules {
+		if !rule.restrictVariables() {
+			return nil, nil
+		}
+
+		restricted = true
+	}
+
+	if !restricted {
+		return nil, nil
+	}
+
+	if err := p.request.initDeclaredVariables(); err != nil {
+		return nil, err
+	}
+
+	var ignored []string
+
+mainLoop:
+	for _, name := range p.request.declaredVariables {
+		for _, rule := range rules {
+			if rule.includeVariable(name) {
+				continue mainLoop
+			}
+		}
+
+		ignored = append(ignored, name)
+	}
+
+	return ignored, nil
+}
+
+// matchedExtensions returns sorted unique extensions keys of rules matched.
+func (p *cachingPlanner) matchedExtensions(rules []*CachingRule) []string {
+	var extensions []string
+	seen := make(map[string]struct{})
+
+	for _, rule := range rules {
+		for _, key := range rule.Extensions {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+
+			seen[key] = struct{}{}
+			extensions = append(extensions, key)
+		}
+	}
+
+	sort.Strings(extensions)
+
+	return extensions
+}
+
+// writeVariables writes variables of request to hash given, except variables ignored by plan.
+func (p *cachingPlanner) writeVariables(hash io.Writer, plan *cachingPlan) error {
+	variables := make(map[string]json.RawMessage)
+
+	if len(p.request.gqlRequest.Variables) > 0 {
+		if err := json.Unmarshal(p.request.gqlRequest.Variables, &variables); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range plan.IgnoredVariables {
+		delete(variables, name)
+	}
+
+	// map keys are sorted by encoder, so the same variables always have the same hash.
+	data, err := json.Marshal(variables)
+	if err != nil {
+		return err
+	}
+
+	_, err = hash.Write([]byte(fmt.Sprintf("variables:%s;", data)))
+
+	return err
+}
+
+// writeExtensions writes extensions values of request specified by plan to hash given.
+func (p *cachingPlanner) writeExtensions(hash io.Writer, plan *cachingPlan) error {
+	if len(plan.Extensions) == 0 {
+		return nil
+	}
+
+	if err := p.request.initExtensions(); err != nil {
+		return err
+	}
+
+	for _, key := range plan.Extensions {
+		var value []byte
+
+		if raw, ok := p.request.extensions[key]; ok {
+			buff := new(bytes.Buffer)
+
+			if err := json.Compact(buff, raw); err != nil {
+				return err
+			}
+
+			value = buff.Bytes()
+		}
+
+		if _, err := hash.Write([]byte(fmt.Sprintf("extension:%s=%s;", key, value))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (p *cachingPlanner) calcQueryResultCacheKey(plan *cachingPlan) (string, error) {
 	hash := pool.Hash64.Get()
 	defer pool.Hash64.Put(hash)
@@ -238,13 +414,21 @@ func (p *cachingPlanner) calcQueryResultCacheKey(plan *cachingPlan) (string, err
 
 	hash.Write([]byte(fmt.Sprintf("%s;", p.cacheKey)))
 
+	if err := p.writeVariables(hash, plan); err != nil {
+		return "", err
+	}
+
+	if err := p.writeExtensions(hash, plan); err != nil {
+		return "", err
+	}
+
 	r := p.request.httpRequest
 
 	for _, name := range plan.VaryNames {
 		vary, ok := p.caching.Varies[name]
 
 		if !ok {
-			return "", fmt.Errorf("setting of vary %s does not exist in varies list given", vary)
+			return "", fmt.Errorf("setting of vary %s does not exist in varies list given", name)
 		}
 
 		for _, name := range vary.Headers {
@@ -269,6 +453,23 @@ func (p *cachingPlanner) calcQueryResultCacheKey(plan *cachingPlan) (string, err
 				return "", err
 			}
 		}
+
+		if vary.Claims == nil {
+			continue
+		}
+
+		values, err := vary.Claims.values(r)
+		if err != nil {
+			return "", err
+		}
+
+		for i, name := range vary.Claims.Names {
+			buffString := fmt.Sprintf("claim:%s=%s;", name, values[i])
+
+			if _, err := hash.Write([]byte(buffString)); err != nil {
+				return "", err
+			}
+		}
 	}
 
 	return fmt.Sprintf(cachingQueryResultKeyPattern, hash.Sum64()), nil
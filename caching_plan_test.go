@@ -1,6 +1,8 @@
 package gbox
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
@@ -72,3 +74,92 @@ type User {
 
 	return cr
 }
+
+func newTestCachingVariablesRequest(t *testing.T, variables, extensions string) *cachingRequest {
+	t.Helper()
+
+	s, err := graphql.NewSchemaFromString(`
+type Query {
+	users(first: Int, trackingId: String): [User!]!
+}
+
+type User {
+	name: String!
+}
+`)
+	require.NoError(t, err)
+	s.Normalize()
+
+	d, _ := astparser.ParseGraphqlDocumentBytes(s.Document())
+	query := `query GetUsers($first: Int, $trackingId: String) { users(first: $first, trackingId: $trackingId) { name } }`
+	body := fmt.Sprintf(`{"query": %q, "variables": %s, "extensions": %s}`, query, variables, extensions)
+	r, _ := http.NewRequest("POST", "http://localhost:9090/graphql", strings.NewReader(body))
+	gqlRequest := &graphql.Request{
+		Query:     query,
+		Variables: json.RawMessage(variables),
+	}
+	require.NoError(t, normalizeGraphqlRequest(s, gqlRequest))
+
+	return newCachingRequest(r, &d, s, gqlRequest)
+}
+
+func TestCachingPlanQueryResultCacheKeyVariablesAndExtensions(t *testing.T) {
+	testCases := map[string]struct {
+		rule      *CachingRule
+		a, b      [2]string
+		sameCache bool
+	}{
+		"all variables": {
+			rule:      &CachingRule{MaxAge: 1},
+			a:         [2]string{`{"first": 1, "trackingId": "a"}`, `{}`},
+			b:         [2]string{`{"first": 1, "trackingId": "b"}`, `{}`},
+			sameCache: false,
+		},
+		"ignore variables": {
+			rule:      &CachingRule{MaxAge: 1, IgnoreVariables: []string{"trackingId"}},
+			a:         [2]string{`{"first": 1, "trackingId": "a"}`, `{}`},
+			b:         [2]string{`{"first": 1, "trackingId": "b"}`, `{}`},
+			sameCache: true,
+		},
+		"ignore variables different used variables": {
+			rule:      &CachingRule{MaxAge: 1, IgnoreVariables: []string{"trackingId"}},
+			a:         [2]string{`{"first": 1, "trackingId": "a"}`, `{}`},
+			b:         [2]string{`{"first": 2, "trackingId": "a"}`, `{}`},
+			sameCache: false,
+		},
+		"variables subset": {
+			rule:      &CachingRule{MaxAge: 1, Variables: []string{"first"}},
+			a:         [2]string{`{"first": 1, "trackingId": "a"}`, `{}`},
+			b:         [2]string{`{"first": 1}`, `{}`},
+			sameCache: true,
+		},
+		"extensions": {
+			rule:      &CachingRule{MaxAge: 1, Extensions: []string{"locale"}},
+			a:         [2]string{`{"first": 1}`, `{"locale": "en", "trace": 1}`},
+			b:         [2]string{`{"first": 1}`, `{"locale":"vi", "trace": 1}`},
+			sameCache: false,
+		},
+		"other extensions": {
+			rule:      &CachingRule{MaxAge: 1, Extensions: []string{"locale"}},
+			a:         [2]string{`{"first": 1}`, `{"locale": "en", "trace": 1}`},
+			b:         [2]string{`{"first": 1}`, `{"locale":"en", "trace": 2}`},
+			sameCache: true,
+		},
+	}
+
+	for name, testCase := range testCases {
+		c := newTestCaching(t, CachingRules{"default": testCase.rule})
+
+		a, err := c.getCachingPlan(newTestCachingVariablesRequest(t, testCase.a[0], testCase.a[1]))
+		require.NoErrorf(t, err, "case %s", name)
+
+		b, err := c.getCachingPlan(newTestCachingVariablesRequest(t, testCase.b[0], testCase.b[1]))
+		require.NoErrorf(t, err, "case %s", name)
+
+		if testCase.sameCache {
+			require.Equalf(t, a.queryResultCacheKey, b.queryResultCacheKey, "case %s", name)
+		} else {
+			require.NotEqualf(t, a.queryResultCacheKey, b.queryResultCacheKey, "case %s", name)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/eko/gocache/v2/store"
 	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
@@ -11,43 +12,55 @@ import (
 	"go.uber.org/zap"
 )
 
-func (c *Caching) PurgeQueryResultBySchema(ctx context.Context, schema *graphql.Schema) error {
+func (c *Caching) PurgeQueryResultBySchema(ctx context.Context, schema *graphql.Schema, soft bool) error {
 	hash, _ := schema.Hash()
 	tag := fmt.Sprintf(cachingTagSchemaHashPattern, hash)
 
-	return c.purgeQueryResultByTags(ctx, []string{tag})
+	return c.purgeQueryResultByTagsWithMode(ctx, []string{tag}, soft)
 }
 
-func (c *Caching) PurgeQueryResultByOperationName(ctx context.Context, name string) error {
-	return c.purgeQueryResultByTags(ctx, []string{fmt.Sprintf(cachingTagOperationPattern, name)})
+func (c *Caching) PurgeQueryResultByOperationName(ctx context.Context, name string, soft bool) error {
+	return c.purgeQueryResultByTagsWithMode(ctx, []string{fmt.Sprintf(cachingTagOperationPattern, name)}, soft)
 }
 
-func (c *Caching) PurgeQueryResultByTypeName(ctx context.Context, name string) error {
-	return c.purgeQueryResultByTags(ctx, []string{fmt.Sprintf(cachingTagTypePattern, name)})
+func (c *Caching) PurgeQueryResultByTypeName(ctx context.Context, name string, soft bool) error {
+	return c.purgeQueryResultByTagsWithMode(ctx, []string{fmt.Sprintf(cachingTagTypePattern, name)}, soft)
 }
 
-func (c *Caching) PurgeQueryResultByTypeField(ctx context.Context, typeName, fieldName string) error {
-	return c.purgeQueryResultByTags(ctx, []string{fmt.Sprintf(cachingTagTypeFieldPattern, typeName, fieldName)})
+func (c *Caching) PurgeQueryResultByTypeField(ctx context.Context, typeName, fieldName string, soft bool) error {
+	return c.purgeQueryResultByTagsWithMode(ctx, []string{fmt.Sprintf(cachingTagTypeFieldPattern, typeName, fieldName)}, soft)
 }
 
-func (c *Caching) PurgeQueryResultByTypeKey(ctx context.Context, typeName, fieldName string, value interface{}) error {
+func (c *Caching) PurgeQueryResultByTypeKey(ctx context.Context, typeName, fieldName string, value interface{}, soft bool) error {
 	var cacheKey string
 
 	switch v := value.(type) {
 	case string:
 		cacheKey = fmt.Sprintf(cachingTagTypeKeyPattern, typeName, fieldName, v)
 
-		return c.purgeQueryResultByTags(ctx, []string{cacheKey})
+		return c.purgeQueryResultByTagsWithMode(ctx, []string{cacheKey}, soft)
 	case int:
 		cacheKey = fmt.Sprintf(cachingTagTypeKeyPattern, typeName, fieldName, strconv.Itoa(v))
 
-		return c.purgeQueryResultByTags(ctx, []string{cacheKey})
+		return c.purgeQueryResultByTagsWithMode(ctx, []string{cacheKey}, soft)
 	default:
 
 		return fmt.Errorf("only support purging type key value int or string, got %T", v)
 	}
 }
 
+// purgeQueryResultByTagsWithMode backs Purge* methods, query results will be deleted by default, when soft is true
+// they will be marked as stale instead, so they will still be served while fresh data is being fetched in the
+// background (swr), this prevents thundering herd at upstream when purging hot query results. Query results of rules
+// without swr will be treated as missing cache after soft purged, use hard purge for correctness-critical invalidations.
+func (c *Caching) purgeQueryResultByTagsWithMode(ctx context.Context, tags []string, soft bool) error {
+	if soft {
+		return c.softPurgeQueryResultByTags(ctx, tags)
+	}
+
+	return c.purgeQueryResultByTags(ctx, tags)
+}
+
 func (c *Caching) purgeQueryResultByTags(ctx context.Context, tags []string) error {
 	var err error
 
@@ -67,3 +80,43 @@ func (c *Caching) purgeQueryResultByTags(ctx context.Context, tags []string) err
 
 	return err
 }
+
+// softPurgeQueryResultByTags marks query results have tags given as stale by recording purged time of tags,
+// query results created before purged time of any of their tags will be treated as stale.
+func (c *Caching) softPurgeQueryResultByTags(ctx context.Context, tags []string) error {
+	c.logger.Debug("soft purging query result by tags", zap.Strings("tags", tags))
+	purgedAt := time.Now().UnixNano()
+	c.softPurges.add(tags, purgedAt)
+
+	return c.publishSoftPurge(ctx, tags, purgedAt)
+}
+
+// softPurgedAt returns the earliest soft purged time of tags of query result given after it was created,
+// it will be zero if query result had not been soft purged.
+func (c *Caching) softPurgedAt(r *cachingQueryResult) time.Time {
+	staledAt := c.softPurges.purgedAt(r.Tags, r.CreatedAt.UnixNano())
+
+	if staledAt == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, staledAt)
+}
+
+// maxQueryResultExpiration returns the longest expiration of query results by rules and errors policy,
+// soft purged tags must be kept at least as long as it.
+func (c *Caching) maxQueryResultExpiration() time.Duration {
+	var expiration time.Duration
+
+	for _, rule := range c.Rules {
+		if e := time.Duration(rule.MaxAge) + time.Duration(rule.Swr) + time.Duration(rule.StaleIfError); e > expiration {
+			expiration = e
+		}
+	}
+
+	if c.Errors != nil && time.Duration(c.Errors.NegativeMaxAge) > expiration {
+		expiration = time.Duration(c.Errors.NegativeMaxAge)
+	}
+
+	return expiration
+}
@@ -3,9 +3,17 @@ package gbox
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/coocood/freecache"
+	"github.com/eko/gocache/v2/marshaler"
 	"github.com/eko/gocache/v2/store"
 	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
 	"github.com/stretchr/testify/require"
@@ -31,7 +39,7 @@ func TestCaching_PurgeQueryResultByOperationName(t *testing.T) {
 	_, err = c.store.Get(context.Background(), "test", v)
 
 	require.NoError(t, err)
-	require.NoError(t, c.PurgeQueryResultByOperationName(context.Background(), "test"))
+	require.NoError(t, c.PurgeQueryResultByOperationName(context.Background(), "test", false))
 
 	_, err = c.store.Get(context.Background(), "test", v)
 	require.Error(t, err)
@@ -63,7 +71,7 @@ type Query {
 	_, err = c.store.Get(context.Background(), "test", v)
 
 	require.NoError(t, err)
-	require.NoError(t, c.PurgeQueryResultBySchema(context.Background(), schema))
+	require.NoError(t, c.PurgeQueryResultBySchema(context.Background(), schema, false))
 
 	_, err = c.store.Get(context.Background(), "test", v)
 	require.Error(t, err)
@@ -88,7 +96,7 @@ func TestCaching_PurgeQueryResultByTypeKey(t *testing.T) {
 	_, err = c.store.Get(context.Background(), "test", v)
 
 	require.NoError(t, err)
-	require.NoError(t, c.PurgeQueryResultByTypeKey(context.Background(), "a", "b", "c"))
+	require.NoError(t, c.PurgeQueryResultByTypeKey(context.Background(), "a", "b", "c", false))
 
 	_, err = c.store.Get(context.Background(), "test", v)
 	require.Error(t, err)
@@ -113,7 +121,7 @@ func TestCaching_PurgeQueryResultByTypeField(t *testing.T) {
 	_, err = c.store.Get(context.Background(), "test", v)
 
 	require.NoError(t, err)
-	require.NoError(t, c.PurgeQueryResultByTypeField(context.Background(), "a", "b"))
+	require.NoError(t, c.PurgeQueryResultByTypeField(context.Background(), "a", "b", false))
 
 	_, err = c.store.Get(context.Background(), "test", v)
 	require.Error(t, err)
@@ -138,8 +146,187 @@ func TestCaching_PurgeQueryResultByTypeName(t *testing.T) {
 	_, err = c.store.Get(context.Background(), "test", v)
 
 	require.NoError(t, err)
-	require.NoError(t, c.PurgeQueryResultByTypeName(context.Background(), "a"))
+	require.NoError(t, c.PurgeQueryResultByTypeName(context.Background(), "a", false))
 
 	_, err = c.store.Get(context.Background(), "test", v)
 	require.Error(t, err)
 }
+
+func TestCaching_SoftPurgeQueryResult(t *testing.T) {
+	var upstreamCalls int32
+	upstream := func(w http.ResponseWriter, r *http.Request) error {
+		atomic.AddInt32(&upstreamCalls, 1)
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"data": {"users": [{"name": "A"}]}}`))
+
+		return err
+	}
+
+	testCases := map[string]struct {
+		swr            time.Duration
+		expectedStatus CachingStatus
+		expectedCalls  int32
+	}{
+		"served by swr": {
+			swr:            time.Hour,
+			expectedStatus: CachingStatusHit,
+			expectedCalls:  2,
+		},
+		"miss without swr": {
+			expectedStatus: CachingStatusMiss,
+			expectedCalls:  2,
+		},
+	}
+
+	for name, testCase := range testCases {
+		atomic.StoreInt32(&upstreamCalls, 0)
+		c := newTestCaching(t, CachingRules{
+			"default": &CachingRule{
+				MaxAge: caddy.Duration(time.Hour),
+				Swr:    caddy.Duration(testCase.swr),
+			},
+		})
+
+		w := httptest.NewRecorder()
+		require.NoErrorf(t, c.handleQueryRequest(w, newTestCachingRequest(), upstream), "case %s", name)
+		require.Equalf(t, string(CachingStatusMiss), w.Header().Get("x-cache"), "case %s", name)
+
+		w = httptest.NewRecorder()
+		require.NoErrorf(t, c.handleQueryRequest(w, newTestCachingRequest(), upstream), "case %s", name)
+		require.Equalf(t, string(CachingStatusHit), w.Header().Get("x-cache"), "case %s", name)
+
+		require.NoErrorf(t, c.PurgeQueryResultByTypeName(context.Background(), "User", true), "case %s", name)
+
+		plan, err := c.getCachingPlan(newTestCachingRequest())
+		require.NoErrorf(t, err, "case %s", name)
+
+		result, err := c.getCachingQueryResult(context.Background(), plan)
+		require.NoErrorf(t, err, "case %s: query result should not be deleted by soft purge", name)
+		require.Equalf(t, CachingQueryResultStale, result.Status(), "case %s", name)
+
+		// swr needs caddy server to prepare background request.
+		r := newTestCachingRequest()
+		r.httpRequest = r.httpRequest.WithContext(context.WithValue(r.httpRequest.Context(), caddyhttp.ServerCtxKey, new(caddyhttp.Server)))
+		w = httptest.NewRecorder()
+		require.NoErrorf(t, c.handleQueryRequest(w, r, upstream), "case %s", name)
+		require.Equalf(t, string(testCase.expectedStatus), w.Header().Get("x-cache"), "case %s", name)
+		require.Eventuallyf(t, func() bool {
+			return atomic.LoadInt32(&upstreamCalls) == testCase.expectedCalls
+		}, time.Second, time.Millisecond*10, "case %s: query result should be refreshed", name)
+
+		require.Eventuallyf(t, func() bool {
+			result, err = c.getCachingQueryResult(context.Background(), plan)
+
+			return err == nil && result.Status() == CachingQueryResultValid
+		}, time.Second, time.Millisecond*10, "case %s: refreshed query result should be valid", name)
+	}
+}
+
+type testCountingCachingStore struct {
+	store.StoreInterface
+	gets map[interface{}]int
+}
+
+func (s *testCountingCachingStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
+	s.gets[key]++
+
+	return s.StoreInterface.Get(ctx, key)
+}
+
+func TestCaching_SoftPurgeQueryResultHitWithoutStoreLookup(t *testing.T) {
+	upstream := func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"data": {"users": [{"name": "A"}]}}`))
+
+		return err
+	}
+	c := newTestCaching(t, CachingRules{
+		"default": &CachingRule{
+			MaxAge: caddy.Duration(time.Hour),
+		},
+	})
+	counting := &testCountingCachingStore{
+		StoreInterface: store.NewFreecache(freecache.NewCache(1000000), nil),
+		gets:           make(map[interface{}]int),
+	}
+	c.store = &CachingStore{Marshaler: marshaler.New(counting)}
+
+	w := httptest.NewRecorder()
+	require.NoError(t, c.handleQueryRequest(w, newTestCachingRequest(), upstream))
+	require.Equal(t, string(CachingStatusMiss), w.Header().Get("x-cache"))
+	require.NoError(t, c.PurgeQueryResultByTypeName(context.Background(), "Book", true))
+
+	// hit times are seeded from store on first hit.
+	w = httptest.NewRecorder()
+	require.NoError(t, c.handleQueryRequest(w, newTestCachingRequest(), upstream))
+
+	for key := range counting.gets {
+		delete(counting.gets, key)
+	}
+
+	w = httptest.NewRecorder()
+	require.NoError(t, c.handleQueryRequest(w, newTestCachingRequest(), upstream))
+	require.Equal(t, string(CachingStatusHit), w.Header().Get("x-cache"))
+	require.Zero(t, counting.gets[cachingSoftPurgesSequenceKey], "soft purged tags should not be looked up on hit")
+	require.Len(t, counting.gets, 2, "only caching plan and query result should be looked up on hit")
+}
+
+func TestCaching_SyncSoftPurges(t *testing.T) {
+	u, _ := url.Parse("freecache://?cache_size=1000000")
+	s, _ := NewCachingStore(u)
+	rules := CachingRules{
+		"default": &CachingRule{
+			MaxAge: caddy.Duration(time.Hour),
+		},
+	}
+	c1 := &Caching{Rules: rules, store: s, logger: zap.NewNop()}
+	c2 := &Caching{Rules: rules, store: s, logger: zap.NewNop()}
+	result := &cachingQueryResult{
+		CreatedAt: time.Now(),
+		Tags:      cachingTags{"t:User": struct{}{}},
+	}
+
+	require.NoError(t, c1.softPurgeQueryResultByTags(context.Background(), []string{"t:User"}))
+	require.False(t, c1.softPurgedAt(result).IsZero())
+	require.True(t, c2.softPurgedAt(result).IsZero(), "soft purged tags of other instances should be seen after synced")
+
+	require.NoError(t, c2.syncSoftPurges(context.Background()))
+	require.False(t, c2.softPurgedAt(result).IsZero())
+
+	require.NoError(t, c2.softPurgeQueryResultByTags(context.Background(), []string{"t:Book"}))
+	require.NoError(t, c1.syncSoftPurges(context.Background()))
+	require.False(t, c1.softPurgedAt(&cachingQueryResult{Tags: cachingTags{"t:Book": struct{}{}}}).IsZero())
+
+	c3 := &Caching{Rules: rules, store: s, logger: zap.NewNop()}
+	require.NoError(t, c3.syncSoftPurges(context.Background()))
+	require.False(t, c3.softPurgedAt(result).IsZero(), "soft purges published before first sync should be seen")
+	require.Equal(t, uint64(2), c3.softPurges.synced)
+
+	// soft purge is being published by other instance.
+	seq, err := s.increment(context.Background(), cachingSoftPurgesSequenceKey, 1, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, c3.syncSoftPurges(context.Background()))
+	require.Contains(t, c3.softPurges.missing, seq)
+
+	purge := &cachingSoftPurge{Tags: []string{"t:Post"}, PurgedAt: time.Now().UnixNano()}
+	require.NoError(t, s.Set(context.Background(), fmt.Sprintf(cachingSoftPurgeKeyPattern, seq), purge, nil))
+	require.NoError(t, c3.syncSoftPurges(context.Background()))
+	require.NotContains(t, c3.softPurges.missing, seq)
+	require.False(t, c3.softPurgedAt(&cachingQueryResult{Tags: cachingTags{"t:Post": struct{}{}}}).IsZero())
+}
+
+func TestCaching_SyncSoftPurgesPruneExpiredTags(t *testing.T) {
+	c := newTestCaching(t, CachingRules{
+		"default": &CachingRule{
+			MaxAge: caddy.Duration(time.Hour),
+		},
+	})
+	c.softPurges.add([]string{"t:User"}, time.Now().Add(-2*time.Hour).UnixNano())
+	c.softPurges.add([]string{"t:Book"}, time.Now().UnixNano())
+
+	require.NoError(t, c.syncSoftPurges(context.Background()))
+	require.NotContains(t, c.softPurges.tags, "t:User", "tags purged before query results expired should be dropped")
+	require.Contains(t, c.softPurges.tags, "t:Book")
+}
@@ -1,6 +1,9 @@
 package gbox
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 
 	"github.com/jensneuse/graphql-go-tools/pkg/ast"
@@ -16,6 +19,9 @@ type cachingRequest struct {
 	gqlRequest            *graphql.Request
 	definition, operation *ast.Document
 	cacheControl          *cacheobject.RequestCacheDirectives
+	acceptEncoding        string
+	extensions            map[string]json.RawMessage
+	declaredVariables     []string
 }
 
 func newCachingRequest(r *http.Request, d *ast.Document, s *graphql.Schema, gr *graphql.Request) *cachingRequest {
@@ -28,6 +34,7 @@ func newCachingRequest(r *http.Request, d *ast.Document, s *graphql.Schema, gr *
 
 	cacheControlString := r.Header.Get("cache-control")
 	cr.cacheControl, _ = cacheobject.ParseRequestCacheControl(cacheControlString)
+	cr.acceptEncoding = r.Header.Get("accept-encoding")
 
 	return cr
 }
@@ -64,3 +71,63 @@ func (r *cachingRequest) initOperation() error {
 
 	return nil
 }
+
+// initDeclaredVariables loads names of variables declared by client operation, variables extracted from inline
+// arguments by normalization are not included.
+func (r *cachingRequest) initDeclaredVariables() error {
+	if r.declaredVariables != nil {
+		return nil
+	}
+
+	operation, report := astparser.ParseGraphqlDocumentString(r.gqlRequest.Query)
+
+	if report.HasErrors() {
+		return &report
+	}
+
+	r.declaredVariables = make([]string, 0)
+	ref, ok := partialOperationDefinitionRef(&operation, r.gqlRequest.OperationName)
+
+	if !ok {
+		return nil
+	}
+
+	for _, i := range operation.OperationDefinitions[ref].VariableDefinitions.Refs {
+		r.declaredVariables = append(r.declaredVariables, operation.VariableDefinitionNameString(i))
+	}
+
+	return nil
+}
+
+// initExtensions loads extensions of GraphQL request from http request body, body will be restored after read.
+func (r *cachingRequest) initExtensions() error {
+	if r.extensions != nil {
+		return nil
+	}
+
+	r.extensions = make(map[string]json.RawMessage)
+
+	if r.httpRequest.Body == nil {
+		return nil
+	}
+
+	rawBody, err := ioutil.ReadAll(r.httpRequest.Body)
+	if err != nil {
+		return err
+	}
+
+	r.httpRequest.Body = ioutil.NopCloser(bytes.NewBuffer(rawBody))
+	body := struct {
+		Extensions map[string]json.RawMessage `json:"extensions"`
+	}{}
+
+	if err = json.Unmarshal(rawBody, &body); err != nil {
+		return err
+	}
+
+	if body.Extensions != nil {
+		r.extensions = body.Extensions
+	}
+
+	return nil
+}
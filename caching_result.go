@@ -4,11 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/eko/gocache/v2/store"
 	"github.com/pquerna/cachecontrol/cacheobject"
+	"go.uber.org/zap"
 )
 
 const (
@@ -19,16 +22,21 @@ const (
 type cachingQueryResultStatus string
 
 type cachingQueryResult struct {
-	Header     http.Header
-	Body       json.RawMessage
-	HitTime    uint64
-	CreatedAt  time.Time
-	Expiration time.Duration
-	MaxAge     caddy.Duration
-	Swr        caddy.Duration
-	Tags       cachingTags
+	Header       http.Header
+	Body         json.RawMessage
+	Encoding     string
+	HitTime      uint64
+	CreatedAt    time.Time
+	Expiration   time.Duration
+	MaxAge       caddy.Duration
+	Swr          caddy.Duration
+	StaleIfError caddy.Duration
+	Tags         cachingTags
 
 	plan *cachingPlan
+
+	// staledAt is soft purged time of query result, it will be zero if query result had not been soft purged.
+	staledAt time.Time
 }
 
 func (c *Caching) getCachingQueryResult(ctx context.Context, plan *cachingPlan) (*cachingQueryResult, error) {
@@ -40,10 +48,27 @@ func (c *Caching) getCachingQueryResult(ctx context.Context, plan *cachingPlan)
 		return nil, err
 	}
 
+	result.staledAt = c.softPurgedAt(result)
+
 	return result, nil
 }
 
 func (c *Caching) cachingQueryResult(ctx context.Context, request *cachingRequest, plan *cachingPlan, body []byte, header http.Header) (err error) {
+	maxAge, cacheable := newResponseCachingHint(header, body).apply(plan.MaxAge)
+
+	if cacheable {
+		maxAge, cacheable = c.Errors.apply(body, maxAge)
+	}
+
+	if !cacheable {
+		c.logger.Debug("query result should not be cached by upstream hints or errors policy", zap.String("cache_key", plan.queryResultCacheKey))
+
+		// delete stale query result in case it is being revalidated.
+		c.store.Delete(ctx, plan.queryResultCacheKey) // nolint:errcheck
+
+		return nil
+	}
+
 	tags := make(cachingTags)
 	tagAnalyzer := newCachingTagAnalyzer(request, c.TypeKeys)
 
@@ -51,34 +76,39 @@ func (c *Caching) cachingQueryResult(ctx context.Context, request *cachingReques
 		return err
 	}
 
+	compressed, encoding, err := c.Compression.compress(body)
+	if err != nil {
+		return err
+	}
+
 	result := &cachingQueryResult{
-		Body:       body,
-		Header:     header,
-		CreatedAt:  time.Now(),
-		MaxAge:     plan.MaxAge,
-		Swr:        plan.Swr,
-		Tags:       tags,
-		Expiration: time.Duration(plan.MaxAge) + time.Duration(plan.Swr),
+		Body:         compressed,
+		Encoding:     encoding,
+		Header:       header,
+		CreatedAt:    time.Now(),
+		MaxAge:       maxAge,
+		Swr:          plan.Swr,
+		StaleIfError: plan.StaleIfError,
+		Tags:         tags,
+		Expiration:   time.Duration(maxAge) + time.Duration(plan.Swr) + time.Duration(plan.StaleIfError),
 	}
 
 	result.normalizeHeader()
 
-	return c.store.Set(ctx, plan.queryResultCacheKey, result, &store.Options{
+	if err = c.store.Set(ctx, plan.queryResultCacheKey, result, &store.Options{
 		Tags:       tags.ToSlice(),
 		Expiration: result.Expiration,
-	})
-}
+	}); err != nil {
+		return err
+	}
 
-func (c *Caching) increaseQueryResultHitTimes(ctx context.Context, r *cachingQueryResult) error {
-	r.HitTime++
+	c.resetQueryResultHitTimes(plan.queryResultCacheKey)
 
-	return c.store.Set(ctx, r.plan.queryResultCacheKey, r, &store.Options{
-		Expiration: r.Expiration - time.Since(r.CreatedAt),
-	})
+	return nil
 }
 
 func (r *cachingQueryResult) Status() cachingQueryResultStatus {
-	if time.Duration(r.MaxAge) >= r.Age() {
+	if r.staledAt.IsZero() && time.Duration(r.MaxAge) >= r.Age() {
 		return CachingQueryResultValid
 	}
 
@@ -141,6 +171,45 @@ func (r *cachingQueryResult) ValidFor(cc *cacheobject.RequestCacheDirectives) bo
 	return true
 }
 
+// Revalidatable check caching result can be served while fresh data is being fetched in the background.
+func (r *cachingQueryResult) Revalidatable() bool {
+	// soft purged query result can be served in swr duration since it was purged.
+	if !r.staledAt.IsZero() && time.Duration(r.Swr) < time.Since(r.staledAt) {
+		return false
+	}
+
+	return time.Duration(r.MaxAge)+time.Duration(r.Swr) >= r.Age()
+}
+
+// ValidIfError check caching result can be served when upstream fails with cache control directives
+// https://datatracker.ietf.org/doc/html/rfc5861#section-4
+func (r *cachingQueryResult) ValidIfError(cc *cacheobject.RequestCacheDirectives) bool {
+	age := r.Age()
+
+	if r.StaleIfError <= 0 || time.Duration(r.MaxAge)+time.Duration(r.Swr)+time.Duration(r.StaleIfError) < age {
+		return false
+	}
+
+	if cc == nil {
+		return true
+	}
+
+	for _, extension := range cc.Extensions {
+		if !strings.HasPrefix(extension, "stale-if-error=") {
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(strings.TrimPrefix(extension, "stale-if-error="), 10, 64)
+		if err != nil {
+			return false
+		}
+
+		return time.Duration(r.MaxAge)+time.Duration(seconds)*time.Second >= age
+	}
+
+	return true
+}
+
 func (r *cachingQueryResult) Age() time.Duration {
 	return time.Since(r.CreatedAt)
 }
@@ -2,13 +2,37 @@ package gbox
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
 	"github.com/jensneuse/graphql-go-tools/pkg/pool"
 )
 
+const (
+	// CachingRuleActionCache caches query results match the rule, it is default action.
+	CachingRuleActionCache = "cache"
+
+	// CachingRuleActionPass never caches query results match the rule even if other rules match.
+	CachingRuleActionPass = "pass"
+
+	cachingClientNameHeader    = "apollographql-client-name"
+	cachingClientVersionHeader = "apollographql-client-version"
+)
+
+// cachingPatternRegexps holds compiled regular expression patterns of rules.
+var cachingPatternRegexps sync.Map
+
 type CachingRule struct {
+	// Action of the rule, it can be `cache` or `pass`, `cache` by default.
+	Action string `json:"action,omitempty"`
+
 	// GraphQL type to cache
 	// ex: `User` will cache all query results have type User
 	// ex: `User { is_admin }` will cache all query results have type User and have field `is_admin`.
@@ -21,13 +45,191 @@ type CachingRule struct {
 	// how long stale query results that match the rule types should be served while fresh data is already being fetched in the background.
 	Swr caddy.Duration `json:"swr,omitempty"`
 
+	// how long stale query results that match the rule types should be kept beyond max age and swr,
+	// and served when upstream fails (5xx status or timeout).
+	StaleIfError caddy.Duration `json:"stale_if_error,omitempty"`
+
 	// Varies name apply to query results that match the rule types.
 	// If not set query results will cache public.
 	Varies []string `json:"varies,omitempty"`
+
+	// Variables names for identifier query result cache key, other variables will be ignored.
+	// If not set all variables will be used.
+	Variables []string `json:"variables,omitempty"`
+
+	// Variables names should be ignored for identifier query result cache key, ex: tracking ids, client timestamps.
+	IgnoreVariables []string `json:"ignore_variables,omitempty"`
+
+	// Request extensions keys for identifier query result cache key.
+	Extensions []string `json:"extensions,omitempty"`
+
+	// Operation names patterns to match, glob pattern or regular expression wrapped in slashes,
+	// ex: `Get*`, `/^List(Users|Books)$/`. If not set this rule will match all operations.
+	OperationNames []string `json:"operation_names,omitempty"`
+
+	// Operation names patterns to exclude from the rule.
+	ExcludeOperationNames []string `json:"exclude_operation_names,omitempty"`
+
+	// Request headers to match, map key is header name and value is patterns of header value,
+	// header must be present if patterns is empty.
+	Headers map[string][]string `json:"headers,omitempty"`
+
+	// Request headers to exclude from the rule, header value patterns same as headers.
+	ExcludeHeaders map[string][]string `json:"exclude_headers,omitempty"`
+
+	// Client names patterns to match, client name is value of `apollographql-client-name` header.
+	ClientNames []string `json:"client_names,omitempty"`
+
+	// Client versions patterns to match, client version is value of `apollographql-client-version` header.
+	ClientVersions []string `json:"client_versions,omitempty"`
+}
+
+func (r *CachingRule) validate() error {
+	switch r.Action {
+	case "", CachingRuleActionCache, CachingRuleActionPass:
+	default:
+		return fmt.Errorf("action %s is not supported", r.Action)
+	}
+
+	if r.Action != CachingRuleActionPass && r.MaxAge <= 0 {
+		return fmt.Errorf("max age must greater than zero")
+	}
+
+	var patterns []string
+	patterns = append(patterns, r.OperationNames...)
+	patterns = append(patterns, r.ExcludeOperationNames...)
+	patterns = append(patterns, r.ClientNames...)
+	patterns = append(patterns, r.ClientVersions...)
+
+	for _, headers := range []map[string][]string{r.Headers, r.ExcludeHeaders} {
+		for _, values := range headers {
+			patterns = append(patterns, values...)
+		}
+	}
+
+	for _, pattern := range patterns {
+		var err error
+
+		if isCachingRegexpPattern(pattern) {
+			_, err = compileCachingPattern(pattern)
+		} else {
+			_, err = path.Match(pattern, "")
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// matchRequest reports whether operation name, headers and client of request given match the rule.
+func (r *CachingRule) matchRequest(operationName string, header http.Header) bool {
+	if len(r.OperationNames) > 0 && !matchCachingPatterns(r.OperationNames, operationName) {
+		return false
+	}
+
+	if matchCachingPatterns(r.ExcludeOperationNames, operationName) {
+		return false
+	}
+
+	for name, patterns := range r.Headers {
+		if !matchCachingHeader(header, name, patterns) {
+			return false
+		}
+	}
+
+	for name, patterns := range r.ExcludeHeaders {
+		if matchCachingHeader(header, name, patterns) {
+			return false
+		}
+	}
+
+	if len(r.ClientNames) > 0 && !matchCachingPatterns(r.ClientNames, header.Get(cachingClientNameHeader)) {
+		return false
+	}
+
+	if len(r.ClientVersions) > 0 && !matchCachingPatterns(r.ClientVersions, header.Get(cachingClientVersionHeader)) {
+		return false
+	}
+
+	return true
+}
+
+// requestHeaders returns names of headers using to match the rule.
+func (r *CachingRule) requestHeaders() []string {
+	var names []string
+
+	for _, headers := range []map[string][]string{r.Headers, r.ExcludeHeaders} {
+		for name := range headers {
+			names = append(names, name)
+		}
+	}
+
+	if len(r.ClientNames) > 0 {
+		names = append(names, cachingClientNameHeader)
+	}
+
+	if len(r.ClientVersions) > 0 {
+		names = append(names, cachingClientVersionHeader)
+	}
+
+	return names
+}
+
+// restrictVariables reports whether the rule ignores some variables for identifier query result cache key.
+func (r *CachingRule) restrictVariables() bool {
+	return len(r.Variables) > 0 || len(r.IgnoreVariables) > 0
+}
+
+// includeVariable reports whether the variable given should be used for identifier query result cache key.
+func (r *CachingRule) includeVariable(name string) bool {
+	for _, v := range r.IgnoreVariables {
+		if v == name {
+			return false
+		}
+	}
+
+	if len(r.Variables) == 0 {
+		return true
+	}
+
+	for _, v := range r.Variables {
+		if v == name {
+			return true
+		}
+	}
+
+	return false
 }
 
 type CachingRules map[string]*CachingRule
 
+// requestHeaders returns sorted canonical names of headers using to match rules,
+// caching plans depend on them.
+func (rules CachingRules) requestHeaders() []string {
+	var names []string
+	seen := make(map[string]struct{})
+
+	for _, rule := range rules {
+		for _, name := range rule.requestHeaders() {
+			name = http.CanonicalHeaderKey(name)
+
+			if _, ok := seen[name]; ok {
+				continue
+			}
+
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
 func (rules CachingRules) hash() (uint64, error) {
 	if rules == nil {
 		return 0, nil
@@ -43,3 +245,63 @@ func (rules CachingRules) hash() (uint64, error) {
 
 	return hash.Sum64(), nil
 }
+
+// isCachingRegexpPattern reports whether pattern given is regular expression wrapped in slashes.
+func isCachingRegexpPattern(pattern string) bool {
+	return len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+func compileCachingPattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := cachingPatternRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	cachingPatternRegexps.Store(pattern, re)
+
+	return re, nil
+}
+
+// matchCachingPatterns reports whether value given match any of glob or regular expression patterns.
+func matchCachingPatterns(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if !isCachingRegexpPattern(pattern) {
+			if matched, _ := path.Match(pattern, value); matched {
+				return true
+			}
+
+			continue
+		}
+
+		if re, err := compileCachingPattern(pattern); err == nil && re.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchCachingHeader reports whether header given is present and its value match patterns if any.
+func matchCachingHeader(header http.Header, name string, patterns []string) bool {
+	values := header.Values(name)
+
+	if len(values) == 0 {
+		return false
+	}
+
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, value := range values {
+		if matchCachingPatterns(patterns, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,6 +1,7 @@
 package gbox
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -25,3 +26,104 @@ func TestCachingRulesHash(t *testing.T) {
 	require.NoError(t, err)
 	require.Greater(t, hash, uint64(0))
 }
+
+func TestCachingRule_MatchRequest(t *testing.T) {
+	testCases := map[string]struct {
+		rule          *CachingRule
+		operationName string
+		header        http.Header
+		expected      bool
+	}{
+		"no conditions": {
+			rule:          &CachingRule{},
+			operationName: "GetUsers",
+			expected:      true,
+		},
+		"operation name glob": {
+			rule:          &CachingRule{OperationNames: []string{"Get*"}},
+			operationName: "GetUsers",
+			expected:      true,
+		},
+		"operation name regexp": {
+			rule:          &CachingRule{OperationNames: []string{"/^List(Users|Books)$/"}},
+			operationName: "ListBooks",
+			expected:      true,
+		},
+		"operation name not match": {
+			rule:          &CachingRule{OperationNames: []string{"Get*", "/^List/"}},
+			operationName: "SearchUsers",
+			expected:      false,
+		},
+		"excluded operation name": {
+			rule:          &CachingRule{OperationNames: []string{"Get*"}, ExcludeOperationNames: []string{"GetMe"}},
+			operationName: "GetMe",
+			expected:      false,
+		},
+		"header presence": {
+			rule:     &CachingRule{Headers: map[string][]string{"x-preview": nil}},
+			header:   http.Header{"X-Preview": {"false"}},
+			expected: true,
+		},
+		"header missing": {
+			rule:     &CachingRule{Headers: map[string][]string{"x-preview": nil}},
+			header:   http.Header{},
+			expected: false,
+		},
+		"header value": {
+			rule:     &CachingRule{Headers: map[string][]string{"x-preview": {"true"}}},
+			header:   http.Header{"X-Preview": {"false"}},
+			expected: false,
+		},
+		"excluded header": {
+			rule:     &CachingRule{ExcludeHeaders: map[string][]string{"x-debug": nil}},
+			header:   http.Header{"X-Debug": {"1"}},
+			expected: false,
+		},
+		"client name and version": {
+			rule:     &CachingRule{ClientNames: []string{"web"}, ClientVersions: []string{"1.*"}},
+			header:   http.Header{"Apollographql-Client-Name": {"web"}, "Apollographql-Client-Version": {"1.2.0"}},
+			expected: true,
+		},
+		"client version not match": {
+			rule:     &CachingRule{ClientNames: []string{"web"}, ClientVersions: []string{"1.*"}},
+			header:   http.Header{"Apollographql-Client-Name": {"web"}, "Apollographql-Client-Version": {"2.0.0"}},
+			expected: false,
+		},
+	}
+
+	for name, testCase := range testCases {
+		header := testCase.header
+
+		if header == nil {
+			header = http.Header{}
+		}
+
+		require.Equalf(t, testCase.expected, testCase.rule.matchRequest(testCase.operationName, header), "case %s", name)
+	}
+}
+
+func TestCachingPlanPassRule(t *testing.T) {
+	c := newTestCaching(t, CachingRules{
+		"default": &CachingRule{
+			MaxAge: 1,
+		},
+		"preview": &CachingRule{
+			Action:  CachingRuleActionPass,
+			Headers: map[string][]string{"x-preview": {"true"}},
+		},
+	})
+
+	plan, err := c.getCachingPlan(newTestCachingRequest())
+	require.NoError(t, err)
+	require.False(t, plan.Passthrough)
+
+	r := newTestCachingRequest()
+	r.httpRequest.Header.Set("x-preview", "true")
+	plan, err = c.getCachingPlan(r)
+	require.NoError(t, err)
+	require.True(t, plan.Passthrough, "pass rule should take precedence over other rules")
+
+	plan, err = c.getCachingPlan(newTestCachingRequest())
+	require.NoError(t, err)
+	require.False(t, plan.Passthrough, "plans should depend on headers matched by rules")
+}
@@ -0,0 +1,209 @@
+package gbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eko/gocache/v2/store"
+	"go.uber.org/zap"
+)
+
+const (
+	cachingSoftPurgesSequenceKey  = "gbox_csp_seq"
+	cachingSoftPurgeKeyPattern    = "gbox_csp:%d"
+	cachingSoftPurgesSyncInterval = time.Second
+	cachingSoftPurgesSyncRetries  = 3
+)
+
+// cachingSoftPurge is soft purge shared with instances via store, each soft purge is stored under its own sequence
+// number and expires with query results it affected, so instances only look up soft purges they have not synced yet.
+type cachingSoftPurge struct {
+	Tags     []string `json:"tags"`
+	PurgedAt int64    `json:"purged_at"`
+}
+
+// cachingSoftPurges keeps soft purged time of tags in memory, so query results hit will not look up store,
+// they are synced periodically with soft purges of instances sharing store.
+type cachingSoftPurges struct {
+	mu     sync.RWMutex
+	latest int64
+	tags   map[string]int64
+
+	// syncMu guards sync state below, syncs by interval and by soft purge may run concurrently.
+	syncMu      sync.Mutex
+	initialized bool
+	synced      uint64
+	missing     map[uint64]int
+}
+
+// add records soft purged time of tags given.
+func (p *cachingSoftPurges) add(tags []string, purgedAt int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.tags == nil {
+		p.tags = make(map[string]int64)
+	}
+
+	for _, tag := range tags {
+		if purgedAt > p.tags[tag] {
+			p.tags[tag] = purgedAt
+		}
+	}
+
+	if purgedAt > p.latest {
+		p.latest = purgedAt
+	}
+}
+
+// prune drops tags purged before time given, query results created before it had been expired.
+func (p *cachingSoftPurges) prune(expiredBefore int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.latest = 0
+
+	for tag, purgedAt := range p.tags {
+		if purgedAt < expiredBefore {
+			delete(p.tags, tag)
+
+			continue
+		}
+
+		if purgedAt > p.latest {
+			p.latest = purgedAt
+		}
+	}
+}
+
+// purgedAt returns the earliest soft purged time of tags given after time given, it will be zero if not found.
+func (p *cachingSoftPurges) purgedAt(tags cachingTags, after int64) int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var earliest int64
+
+	// skip looking up tags of query results created after latest soft purged time.
+	if p.latest <= after {
+		return 0
+	}
+
+	for tag := range tags {
+		if purgedAt := p.tags[tag]; purgedAt > after && (earliest == 0 || purgedAt < earliest) {
+			earliest = purgedAt
+		}
+	}
+
+	return earliest
+}
+
+// publishSoftPurge stores soft purge of tags given under next sequence number, instances sharing store
+// will pick it up on their next sync.
+func (c *Caching) publishSoftPurge(ctx context.Context, tags []string, purgedAt int64) error {
+	expiration := c.maxQueryResultExpiration()
+
+	if expiration <= 0 {
+		return nil
+	}
+
+	seq, err := c.store.increment(ctx, cachingSoftPurgesSequenceKey, 1, expiration)
+	if err != nil {
+		return err
+	}
+
+	purge := &cachingSoftPurge{Tags: tags, PurgedAt: purgedAt}
+
+	return c.store.Set(ctx, fmt.Sprintf(cachingSoftPurgeKeyPattern, seq), purge, &store.Options{Expiration: expiration})
+}
+
+// loadSoftPurge merges soft purge stored under sequence number given, reports whether it exists.
+func (c *Caching) loadSoftPurge(ctx context.Context, seq uint64) bool {
+	purge := new(cachingSoftPurge)
+
+	if _, err := c.store.Get(ctx, fmt.Sprintf(cachingSoftPurgeKeyPattern, seq), purge); err != nil {
+		return false
+	}
+
+	c.softPurges.add(purge.Tags, purge.PurgedAt)
+
+	return true
+}
+
+// syncSoftPurges merges soft purges published after the last one synced and drops expired tags in memory.
+// On first sync, soft purges are looked up backward until an expired one. Soft purges missing may be still writing
+// by their instances, they will be looked up again on next syncs.
+func (c *Caching) syncSoftPurges(ctx context.Context) error {
+	expiration := c.maxQueryResultExpiration()
+
+	if expiration <= 0 {
+		return nil
+	}
+
+	p := &c.softPurges
+	p.syncMu.Lock()
+	defer p.syncMu.Unlock()
+
+	latest, err := c.store.increment(ctx, cachingSoftPurgesSequenceKey, 0, expiration)
+	if err != nil {
+		return err
+	}
+
+	if !p.initialized {
+		p.initialized = true
+		p.synced = latest
+
+		for seq := latest; seq > 0; seq-- {
+			if !c.loadSoftPurge(ctx, seq) {
+				break
+			}
+		}
+	}
+
+	if p.missing == nil {
+		p.missing = make(map[uint64]int)
+	}
+
+	for seq, retries := range p.missing {
+		if c.loadSoftPurge(ctx, seq) || retries >= cachingSoftPurgesSyncRetries {
+			delete(p.missing, seq)
+
+			continue
+		}
+
+		p.missing[seq]++
+	}
+
+	// sequence had been expired and started again.
+	if latest < p.synced {
+		p.synced = 0
+	}
+
+	for seq := p.synced + 1; seq <= latest; seq++ {
+		if !c.loadSoftPurge(ctx, seq) {
+			p.missing[seq] = 1
+		}
+	}
+
+	p.synced = latest
+	p.prune(time.Now().Add(-expiration).UnixNano())
+
+	return nil
+}
+
+func (c *Caching) runSoftPurgesSyncer(ctx context.Context) {
+	ticker := time.NewTicker(cachingSoftPurgesSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.syncSoftPurges(ctx); err != nil {
+				c.logger.Error("sync soft purged tags failed", zap.Error(err))
+			}
+		}
+	}
+}
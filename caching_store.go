@@ -1,11 +1,13 @@
 package gbox
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/coocood/freecache"
 	"github.com/eko/gocache/v2/marshaler"
@@ -21,15 +23,42 @@ var (
 func init() { // nolint:gochecknoinits
 	RegisterCachingStoreFactory("redis", RedisCachingStoreFactory)
 	RegisterCachingStoreFactory("freecache", FreeCacheStoreFactory)
+	RegisterCachingStoreFactory("memory", MemoryCachingStoreFactory)
+	RegisterCachingStoreFactory("tiered", TieredCachingStoreFactory)
+	RegisterCachingStoreFactory("bbolt", BoltCachingStoreFactory)
 }
 
 type CachingStore struct {
 	*marshaler.Marshaler
 	close func() error
+
+	// incrementFunc increases counter atomically, stores not supporting it increase counters by get and set
+	// guarded by incrementMu, it is safe since their data are not shared between processes.
+	incrementFunc func(ctx context.Context, key string, delta uint64, ttl time.Duration) (uint64, error)
+	incrementMu   sync.Mutex
 }
 
 type CachingStoreFactory = func(u *url.URL) (*CachingStore, error)
 
+// increment adds delta given to counter of key and returns new value of it.
+func (s *CachingStore) increment(ctx context.Context, key string, delta uint64, ttl time.Duration) (uint64, error) {
+	if s.incrementFunc != nil {
+		return s.incrementFunc(ctx, key, delta, ttl)
+	}
+
+	s.incrementMu.Lock()
+	defer s.incrementMu.Unlock()
+
+	var value uint64
+
+	// counter key may not exist, it is safe to ignore error.
+	s.Get(ctx, key, &value) // nolint:errcheck
+
+	value += delta
+
+	return value, s.Set(ctx, key, value, &store.Options{Expiration: ttl})
+}
+
 func RegisterCachingStoreFactory(schema string, factory CachingStoreFactory) {
 	cachingStoreFactoriesMu.Lock()
 	defer cachingStoreFactoriesMu.Unlock()
@@ -76,6 +105,38 @@ func FreeCacheStoreFactory(u *url.URL) (*CachingStore, error) {
 }
 
 func RedisCachingStoreFactory(u *url.URL) (*CachingStore, error) {
+	client, err := newRedisClient(u)
+	if err != nil {
+		return nil, err
+	}
+
+	redisStore := store.NewRedis(client, nil)
+
+	return &CachingStore{
+		Marshaler: marshaler.New(redisStore),
+		close: func() error {
+			return client.Close()
+		},
+		incrementFunc: redisIncrementFunc(client),
+	}, nil
+}
+
+// redisIncrementFunc increases counters by INCRBY, so instances sharing Redis will not overwrite each other.
+func redisIncrementFunc(client *redis.Client) func(ctx context.Context, key string, delta uint64, ttl time.Duration) (uint64, error) {
+	return func(ctx context.Context, key string, delta uint64, ttl time.Duration) (uint64, error) {
+		pipe := client.TxPipeline()
+		value := pipe.IncrBy(ctx, key, int64(delta))
+		pipe.Expire(ctx, key, ttl)
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, err
+		}
+
+		return uint64(value.Val()), nil
+	}
+}
+
+func newRedisClient(u *url.URL) (*redis.Client, error) {
 	q := u.Query()
 	opts := &redis.Options{
 		Addr: u.Host,
@@ -100,13 +161,5 @@ func RedisCachingStoreFactory(u *url.URL) (*CachingStore, error) {
 		opts.Password = password
 	}
 
-	client := redis.NewClient(opts)
-	redisStore := store.NewRedis(client, nil)
-
-	return &CachingStore{
-		Marshaler: marshaler.New(redisStore),
-		close: func() error {
-			return client.Close()
-		},
-	}, nil
+	return redis.NewClient(opts), nil
 }
@@ -0,0 +1,473 @@
+package gbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/eko/gocache/v2/marshaler"
+	"github.com/eko/gocache/v2/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	boltCachingStoreType = "bbolt"
+
+	defaultBoltCachingStoreCleanupInterval = time.Minute
+
+	// boltEntryHeaderSize is size of entry header contains write sequence and expiration time.
+	boltEntryHeaderSize = 16
+)
+
+var (
+	boltEntriesBucket   = []byte("entries")
+	boltOrderBucket     = []byte("order")
+	boltTagsBucket      = []byte("tags")
+	boltEntryTagsBucket = []byte("entry_tags")
+	boltMetaBucket      = []byte("meta")
+	boltSizeKey         = []byte("size")
+
+	ErrBoltCachingStoreNotFound = errors.New("key not found in bbolt caching store")
+)
+
+// boltCachingStore is file-backed store survives restarts, entries are evicted in least recently written order
+// when total size of keys and values exceeds max size.
+type boltCachingStore struct {
+	db      *bolt.DB
+	maxSize uint64
+}
+
+// BoltCachingStoreFactory creates file-backed store, DSN example:
+// bbolt:///var/lib/gbox/caching.db?max_size=104857600&cleanup_interval=1m
+// max_size is max total size of keys and values in bytes, unlimited if not set,
+// cleanup_interval is interval of deleting expired entries, 1m by default.
+func BoltCachingStoreFactory(u *url.URL) (*CachingStore, error) {
+	q := u.Query()
+	path := u.Path
+	cleanupInterval := defaultBoltCachingStoreCleanupInterval
+	s := new(boltCachingStore)
+
+	if path == "" {
+		return nil, errors.New("bbolt database file path must be set explicit")
+	}
+
+	if v := q.Get("max_size"); v != "" {
+		maxSize, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("`max_size` param should be numeric string, %s given", v)
+		}
+
+		s.maxSize = maxSize
+	}
+
+	if v := q.Get("cleanup_interval"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("`cleanup_interval` param should be positive duration string, %s given", v)
+		}
+
+		cleanupInterval = interval
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	s.db = db
+
+	if err = db.Update(s.createBuckets); err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	done := make(chan struct{})
+
+	go s.cleanup(cleanupInterval, done)
+
+	return &CachingStore{
+		Marshaler: marshaler.New(s),
+		close: func() error {
+			close(done)
+
+			return db.Close()
+		},
+	}, nil
+}
+
+func (s *boltCachingStore) createBuckets(tx *bolt.Tx) error {
+	for _, name := range [][]byte{boltEntriesBucket, boltOrderBucket, boltTagsBucket, boltEntryTagsBucket, boltMetaBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cleanup deletes expired entries periodically until done channel closed.
+func (s *boltCachingStore) cleanup(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.deleteExpired() // nolint:errcheck
+		}
+	}
+}
+
+func (s *boltCachingStore) deleteExpired() error {
+	now := time.Now().UnixNano()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var expired [][]byte
+		entries := tx.Bucket(boltEntriesBucket)
+
+		if err := entries.ForEach(func(k, v []byte) error {
+			if boltEntryExpired(v, now) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		return s.deleteEntries(tx, expired)
+	})
+}
+
+func (s *boltCachingStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
+	value, _, err := s.GetWithTTL(ctx, key)
+
+	return value, err
+}
+
+func (s *boltCachingStore) GetWithTTL(_ context.Context, key interface{}) (value interface{}, ttl time.Duration, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		entry := tx.Bucket(boltEntriesBucket).Get([]byte(key.(string)))
+
+		if entry == nil || boltEntryExpired(entry, time.Now().UnixNano()) {
+			return ErrBoltCachingStoreNotFound
+		}
+
+		if expireAt := int64(binary.BigEndian.Uint64(entry[8:boltEntryHeaderSize])); expireAt > 0 {
+			ttl = time.Until(time.Unix(0, expireAt))
+		}
+
+		value = append([]byte(nil), entry[boltEntryHeaderSize:]...)
+
+		return nil
+	})
+
+	return value, ttl, err
+}
+
+// Set stores value with tags given, tags of existing entry will be kept.
+func (s *boltCachingStore) Set(_ context.Context, key interface{}, value interface{}, options *store.Options) error {
+	var data []byte
+	var expireAt int64
+	var tags []string
+	k := []byte(key.(string))
+
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("bbolt caching store: unsupported value type %T", value)
+	}
+
+	if options != nil {
+		tags = options.Tags
+
+		if options.Expiration > 0 {
+			expireAt = time.Now().Add(options.Expiration).UnixNano()
+		}
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(boltEntriesBucket)
+		order := tx.Bucket(boltOrderBucket)
+		size := s.size(tx)
+
+		if old := entries.Get(k); old != nil {
+			size -= uint64(len(k) + len(old) - boltEntryHeaderSize)
+
+			if err := order.Delete(boltOrderKey(old, k)); err != nil {
+				return err
+			}
+		}
+
+		seq, err := entries.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		entry := make([]byte, boltEntryHeaderSize+len(data))
+		binary.BigEndian.PutUint64(entry, seq)
+		binary.BigEndian.PutUint64(entry[8:], uint64(expireAt))
+		copy(entry[boltEntryHeaderSize:], data)
+
+		if err = entries.Put(k, entry); err != nil {
+			return err
+		}
+
+		if err = order.Put(boltOrderKey(entry, k), nil); err != nil {
+			return err
+		}
+
+		if err = s.addTags(tx, k, tags); err != nil {
+			return err
+		}
+
+		size += uint64(len(k) + len(data))
+
+		if size, err = s.evict(tx, k, size); err != nil {
+			return err
+		}
+
+		return s.setSize(tx, size)
+	})
+}
+
+func (s *boltCachingStore) addTags(tx *bolt.Tx, key []byte, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	entryTags := tx.Bucket(boltEntryTagsBucket)
+	existing, err := boltEntryTags(entryTags, key)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		b, err := tx.Bucket(boltTagsBucket).CreateBucketIfNotExists([]byte(tag))
+		if err != nil {
+			return err
+		}
+
+		if err = b.Put(key, nil); err != nil {
+			return err
+		}
+
+		existing[tag] = struct{}{}
+	}
+
+	names := make([]string, 0, len(existing))
+
+	for tag := range existing {
+		names = append(names, tag)
+	}
+
+	rawTags, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+
+	return entryTags.Put(key, rawTags)
+}
+
+// evict deletes least recently written entries until size not exceeds max size, current key will not be evicted.
+func (s *boltCachingStore) evict(tx *bolt.Tx, current []byte, size uint64) (uint64, error) {
+	order := tx.Bucket(boltOrderBucket)
+
+	for s.maxSize > 0 && size > s.maxSize {
+		orderKey, _ := order.Cursor().First()
+
+		if orderKey == nil || bytes.Equal(orderKey[8:], current) {
+			break
+		}
+
+		key := append([]byte(nil), orderKey[8:]...)
+		freed, err := s.deleteEntry(tx, key)
+		if err != nil {
+			return size, err
+		}
+
+		size -= freed
+	}
+
+	return size, nil
+}
+
+func (s *boltCachingStore) Delete(_ context.Context, key interface{}) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.deleteEntries(tx, [][]byte{[]byte(key.(string))})
+	})
+}
+
+// Invalidate deletes entries by tags given.
+func (s *boltCachingStore) Invalidate(_ context.Context, options store.InvalidateOptions) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var keys [][]byte
+		tags := tx.Bucket(boltTagsBucket)
+
+		for _, tag := range options.TagsValue() {
+			b := tags.Bucket([]byte(tag))
+
+			if b == nil {
+				continue
+			}
+
+			if err := b.ForEach(func(k, _ []byte) error {
+				keys = append(keys, append([]byte(nil), k...))
+
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		return s.deleteEntries(tx, keys)
+	})
+}
+
+func (s *boltCachingStore) Clear(_ context.Context) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltEntriesBucket, boltOrderBucket, boltTagsBucket, boltEntryTagsBucket, boltMetaBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+
+		return s.createBuckets(tx)
+	})
+}
+
+func (s *boltCachingStore) GetType() string {
+	return boltCachingStoreType
+}
+
+func (s *boltCachingStore) deleteEntries(tx *bolt.Tx, keys [][]byte) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	size := s.size(tx)
+
+	for _, key := range keys {
+		freed, err := s.deleteEntry(tx, key)
+		if err != nil {
+			return err
+		}
+
+		size -= freed
+	}
+
+	return s.setSize(tx, size)
+}
+
+// deleteEntry deletes entry and its tags index, returns size freed.
+func (s *boltCachingStore) deleteEntry(tx *bolt.Tx, key []byte) (uint64, error) {
+	entries := tx.Bucket(boltEntriesBucket)
+	entry := entries.Get(key)
+
+	if entry == nil {
+		return 0, nil
+	}
+
+	freed := uint64(len(key) + len(entry) - boltEntryHeaderSize)
+
+	if err := tx.Bucket(boltOrderBucket).Delete(boltOrderKey(entry, key)); err != nil {
+		return 0, err
+	}
+
+	if err := entries.Delete(key); err != nil {
+		return 0, err
+	}
+
+	entryTags := tx.Bucket(boltEntryTagsBucket)
+	tags, err := boltEntryTags(entryTags, key)
+	if err != nil {
+		return 0, err
+	}
+
+	for tag := range tags {
+		b := tx.Bucket(boltTagsBucket).Bucket([]byte(tag))
+
+		if b == nil {
+			continue
+		}
+
+		if err = b.Delete(key); err != nil {
+			return 0, err
+		}
+
+		if k, _ := b.Cursor().First(); k == nil {
+			if err = tx.Bucket(boltTagsBucket).DeleteBucket([]byte(tag)); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return freed, entryTags.Delete(key)
+}
+
+func (s *boltCachingStore) size(tx *bolt.Tx) uint64 {
+	v := tx.Bucket(boltMetaBucket).Get(boltSizeKey)
+
+	if len(v) != 8 {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(v)
+}
+
+func (s *boltCachingStore) setSize(tx *bolt.Tx, size uint64) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, size)
+
+	return tx.Bucket(boltMetaBucket).Put(boltSizeKey, v)
+}
+
+func boltEntryExpired(entry []byte, now int64) bool {
+	expireAt := int64(binary.BigEndian.Uint64(entry[8:boltEntryHeaderSize]))
+
+	return expireAt > 0 && expireAt <= now
+}
+
+// boltOrderKey returns key of order bucket, it is write sequence of entry following by entry key.
+func boltOrderKey(entry, key []byte) []byte {
+	orderKey := make([]byte, 8+len(key))
+	copy(orderKey, entry[:8])
+	copy(orderKey[8:], key)
+
+	return orderKey
+}
+
+func boltEntryTags(entryTags *bolt.Bucket, key []byte) (map[string]struct{}, error) {
+	var names []string
+	tags := make(map[string]struct{})
+
+	if v := entryTags.Get(key); v != nil {
+		if err := json.Unmarshal(v, &names); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range names {
+		tags[name] = struct{}{}
+	}
+
+	return tags, nil
+}
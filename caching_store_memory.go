@@ -0,0 +1,243 @@
+package gbox
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eko/gocache/v2/marshaler"
+	"github.com/eko/gocache/v2/store"
+)
+
+const memoryCachingStoreType = "memory"
+
+var (
+	ErrMemoryCachingStoreNotFound   = errors.New("key not found in memory caching store")
+	ErrMemoryCachingStoreLargeEntry = errors.New("entry is larger than memory caching store size")
+)
+
+// memoryCachingStore is in-memory store with inverted tags index maintained alongside entries,
+// entries are evicted in least recently used order when total size exceeds cache size,
+// tags index of entries evicted is deleted together, so purging by tags is always consistent.
+type memoryCachingStore struct {
+	mu      sync.Mutex
+	maxSize int
+	size    int
+	lru     *list.List
+	entries map[string]*list.Element
+	tags    map[string]map[string]struct{}
+}
+
+type memoryCachingEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+	tags     map[string]struct{}
+}
+
+func (e *memoryCachingEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// size returns memory accounted for entry, include its key, value and tags index.
+func (e *memoryCachingEntry) size() int {
+	size := 2*len(e.key) + len(e.value)
+
+	for tag := range e.tags {
+		size += len(tag) + len(e.key)
+	}
+
+	return size
+}
+
+// MemoryCachingStoreFactory creates in-memory store, DSN example:
+// memory://?cache_size=104857600
+func MemoryCachingStoreFactory(u *url.URL) (*CachingStore, error) {
+	cacheSize := u.Query().Get("cache_size")
+
+	if cacheSize == "" {
+		return nil, errors.New("cache_size must be set explicit")
+	}
+
+	cacheSizeInt, err := strconv.Atoi(cacheSize)
+	if err != nil || cacheSizeInt <= 0 {
+		return nil, fmt.Errorf("`cache_size` param should be positive numeric string, %s given", cacheSize)
+	}
+
+	s := newMemoryCachingStore(cacheSizeInt)
+
+	return &CachingStore{
+		Marshaler: marshaler.New(s),
+		close: func() error {
+			return s.Clear(context.Background())
+		},
+	}, nil
+}
+
+func newMemoryCachingStore(maxSize int) *memoryCachingStore {
+	return &memoryCachingStore{
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		tags:    make(map[string]map[string]struct{}),
+	}
+}
+
+func (s *memoryCachingStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
+	value, _, err := s.GetWithTTL(ctx, key)
+
+	return value, err
+}
+
+func (s *memoryCachingStore) GetWithTTL(_ context.Context, key interface{}) (interface{}, time.Duration, error) {
+	var ttl time.Duration
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key.(string)]
+
+	if !ok {
+		return nil, 0, ErrMemoryCachingStoreNotFound
+	}
+
+	entry := element.Value.(*memoryCachingEntry)
+
+	if entry.expired(now) {
+		s.remove(element)
+
+		return nil, 0, ErrMemoryCachingStoreNotFound
+	}
+
+	if !entry.expireAt.IsZero() {
+		ttl = entry.expireAt.Sub(now)
+	}
+
+	s.lru.MoveToFront(element)
+
+	return entry.value, ttl, nil
+}
+
+// Set stores value with tags given, tags of existing entry will be kept.
+func (s *memoryCachingStore) Set(_ context.Context, key interface{}, value interface{}, options *store.Options) error {
+	entry := &memoryCachingEntry{
+		key:  key.(string),
+		tags: make(map[string]struct{}),
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		entry.value = append([]byte(nil), v...)
+	case string:
+		entry.value = []byte(v)
+	default:
+		return fmt.Errorf("memory caching store: unsupported value type %T", value)
+	}
+
+	if options != nil {
+		if options.Expiration > 0 {
+			entry.expireAt = time.Now().Add(options.Expiration)
+		}
+
+		for _, tag := range options.Tags {
+			entry.tags[tag] = struct{}{}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[entry.key]; ok {
+		for tag := range element.Value.(*memoryCachingEntry).tags {
+			entry.tags[tag] = struct{}{}
+		}
+
+		s.remove(element)
+	}
+
+	if entry.size() > s.maxSize {
+		return ErrMemoryCachingStoreLargeEntry
+	}
+
+	s.entries[entry.key] = s.lru.PushFront(entry)
+	s.size += entry.size()
+
+	for tag := range entry.tags {
+		keys, ok := s.tags[tag]
+
+		if !ok {
+			keys = make(map[string]struct{})
+			s.tags[tag] = keys
+		}
+
+		keys[entry.key] = struct{}{}
+	}
+
+	for s.size > s.maxSize {
+		s.remove(s.lru.Back())
+	}
+
+	return nil
+}
+
+func (s *memoryCachingStore) Delete(_ context.Context, key interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key.(string)]; ok {
+		s.remove(element)
+	}
+
+	return nil
+}
+
+// Invalidate deletes entries by tags given.
+func (s *memoryCachingStore) Invalidate(_ context.Context, options store.InvalidateOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tag := range options.TagsValue() {
+		for key := range s.tags[tag] {
+			s.remove(s.entries[key])
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryCachingStore) Clear(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.size = 0
+	s.lru.Init()
+	s.entries = make(map[string]*list.Element)
+	s.tags = make(map[string]map[string]struct{})
+
+	return nil
+}
+
+func (s *memoryCachingStore) GetType() string {
+	return memoryCachingStoreType
+}
+
+// remove deletes entry of element given and its tags index, caller must hold lock.
+func (s *memoryCachingStore) remove(element *list.Element) {
+	entry := s.lru.Remove(element).(*memoryCachingEntry)
+	s.size -= entry.size()
+	delete(s.entries, entry.key)
+
+	for tag := range entry.tags {
+		delete(s.tags[tag], entry.key)
+
+		if len(s.tags[tag]) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+}
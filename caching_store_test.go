@@ -1,9 +1,15 @@
 package gbox
 
 import (
+	"context"
+	"fmt"
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/eko/gocache/v2/marshaler"
+	"github.com/eko/gocache/v2/store"
 	"github.com/stretchr/testify/require"
 )
 
@@ -18,6 +24,12 @@ func TestNewCachingStore(t *testing.T) {
 		"freecache": {
 			url: "freecache://?cache_size=1024",
 		},
+		"memory": {
+			url: "memory://?cache_size=1024",
+		},
+		"tiered": {
+			url: "tiered://redis",
+		},
 		"unknown": {
 			url:              "unknown://unknown",
 			expectedErrorMsg: "caching store schema: unknown is not support",
@@ -63,3 +75,301 @@ func TestRedisCachingStoreFactory(t *testing.T) {
 	require.Error(t, e)
 	require.Equal(t, "`db` param should be numeric string, xyz given", e.Error())
 }
+
+func TestRedisCachingStore_Increment(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	u, _ := url.Parse(fmt.Sprintf("redis://%s", m.Addr()))
+	instances := make([]*CachingStore, 2)
+
+	for i := range instances {
+		s, err := RedisCachingStoreFactory(u)
+		require.NoError(t, err)
+
+		defer s.close()
+
+		instances[i] = s
+	}
+
+	value, err := instances[0].increment(ctx, "counter", 2, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), value)
+
+	value, err = instances[1].increment(ctx, "counter", 3, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), value, "counters increased by instances should be merged")
+	require.Equal(t, time.Hour, m.TTL("counter"))
+}
+
+func TestCachingStore_Increment(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryCachingStore(1000)
+	cachingStore := &CachingStore{Marshaler: marshaler.New(s)}
+
+	value, err := cachingStore.increment(ctx, "counter", 2, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), value)
+
+	value, err = cachingStore.increment(ctx, "counter", 3, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), value)
+}
+
+func TestTieredCachingStoreFactory(t *testing.T) {
+	u, _ := url.Parse("tiered://redis?l1_ttl=xyz")
+	_, e := TieredCachingStoreFactory(u)
+
+	require.Error(t, e)
+	require.Equal(t, "`l1_ttl` param should be duration string at least 1s, xyz given", e.Error())
+
+	u, _ = url.Parse("tiered://redis?cache_size=xyz")
+	_, e = TieredCachingStoreFactory(u)
+
+	require.Error(t, e)
+	require.Equal(t, "`cache_size` param should be numeric string, xyz given", e.Error())
+}
+
+func TestTieredCachingStore_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	u, _ := url.Parse(fmt.Sprintf("tiered://%s?l1_ttl=1h", m.Addr()))
+	instances := make([]*CachingStore, 2)
+
+	for i := range instances {
+		s, err := TieredCachingStoreFactory(u)
+		require.NoError(t, err)
+
+		defer s.close()
+
+		instances[i] = s
+	}
+
+	require.Eventually(t, func() bool {
+		return m.PubSubNumSub(defaultTieredCachingStoreChannel)[defaultTieredCachingStoreChannel] == len(instances)
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, instances[0].Set(ctx, "key", "value", &store.Options{Tags: []string{"tag"}, Expiration: time.Hour}))
+
+	var value string
+	_, err := instances[1].Get(ctx, "key", &value)
+	require.NoError(t, err)
+	require.Equal(t, "value", value)
+
+	m.Del("key") // only L1 entries of instances remain.
+
+	_, err = instances[1].Get(ctx, "key", &value)
+	require.NoError(t, err, "value should be served by L1")
+
+	require.NoError(t, instances[0].Set(ctx, "key", "value", &store.Options{Tags: []string{"tag"}, Expiration: time.Hour}))
+	require.NoError(t, instances[0].Invalidate(ctx, store.InvalidateOptions{Tags: []string{"tag"}}))
+
+	for _, instance := range instances {
+		s := instance
+
+		require.Eventually(t, func() bool {
+			_, err := s.Get(ctx, "key", &value)
+
+			return err != nil
+		}, time.Second, 10*time.Millisecond, "L1 entries of all instances should be invalidated")
+	}
+}
+
+func TestTieredCachingStore_SetAndClear(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	u, _ := url.Parse(fmt.Sprintf("tiered://%s?l1_ttl=1h", m.Addr()))
+	instances := make([]*CachingStore, 2)
+
+	for i := range instances {
+		s, err := TieredCachingStoreFactory(u)
+		require.NoError(t, err)
+
+		defer s.close()
+
+		instances[i] = s
+	}
+
+	require.Eventually(t, func() bool {
+		return m.PubSubNumSub(defaultTieredCachingStoreChannel)[defaultTieredCachingStoreChannel] == len(instances)
+	}, time.Second, 10*time.Millisecond)
+
+	var value string
+
+	require.NoError(t, instances[0].Set(ctx, "key", "old", &store.Options{Expiration: time.Hour}))
+	_, err := instances[1].Get(ctx, "key", &value)
+	require.NoError(t, err)
+	require.Equal(t, "old", value)
+
+	require.NoError(t, instances[0].Set(ctx, "key", "new", &store.Options{Expiration: time.Hour}))
+	require.Eventually(t, func() bool {
+		_, err := instances[1].Get(ctx, "key", &value)
+
+		return err == nil && value == "new"
+	}, time.Second, 10*time.Millisecond, "L1 entries of other instances should be invalidated on set")
+
+	_, err = instances[0].Get(ctx, "key", &value)
+	require.NoError(t, err)
+	require.Equal(t, "new", value)
+
+	require.NoError(t, instances[0].Clear(ctx))
+	require.Eventually(t, func() bool {
+		_, err := instances[1].Get(ctx, "key", &value)
+
+		return err != nil
+	}, time.Second, 10*time.Millisecond, "L1 entries of other instances should be cleared")
+}
+
+func TestBoltCachingStoreFactory(t *testing.T) {
+	u, _ := url.Parse("bbolt://")
+	_, e := BoltCachingStoreFactory(u)
+
+	require.Error(t, e)
+	require.Equal(t, "bbolt database file path must be set explicit", e.Error())
+
+	u, _ = url.Parse("bbolt:///tmp/gbox.db?max_size=xyz")
+	_, e = BoltCachingStoreFactory(u)
+
+	require.Error(t, e)
+	require.Equal(t, "`max_size` param should be numeric string, xyz given", e.Error())
+}
+
+func TestBoltCachingStore(t *testing.T) {
+	ctx := context.Background()
+	u, _ := url.Parse(fmt.Sprintf("bbolt://%s/caching.db", t.TempDir()))
+	s, err := BoltCachingStoreFactory(u)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Set(ctx, "a", "a", &store.Options{Tags: []string{"x"}}))
+	require.NoError(t, s.Set(ctx, "b", "b", &store.Options{Tags: []string{"x", "y"}}))
+	require.NoError(t, s.Set(ctx, "b", "b", nil), "existing tags should be kept")
+	require.NoError(t, s.Set(ctx, "c", "c", &store.Options{Expiration: time.Millisecond}))
+	require.NoError(t, s.close())
+	time.Sleep(2 * time.Millisecond)
+
+	// reopen to make sure entries survive restarts.
+	s, err = BoltCachingStoreFactory(u)
+	require.NoError(t, err)
+
+	defer s.close()
+
+	var value string
+	_, err = s.Get(ctx, "a", &value)
+	require.NoError(t, err)
+	require.Equal(t, "a", value)
+
+	_, err = s.Get(ctx, "c", &value)
+	require.ErrorIs(t, err, ErrBoltCachingStoreNotFound, "expired entry should not be served")
+
+	require.NoError(t, s.Invalidate(ctx, store.InvalidateOptions{Tags: []string{"y"}}))
+
+	_, err = s.Get(ctx, "b", &value)
+	require.ErrorIs(t, err, ErrBoltCachingStoreNotFound)
+
+	_, err = s.Get(ctx, "a", &value)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Invalidate(ctx, store.InvalidateOptions{Tags: []string{"x"}}))
+
+	_, err = s.Get(ctx, "a", &value)
+	require.ErrorIs(t, err, ErrBoltCachingStoreNotFound)
+}
+
+func TestBoltCachingStore_Evict(t *testing.T) {
+	ctx := context.Background()
+	u, _ := url.Parse(fmt.Sprintf("bbolt://%s/caching.db?max_size=40", t.TempDir()))
+	s, err := BoltCachingStoreFactory(u)
+	require.NoError(t, err)
+
+	defer s.close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Set(ctx, key, "0123456789", &store.Options{Tags: []string{"x"}}))
+	}
+
+	require.NoError(t, s.Set(ctx, "a", "0123456789", nil), "rewritten entry should be the most recent")
+	require.NoError(t, s.Set(ctx, "d", "0123456789", nil))
+
+	var value string
+
+	for key, evicted := range map[string]bool{"a": false, "b": true, "c": false, "d": false} {
+		_, err = s.Get(ctx, key, &value)
+
+		if evicted {
+			require.ErrorIsf(t, err, ErrBoltCachingStoreNotFound, "key %s should be evicted", key)
+		} else {
+			require.NoErrorf(t, err, "key %s should not be evicted", key)
+		}
+	}
+}
+
+func TestMemoryCachingStoreFactory(t *testing.T) {
+	u, _ := url.Parse("memory://")
+	_, e := MemoryCachingStoreFactory(u)
+
+	require.Error(t, e)
+	require.Equal(t, "cache_size must be set explicit", e.Error())
+
+	u, _ = url.Parse("memory://?cache_size=xyz")
+	_, e = MemoryCachingStoreFactory(u)
+
+	require.Error(t, e)
+	require.Equal(t, "`cache_size` param should be positive numeric string, xyz given", e.Error())
+}
+
+func TestMemoryCachingStore(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryCachingStore(1024)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("a"), &store.Options{Tags: []string{"x"}}))
+	require.NoError(t, s.Set(ctx, "b", []byte("b"), &store.Options{Tags: []string{"x", "y"}}))
+	require.NoError(t, s.Set(ctx, "b", []byte("b"), nil), "existing tags should be kept")
+	require.NoError(t, s.Set(ctx, "c", []byte("c"), &store.Options{Expiration: time.Millisecond}))
+
+	time.Sleep(2 * time.Millisecond)
+
+	_, err := s.Get(ctx, "c")
+	require.ErrorIs(t, err, ErrMemoryCachingStoreNotFound, "expired entry should not be served")
+
+	require.NoError(t, s.Invalidate(ctx, store.InvalidateOptions{Tags: []string{"y"}}))
+
+	_, err = s.Get(ctx, "b")
+	require.ErrorIs(t, err, ErrMemoryCachingStoreNotFound)
+
+	value, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, []byte("a"), value)
+
+	require.NoError(t, s.Invalidate(ctx, store.InvalidateOptions{Tags: []string{"x"}}))
+
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, ErrMemoryCachingStoreNotFound)
+	require.Empty(t, s.entries)
+	require.Empty(t, s.tags)
+	require.Zero(t, s.size)
+
+	require.ErrorIs(t, s.Set(ctx, "large", make([]byte, 2048), nil), ErrMemoryCachingStoreLargeEntry)
+}
+
+func TestMemoryCachingStore_Evict(t *testing.T) {
+	ctx := context.Background()
+	entrySize := (&memoryCachingEntry{key: "a", value: make([]byte, 10), tags: map[string]struct{}{"x": {}}}).size()
+	s := newMemoryCachingStore(3 * entrySize)
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Set(ctx, key, make([]byte, 10), &store.Options{Tags: []string{"x"}}))
+	}
+
+	_, err := s.Get(ctx, "a")
+	require.NoError(t, err, "a should be the most recently used")
+	require.NoError(t, s.Set(ctx, "d", make([]byte, 10), &store.Options{Tags: []string{"x"}}))
+
+	_, err = s.Get(ctx, "b")
+	require.ErrorIs(t, err, ErrMemoryCachingStoreNotFound, "b should be evicted")
+	require.Len(t, s.tags["x"], 3, "tags index of evicted entry should be deleted")
+	require.NotContains(t, s.tags["x"], "b")
+	require.Equal(t, 3*entrySize, s.size)
+
+	require.NoError(t, s.Invalidate(ctx, store.InvalidateOptions{Tags: []string{"x"}}))
+	require.Empty(t, s.entries)
+	require.Zero(t, s.size)
+}
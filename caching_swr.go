@@ -7,17 +7,18 @@ import (
 	"mime"
 	"net/http"
 
-	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 )
 
-func (c *Caching) swrQueryResult(ctx context.Context, result *cachingQueryResult, request *cachingRequest, handler caddyhttp.HandlerFunc) error {
+func (c *Caching) swrQueryResult(ctx context.Context, result *cachingQueryResult, request *cachingRequest, handler caddyhttp.HandlerFunc, flight *cachingFlight) error {
 	buff := bufferPool.Get().(*bytes.Buffer)
 	defer bufferPool.Put(buff)
 	buff.Reset()
 	rw := newCachingResponseWriter(buff)
+	err := handler(rw, request.httpRequest)
+	flight.resolve(rw, err)
 
-	if err := handler(rw, request.httpRequest); err != nil {
+	if err != nil {
 		return err
 	}
 
@@ -34,9 +35,3 @@ func (c *Caching) swrQueryResult(ctx context.Context, result *cachingQueryResult
 
 	return nil
 }
-
-func prepareSwrHTTPRequest(ctx context.Context, r *http.Request, w http.ResponseWriter) *http.Request {
-	s := r.Context().Value(caddyhttp.ServerCtxKey).(*caddyhttp.Server)
-
-	return caddyhttp.PrepareRequest(r.Clone(ctx), caddy.NewReplacer(), w, s)
-}
@@ -1,6 +1,7 @@
 package gbox
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -87,6 +88,8 @@ func (c *cachingTagVisitor) addTagForTypeKey(field string, value interface{}, ty
 		c.tags[fmt.Sprintf(cachingTagTypeKeyPattern, typeName, field, v)] = struct{}{}
 	case float64:
 		c.tags[fmt.Sprintf(cachingTagTypeKeyPattern, typeName, field, strconv.FormatInt(int64(v), 10))] = struct{}{}
+	case nil:
+		// skip in cases key value's null
 	default:
 		c.Walker.StopWithInternalErr(fmt.Errorf("invalid type key of %s.%s only accept string or numeric but got: %T", typeName, field, v))
 	}
@@ -119,6 +122,8 @@ func (c *cachingTagVisitor) collectTypeKeyTags(path []string, data interface{},
 		}
 	case map[string]interface{}:
 		c.addTagForTypeKey(at, v[at], typeName)
+	case nil:
+		// skip in cases object value's null
 	default:
 		c.Walker.StopWithInternalErr(fmt.Errorf("invalid data type expected map or array map but got %T", v))
 	}
@@ -137,17 +142,26 @@ func newCachingTagAnalyzer(r *cachingRequest, t graphql.RequestTypes) *cachingTa
 
 func (c *cachingTagAnalyzer) AnalyzeResult(result []byte, onlyTypes map[string]struct{}, tags cachingTags) (err error) {
 	normalizedQueryResult := &struct {
-		Data map[string]interface{} `json:"data,omitempty"`
+		Data json.RawMessage `json:"data,omitempty"`
 	}{}
 
 	if err = json.Unmarshal(result, normalizedQueryResult); err != nil {
 		return err
 	}
 
-	if normalizedQueryResult.Data == nil || len(normalizedQueryResult.Data) == 0 {
+	if len(normalizedQueryResult.Data) == 0 {
 		return errors.New("query result: `data` field missing")
 	}
 
+	// data will be null when errors occurred on non-null root fields, types tags still collected from operation.
+	data := make(map[string]interface{})
+
+	if !bytes.Equal(normalizedQueryResult.Data, []byte("null")) {
+		if err = json.Unmarshal(normalizedQueryResult.Data, &data); err != nil {
+			return err
+		}
+	}
+
 	if err = c.request.initOperation(); err != nil {
 		return err
 	}
@@ -157,7 +171,7 @@ func (c *cachingTagAnalyzer) AnalyzeResult(result []byte, onlyTypes map[string]s
 	visitor := &cachingTagVisitor{
 		cachingTagAnalyzer: c,
 		Walker:             &walker,
-		data:               normalizedQueryResult.Data,
+		data:               data,
 		tags:               tags,
 		onlyTypes:          onlyTypes,
 	}
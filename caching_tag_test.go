@@ -64,3 +64,28 @@ func TestCachingTagAnalyzer_AnalyzeResult_OnlyTypes(t *testing.T) {
 	require.Equal(t, tags.TypeKeys().ToSlice(), []string{})
 	require.Equal(t, tags.Operation().ToSlice(), []string{fmt.Sprintf(cachingTagOperationPattern, cr.gqlRequest.OperationName)})
 }
+
+func TestCachingTagAnalyzer_AnalyzeResult_NullData(t *testing.T) {
+	typeKeys := graphql.RequestTypes{
+		"User": graphql.RequestFields{
+			"name": struct{}{},
+		},
+	}
+
+	for _, result := range []string{
+		`{"data": null, "errors": [{"message": "not found"}]}`,
+		`{"data": {"users": null}}`,
+		`{"data": {"users": [{"name": null}]}}`,
+	} {
+		cr := newTestCachingRequest()
+		tags := make(cachingTags)
+		err := newCachingTagAnalyzer(cr, typeKeys).AnalyzeResult([]byte(result), nil, tags)
+
+		require.NoErrorf(t, err, "result %s: unexpected error", result)
+		require.Equalf(t, []string{"type:Query", "type:User"}, tags.Types().ToSlice(), "result %s: unexpected types", result)
+		require.Emptyf(t, tags.TypeKeys(), "result %s: should not have type keys", result)
+	}
+
+	err := newCachingTagAnalyzer(newTestCachingRequest(), nil).AnalyzeResult([]byte(`{"errors": []}`), nil, make(cachingTags))
+	require.Error(t, err, "data field missing should be error")
+}
@@ -64,6 +64,38 @@ func TestCaching_Validate(t *testing.T) {
 				},
 			},
 		},
+		"valid_pass_rule_without_max_age": {
+			caching: &Caching{
+				Rules: CachingRules{
+					"preview": &CachingRule{
+						Action:  CachingRuleActionPass,
+						Headers: map[string][]string{"x-preview": {"true"}},
+					},
+				},
+			},
+		},
+		"invalid_rules_action": {
+			expectedErrorMsg: "caching rule default, action skip is not supported",
+			caching: &Caching{
+				Rules: CachingRules{
+					"default": &CachingRule{
+						MaxAge: 1,
+						Action: "skip",
+					},
+				},
+			},
+		},
+		"invalid_rules_operation_names_pattern": {
+			expectedErrorMsg: "caching rule default, invalid pattern /(/: error parsing regexp: missing closing ): `(`",
+			caching: &Caching{
+				Rules: CachingRules{
+					"default": &CachingRule{
+						MaxAge:         1,
+						OperationNames: []string{"/(/"},
+					},
+				},
+			},
+		},
 		"rules_vary_name_not_exist": {
 			expectedErrorMsg: "caching rule default, configured vary: test does not exist",
 			caching: &Caching{
@@ -2,10 +2,19 @@ package gbox
 
 import (
 	"encoding/json"
+	"errors"
+	"net/http"
 
 	"github.com/jensneuse/graphql-go-tools/pkg/pool"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
 )
 
+const defaultCachingVaryClaimsHeader = "authorization"
+
+// ErrCachingVaryInvalidToken is returned when JWT of request is invalid, query results of these requests will not be cached.
+var ErrCachingVaryInvalidToken = errors.New("caching vary token is invalid")
+
 // CachingVary using to compute query result cache key by http request cookies and headers.
 type CachingVary struct {
 	// Headers names for identifier query result cache key.
@@ -13,6 +22,112 @@ type CachingVary struct {
 
 	// Cookies names for identifier query result cache key.
 	Cookies []string `json:"cookies,omitempty"`
+
+	// Claims of verified JWT for identifier query result cache key.
+	Claims *CachingVaryClaims `json:"claims,omitempty"`
+}
+
+// CachingVaryClaims verifies JWT of requests and selects claims of it to identifier query result cache key,
+// so requests with different tokens of the same user can share query results.
+type CachingVaryClaims struct {
+	// Header contains JWT (with or without `Bearer` prefix), `authorization` by default.
+	Header string `json:"header,omitempty"`
+
+	// Cookie contains JWT, it takes precedence over header if set.
+	Cookie string `json:"cookie,omitempty"`
+
+	// JSON web key set file using to verify JWT signature.
+	JWKSFile string `json:"jwks_file,omitempty"`
+
+	// Key file using to verify JWT signature, it can be PEM encoded RSA or EC public key, or HMAC secret.
+	KeyFile string `json:"key_file,omitempty"`
+
+	// Expected `iss` claim of JWT.
+	Issuer string `json:"issuer,omitempty"`
+
+	// Expected `aud` claim of JWT.
+	Audience []string `json:"audience,omitempty"`
+
+	// Names of claims for identifier query result cache key, e.g: sub, tenant_id, roles.
+	Names []string `json:"names,omitempty"`
+
+	jwks *jose.JSONWebKeySet
+}
+
+func (c *CachingVaryClaims) provision() (err error) {
+	if c.JWKSFile != "" {
+		c.jwks, err = loadJSONWebKeySet(c.JWKSFile)
+
+		return err
+	}
+
+	if c.KeyFile != "" {
+		c.jwks, err = loadJSONWebKey(c.KeyFile)
+	}
+
+	return err
+}
+
+func (c *CachingVaryClaims) validate() error {
+	if len(c.Names) == 0 {
+		return errors.New("caching vary claims names must be set")
+	}
+
+	if (c.JWKSFile == "") == (c.KeyFile == "") {
+		return errors.New("caching vary claims must set either jwks file or key file")
+	}
+
+	return nil
+}
+
+// token returns JWT of request given, it will be empty if request does not have it.
+func (c *CachingVaryClaims) token(r *http.Request) string {
+	if c.Cookie != "" {
+		if cookie, err := r.Cookie(c.Cookie); err == nil {
+			return parseBearerToken(cookie.Value)
+		}
+
+		return ""
+	}
+
+	header := c.Header
+
+	if header == "" {
+		header = defaultCachingVaryClaimsHeader
+	}
+
+	return parseBearerToken(r.Header.Get(header))
+}
+
+// values verifies JWT of request given and returns JSON encoded values of claims selected,
+// values will be null if request does not have token, so anonymous requests share the same query results.
+func (c *CachingVaryClaims) values(r *http.Request) ([]json.RawMessage, error) {
+	values := make([]json.RawMessage, len(c.Names))
+	token := c.token(r)
+
+	if token == "" {
+		for i := range values {
+			values[i] = json.RawMessage("null")
+		}
+
+		return values, nil
+	}
+
+	claims, err := verifyJWT(token, c.jwks, jwt.Expected{
+		Issuer:   c.Issuer,
+		Audience: c.Audience,
+	})
+	if err != nil {
+		return nil, ErrCachingVaryInvalidToken
+	}
+
+	for i, name := range c.Names {
+		if values[i], err = json.Marshal(claims[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
 }
 
 type CachingVaries map[string]*CachingVary
@@ -1,9 +1,17 @@
 package gbox
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/caddyserver/caddy/v2"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
 )
 
 func TestCachingVariesHash(t *testing.T) {
@@ -24,3 +32,82 @@ func TestCachingVariesHash(t *testing.T) {
 	require.NoError(t, err)
 	require.Greater(t, hash, uint64(0))
 }
+
+func TestCachingVaryClaims_Validate(t *testing.T) {
+	require.NoError(t, (&CachingVaryClaims{KeyFile: "key", Names: []string{"sub"}}).validate())
+	require.Error(t, (&CachingVaryClaims{KeyFile: "key"}).validate(), "names must be set")
+	require.Error(t, (&CachingVaryClaims{Names: []string{"sub"}}).validate(), "key file or jwks file must be set")
+	require.Error(t, (&CachingVaryClaims{KeyFile: "key", JWKSFile: "jwks", Names: []string{"sub"}}).validate())
+}
+
+func TestCaching_HandleQueryRequestVaryClaims(t *testing.T) {
+	secret := []byte("secret")
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, ioutil.WriteFile(keyFile, secret, 0o600))
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: secret}, (&jose.SignerOptions{}).WithType("JWT"))
+	require.NoError(t, err)
+
+	otherSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("other")}, nil)
+	require.NoError(t, err)
+
+	c := newTestCaching(t, CachingRules{
+		"default": &CachingRule{
+			MaxAge: caddy.Duration(time.Hour),
+			Varies: []string{"user"},
+		},
+	})
+	c.Varies = CachingVaries{
+		"user": &CachingVary{
+			Claims: &CachingVaryClaims{
+				KeyFile: keyFile,
+				Names:   []string{"sub", "roles"},
+			},
+		},
+	}
+	require.NoError(t, c.Varies["user"].Claims.provision())
+
+	upstream := func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"data": {"users": [{"name": "A"}]}}`))
+
+		return err
+	}
+
+	testCases := []struct {
+		name     string
+		signer   jose.Signer
+		claims   map[string]interface{}
+		expected CachingStatus
+	}{
+		{name: "first token of user", signer: signer, claims: map[string]interface{}{"sub": "1", "roles": []string{"admin"}, "jti": "a"}, expected: CachingStatusMiss},
+		{name: "other token of same user", signer: signer, claims: map[string]interface{}{"sub": "1", "roles": []string{"admin"}, "jti": "b"}, expected: CachingStatusHit},
+		{name: "other roles", signer: signer, claims: map[string]interface{}{"sub": "1", "roles": []string{"user"}}, expected: CachingStatusMiss},
+		{name: "other user", signer: signer, claims: map[string]interface{}{"sub": "2", "roles": []string{"admin"}}, expected: CachingStatusMiss},
+		{name: "invalid signature", signer: otherSigner, claims: map[string]interface{}{"sub": "1", "roles": []string{"admin"}}, expected: CachingStatusPass},
+		{name: "anonymous", expected: CachingStatusMiss},
+		{name: "anonymous again", expected: CachingStatusHit},
+	}
+
+	for _, testCase := range testCases {
+		r := newTestCachingRequest()
+
+		if testCase.signer != nil {
+			token, err := jwt.Signed(testCase.signer).Claims(testCase.claims).CompactSerialize()
+			require.NoError(t, err)
+
+			r.httpRequest.Header.Set("authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		require.NoErrorf(t, c.handleQueryRequest(w, r, upstream), "case %s", testCase.name)
+		require.Equalf(t, string(testCase.expected), w.Header().Get("x-cache"), "case %s", testCase.name)
+	}
+
+	r := newTestCachingRequest()
+	r.httpRequest.Header.Set("authorization", "Bearer invalid")
+	plan, err := c.getCachingPlan(r)
+	require.NoError(t, err)
+	require.True(t, plan.Passthrough, "plan of request with invalid token should be passthrough")
+}
@@ -155,6 +155,62 @@ reverse_proxy {
 				if err = h.unmarshalCaddyfileCaching(d.NewFromNextSegment()); err != nil {
 					return err
 				}
+			case "apq":
+				if h.APQ != nil {
+					return d.Err("apq already specified")
+				}
+
+				if err = h.unmarshalCaddyfileAPQ(d.NewFromNextSegment()); err != nil {
+					return err
+				}
+			case "batching":
+				if h.Batching != nil {
+					return d.Err("batching already specified")
+				}
+
+				if err = h.unmarshalCaddyfileBatching(d.NewFromNextSegment()); err != nil {
+					return err
+				}
+			case "allowlist":
+				if h.Allowlist != nil {
+					return d.Err("allowlist already specified")
+				}
+
+				if err = h.unmarshalCaddyfileAllowlist(d.NewFromNextSegment()); err != nil {
+					return err
+				}
+			case "upload":
+				if h.Upload != nil {
+					return d.Err("upload already specified")
+				}
+
+				if err = h.unmarshalCaddyfileUpload(d.NewFromNextSegment()); err != nil {
+					return err
+				}
+			case "sse":
+				if h.SSE != nil {
+					return d.Err("sse already specified")
+				}
+
+				if err = h.unmarshalCaddyfileSSE(d.NewFromNextSegment()); err != nil {
+					return err
+				}
+			case "connection_init":
+				if h.ConnectionInit != nil {
+					return d.Err("connection_init already specified")
+				}
+
+				if err = h.unmarshalCaddyfileConnectionInit(d.NewFromNextSegment()); err != nil {
+					return err
+				}
+			case "subscription":
+				if h.Subscription != nil {
+					return d.Err("subscription already specified")
+				}
+
+				if err = h.unmarshalCaddyfileSubscription(d.NewFromNextSegment()); err != nil {
+					return err
+				}
 			case "disabled_playgrounds":
 				if !d.NextArg() {
 					return d.ArgErr()
@@ -0,0 +1,63 @@
+package gbox
+
+import (
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func (h *Handler) unmarshalCaddyfileAllowlist(d *caddyfile.Dispenser) error {
+	var disabled bool
+	allowlist := new(Allowlist)
+
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "enabled":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return err
+				}
+
+				disabled = !v
+			case "mode":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				switch d.Val() {
+				case AllowlistModeEnforce, AllowlistModeLogOnly:
+					allowlist.Mode = d.Val()
+				default:
+					return d.Errf("unrecognized allowlist mode %s", d.Val())
+				}
+			case "dir":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				allowlist.Dir = d.Val()
+			case "manifests":
+				args := d.RemainingArgs()
+
+				if len(args) == 0 {
+					return d.ArgErr()
+				}
+
+				allowlist.Manifests = args
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+
+	if !disabled {
+		h.Allowlist = allowlist
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package gbox
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func (h *Handler) unmarshalCaddyfileAPQ(d *caddyfile.Dispenser) error {
+	var disabled bool
+	apq := new(APQ)
+
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "enabled":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return err
+				}
+
+				disabled = !v
+			case "store_dsn":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				_, err := url.Parse(d.Val())
+				if err != nil {
+					return err
+				}
+
+				apq.StoreDsn = d.Val()
+			case "max_age":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return err
+				}
+
+				apq.MaxAge = caddy.Duration(v)
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+
+	if !disabled {
+		h.APQ = apq
+	}
+
+	return nil
+}
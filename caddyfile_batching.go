@@ -0,0 +1,60 @@
+package gbox
+
+import (
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func (h *Handler) unmarshalCaddyfileBatching(d *caddyfile.Dispenser) error {
+	var disabled bool
+	batching := new(Batching)
+
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "enabled":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return err
+				}
+
+				disabled = !v
+			case "max_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.ParseInt(d.Val(), 10, 32)
+				if err != nil {
+					return err
+				}
+
+				batching.MaxSize = int(v)
+			case "upstream_batch":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return err
+				}
+
+				batching.UpstreamBatch = v
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+
+	if !disabled {
+		h.Batching = batching
+	}
+
+	return nil
+}
@@ -47,6 +47,10 @@ func (h *Handler) unmarshalCaddyfileCaching(d *caddyfile.Dispenser) error {
 				if err := caching.unmarshalCaddyfileVaries(d.NewFromNextSegment()); err != nil {
 					return err
 				}
+			case "invalidation":
+				if err := caching.unmarshalCaddyfileInvalidation(d.NewFromNextSegment()); err != nil {
+					return err
+				}
 			case "type_keys":
 				if err := caching.unmarshalCaddyfileTypeKeys(d.NewFromNextSegment()); err != nil {
 					return err
@@ -73,6 +77,36 @@ func (h *Handler) unmarshalCaddyfileCaching(d *caddyfile.Dispenser) error {
 				}
 
 				caching.DebugHeaders = val
+			case "errors":
+				if err := caching.unmarshalCaddyfileErrors(d.NewFromNextSegment()); err != nil {
+					return err
+				}
+			case "compression":
+				if err := caching.unmarshalCaddyfileCompression(d.NewFromNextSegment()); err != nil {
+					return err
+				}
+			case "coalescing_timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return err
+				}
+
+				caching.CoalescingTimeout = caddy.Duration(v)
+			case "partial_caching":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				val, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return err
+				}
+
+				caching.PartialCaching = val
 			default:
 				return d.Errf("unrecognized subdirective %s", d.Val())
 			}
@@ -122,6 +156,17 @@ func (c *Caching) unmarshalCaddyfileRules(d *caddyfile.Dispenser) error {
 					}
 
 					rule.Swr = caddy.Duration(v)
+				case "stale_if_error":
+					if !d.NextArg() {
+						return d.ArgErr()
+					}
+
+					v, err := caddy.ParseDuration(d.Val())
+					if err != nil {
+						return err
+					}
+
+					rule.StaleIfError = caddy.Duration(v)
 				case "varies":
 					args := d.RemainingArgs()
 
@@ -130,6 +175,87 @@ func (c *Caching) unmarshalCaddyfileRules(d *caddyfile.Dispenser) error {
 					}
 
 					rule.Varies = args
+				case "variables":
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					rule.Variables = args
+				case "ignore_variables":
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					rule.IgnoreVariables = args
+				case "extensions":
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					rule.Extensions = args
+				case "action":
+					if !d.NextArg() {
+						return d.ArgErr()
+					}
+
+					rule.Action = d.Val()
+				case "operation_names":
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					rule.OperationNames = args
+				case "exclude_operation_names":
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					rule.ExcludeOperationNames = args
+				case "header", "exclude_header":
+					directive := d.Val()
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					headers := &rule.Headers
+
+					if directive == "exclude_header" {
+						headers = &rule.ExcludeHeaders
+					}
+
+					if *headers == nil {
+						*headers = make(map[string][]string)
+					}
+
+					(*headers)[args[0]] = append((*headers)[args[0]], args[1:]...)
+				case "client_names":
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					rule.ClientNames = args
+				case "client_versions":
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					rule.ClientVersions = args
 				default:
 					return d.Errf("unrecognized subdirective %s", d.Val())
 				}
@@ -144,7 +270,13 @@ func (c *Caching) unmarshalCaddyfileRules(d *caddyfile.Dispenser) error {
 	return nil
 }
 
-func (r *CachingRule) unmarshalCaddyfileTypes(d *caddyfile.Dispenser) error {
+func (r *CachingRule) unmarshalCaddyfileTypes(d *caddyfile.Dispenser) (err error) {
+	r.Types, err = unmarshalCaddyfileRequestTypes(d)
+
+	return err
+}
+
+func unmarshalCaddyfileRequestTypes(d *caddyfile.Dispenser) (graphql.RequestTypes, error) {
 	types := make(graphql.RequestTypes)
 
 	for d.Next() {
@@ -152,7 +284,7 @@ func (r *CachingRule) unmarshalCaddyfileTypes(d *caddyfile.Dispenser) error {
 			val := d.Val()
 
 			if _, ok := types[val]; ok {
-				return fmt.Errorf("%s already specific", d.Val())
+				return nil, fmt.Errorf("%s already specific", d.Val())
 			}
 
 			fields := map[string]struct{}{}
@@ -166,7 +298,68 @@ func (r *CachingRule) unmarshalCaddyfileTypes(d *caddyfile.Dispenser) error {
 		}
 	}
 
-	r.Types = types
+	return types, nil
+}
+
+func (c *Caching) unmarshalCaddyfileInvalidation(d *caddyfile.Dispenser) error {
+	rules := make(CachingInvalidationRules)
+
+	for d.Next() {
+		for d.NextBlock(0) {
+			rule := new(CachingInvalidationRule)
+			desc := d.Val()
+
+			for subNesting := d.Nesting(); d.NextBlock(subNesting); {
+				switch d.Val() {
+				case "fields":
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					rule.Fields = args
+				case "types":
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					rule.Types = args
+				case "type_fields":
+					types, err := unmarshalCaddyfileRequestTypes(d.NewFromNextSegment())
+					if err != nil {
+						return err
+					}
+
+					rule.TypeFields = types
+				case "operation_names":
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					rule.OperationNames = args
+				case "type_keys":
+					args := d.RemainingArgs()
+
+					if len(args) == 0 {
+						return d.ArgErr()
+					}
+
+					rule.TypeKeys = args
+				default:
+					return d.Errf("unrecognized subdirective %s", d.Val())
+				}
+			}
+
+			rules[desc] = rule
+		}
+	}
+
+	c.Invalidation = rules
 
 	return nil
 }
@@ -200,6 +393,10 @@ func (c *Caching) unmarshalCaddyfileVaries(d *caddyfile.Dispenser) error {
 					}
 
 					vary.Cookies = args
+				case "claims":
+					if err := c.unmarshalCaddyfileVaryClaims(d.NewFromNextSegment(), vary); err != nil {
+						return err
+					}
 				default:
 					return d.Errf("unrecognized subdirective %s", d.Val())
 				}
@@ -214,6 +411,130 @@ func (c *Caching) unmarshalCaddyfileVaries(d *caddyfile.Dispenser) error {
 	return nil
 }
 
+func (c *Caching) unmarshalCaddyfileVaryClaims(d *caddyfile.Dispenser, vary *CachingVary) error {
+	claims := new(CachingVaryClaims)
+
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "header":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				claims.Header = d.Val()
+			case "cookie":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				claims.Cookie = d.Val()
+			case "jwks_file":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				claims.JWKSFile = d.Val()
+			case "key_file":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				claims.KeyFile = d.Val()
+			case "issuer":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				claims.Issuer = d.Val()
+			case "audience":
+				args := d.RemainingArgs()
+
+				if len(args) == 0 {
+					return d.ArgErr()
+				}
+
+				claims.Audience = args
+			case "names":
+				args := d.RemainingArgs()
+
+				if len(args) == 0 {
+					return d.ArgErr()
+				}
+
+				claims.Names = args
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+
+	vary.Claims = claims
+
+	return nil
+}
+
+func (c *Caching) unmarshalCaddyfileErrors(d *caddyfile.Dispenser) error {
+	cachingErrors := new(CachingErrors)
+
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "policy":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				cachingErrors.Policy = d.Val()
+			case "max_age":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return err
+				}
+
+				cachingErrors.MaxAge = caddy.Duration(v)
+			case "codes":
+				args := d.RemainingArgs()
+
+				if len(args) == 0 {
+					return d.ArgErr()
+				}
+
+				cachingErrors.Codes = args
+			case "negative_codes":
+				args := d.RemainingArgs()
+
+				if len(args) == 0 {
+					return d.ArgErr()
+				}
+
+				cachingErrors.NegativeCodes = args
+			case "negative_max_age":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return err
+				}
+
+				cachingErrors.NegativeMaxAge = caddy.Duration(v)
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+
+	c.Errors = cachingErrors
+
+	return nil
+}
+
 func (c *Caching) unmarshalCaddyfileTypeKeys(d *caddyfile.Dispenser) error {
 	fields := make(map[string]struct{})
 	typeKeys := make(graphql.RequestTypes)
@@ -239,3 +560,37 @@ func (c *Caching) unmarshalCaddyfileTypeKeys(d *caddyfile.Dispenser) error {
 
 	return nil
 }
+
+func (c *Caching) unmarshalCaddyfileCompression(d *caddyfile.Dispenser) error {
+	compression := new(CachingCompression)
+
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "algorithm":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				compression.Algorithm = d.Val()
+			case "min_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return err
+				}
+
+				compression.MinSize = v
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+
+	c.Compression = compression
+
+	return nil
+}
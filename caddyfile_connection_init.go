@@ -0,0 +1,83 @@
+package gbox
+
+import (
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// nolint:funlen,gocyclo
+func (h *Handler) unmarshalCaddyfileConnectionInit(d *caddyfile.Dispenser) error {
+	var disabled bool
+	connectionInit := &ConnectionInit{
+		Claims: make(map[string]string),
+	}
+
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "enabled":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return err
+				}
+
+				disabled = !v
+			case "required_keys":
+				args := d.RemainingArgs()
+
+				if len(args) == 0 {
+					return d.ArgErr()
+				}
+
+				connectionInit.RequiredKeys = args
+			case "jwt_key":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				connectionInit.JWTKey = d.Val()
+			case "jwks_file":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				connectionInit.JWKSFile = d.Val()
+			case "jwt_issuer":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				connectionInit.JWTIssuer = d.Val()
+			case "jwt_audience":
+				args := d.RemainingArgs()
+
+				if len(args) == 0 {
+					return d.ArgErr()
+				}
+
+				connectionInit.JWTAudience = args
+			case "claim":
+				args := d.RemainingArgs()
+
+				if len(args) != 2 {
+					return d.ArgErr()
+				}
+
+				connectionInit.Claims[args[0]] = args[1]
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+
+	if !disabled {
+		h.ConnectionInit = connectionInit
+	}
+
+	return nil
+}
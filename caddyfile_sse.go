@@ -0,0 +1,50 @@
+package gbox
+
+import (
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func (h *Handler) unmarshalCaddyfileSSE(d *caddyfile.Dispenser) error {
+	var disabled bool
+	sse := new(SSE)
+
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "enabled":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return err
+				}
+
+				disabled = !v
+			case "keep_alive_interval":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return err
+				}
+
+				sse.KeepAliveInterval = caddy.Duration(v)
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+
+	if !disabled {
+		h.SSE = sse
+	}
+
+	return nil
+}
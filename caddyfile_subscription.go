@@ -0,0 +1,100 @@
+package gbox
+
+import (
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func (h *Handler) unmarshalCaddyfileSubscription(d *caddyfile.Dispenser) error {
+	var disabled bool
+	subscription := new(Subscription)
+
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "enabled":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return err
+				}
+
+				disabled = !v
+			case "max_subscriptions":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return err
+				}
+
+				subscription.MaxSubscriptions = v
+			case "max_connections_per_client":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return err
+				}
+
+				subscription.MaxConnectionsPerClient = v
+			case "client_key":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				subscription.ClientKey = d.Val()
+			case "idle_timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return err
+				}
+
+				subscription.IdleTimeout = caddy.Duration(v)
+			case "max_messages_per_second":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return err
+				}
+
+				subscription.MaxMessagesPerSecond = v
+			case "translate_legacy_protocol":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return err
+				}
+
+				subscription.TranslateLegacyProtocol = v
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+
+	if !disabled {
+		h.Subscription = subscription
+	}
+
+	return nil
+}
@@ -19,6 +19,7 @@ func TestCaddyfile(t *testing.T) {
 		enabledCaching               string
 		enabledComplexity            string
 		enabledCachingAutoInvalidate string
+		enabledAPQ                   string
 	}{
 		"enabled_all_features": {
 			enabledCaching:               "true",
@@ -26,6 +27,7 @@ func TestCaddyfile(t *testing.T) {
 			enabledComplexity:            "true",
 			disabledIntrospection:        "false",
 			disabledPlaygrounds:          "false",
+			enabledAPQ:                   "true",
 		},
 		"disabled_all_features": {
 			enabledCaching:               "false",
@@ -33,6 +35,7 @@ func TestCaddyfile(t *testing.T) {
 			enabledComplexity:            "false",
 			disabledIntrospection:        "true",
 			disabledPlaygrounds:          "true",
+			enabledAPQ:                   "false",
 		},
 		"enabled_caching_and_disabled_caching_auto_invalidate": {
 			enabledCaching:               "true",
@@ -40,6 +43,7 @@ func TestCaddyfile(t *testing.T) {
 			enabledComplexity:            "false",
 			disabledIntrospection:        "true",
 			disabledPlaygrounds:          "true",
+			enabledAPQ:                   "false",
 		},
 	}
 
@@ -56,6 +60,10 @@ gbox {
 	}
 	disabled_playgrounds %s
 	disabled_introspection %s
+	apq {
+		enabled %s
+		max_age 1h
+	}
 	caching {
 		enabled %s
 		auto_invalidate_cache %s
@@ -65,17 +73,43 @@ gbox {
 				cookies session_id
 			}
 		}
+		invalidation {
+			delete_user {
+				fields deleteUser deleteUsers
+				types Post
+				type_fields {
+					User name
+				}
+				operation_names GetUsers
+				type_keys User:id:$id
+			}
+		}
 		rules {
 			rule1 {
 				max_age 10m
 			}
 			rule2 {
 				max_age 5m
+				variables first
+				ignore_variables trackingId
+				extensions locale
+			}
+			preview {
+				action pass
+				header x-preview true
+			}
+			web {
+				max_age 1m
+				operation_names Get* /^List(Users|Books)$/
+				exclude_operation_names GetMe
+				exclude_header x-debug
+				client_names web
+				client_versions 1.*
 			}
 		}
 	}
 }
-`, testCase.enabledComplexity, testCase.disabledPlaygrounds, testCase.disabledIntrospection, testCase.enabledCaching, testCase.enabledCachingAutoInvalidate))
+`, testCase.enabledComplexity, testCase.disabledPlaygrounds, testCase.disabledIntrospection, testCase.enabledAPQ, testCase.enabledCaching, testCase.enabledCachingAutoInvalidate))
 		require.NoErrorf(t, h.UnmarshalCaddyfile(d), "case %s: unmarshal caddy file error", name)
 		require.Equalf(t, h.Upstream, "http://localhost:9091", "case %s: invalid upstream", name)
 		require.NotNilf(t, h.RewriteRaw, "case %s: rewrite raw should be set", name)
@@ -86,6 +120,7 @@ gbox {
 		disabledPlaygrounds, _ := strconv.ParseBool(testCase.disabledPlaygrounds)
 		disabledIntrospection, _ := strconv.ParseBool(testCase.disabledIntrospection)
 		enabledCachingAutoInvalidate, _ := strconv.ParseBool(testCase.enabledCachingAutoInvalidate)
+		enabledAPQ, _ := strconv.ParseBool(testCase.enabledAPQ)
 
 		if enabledCaching {
 			rule1, rule1Exist := h.Caching.Rules["rule1"]
@@ -108,6 +143,12 @@ gbox {
 			require.Nilf(t, h.Complexity, "case %s: complexity should be nil if not enabled", name)
 		}
 
+		if enabledAPQ {
+			require.Equalf(t, caddy.Duration(time.Hour), h.APQ.MaxAge, "case %s: unexpected apq max age", name)
+		} else {
+			require.Nilf(t, h.APQ, "case %s: apq should be nil if not enabled", name)
+		}
+
 		require.Equalf(t, disabledIntrospection, h.DisabledIntrospection, "case %s: unexpected disabled introspection", name)
 		require.Equalf(t, disabledPlaygrounds, h.DisabledPlaygrounds, "case %s: unexpected disabled playgrounds", name)
 	}
@@ -206,6 +247,118 @@ complexity {
 `,
 			errorMsg: `unrecognized subdirective unknown`,
 		},
+		"unexpected_gbox_apq_subdirective": {
+			config: `
+apq {
+	unknown
+}
+`,
+			errorMsg: `unrecognized subdirective unknown`,
+		},
+		"invalid_syntax_gbox_apq_enabled": {
+			config: `
+apq {
+	enabled invalid
+}
+`,
+			errorMsg: `invalid syntax`,
+		},
+		"invalid_syntax_gbox_apq_max_age": {
+			config: `
+apq {
+	max_age invalid
+}
+`,
+			errorMsg: `invalid syntax`,
+		},
+		"unexpected_gbox_allowlist_subdirective": {
+			config: `
+allowlist {
+	unknown
+}
+`,
+			errorMsg: `unrecognized subdirective unknown`,
+		},
+		"unexpected_gbox_allowlist_mode": {
+			config: `
+allowlist {
+	mode unknown
+}
+`,
+			errorMsg: `unrecognized allowlist mode unknown`,
+		},
+		"blank_gbox_allowlist_manifests": {
+			config: `
+allowlist {
+	manifests
+}
+`,
+			errorMsg: `Wrong argument count`,
+		},
+		"unexpected_gbox_upload_subdirective": {
+			config: `
+upload {
+	unknown
+}
+`,
+			errorMsg: `unrecognized subdirective unknown`,
+		},
+		"invalid_syntax_gbox_upload_max_file_size": {
+			config: `
+upload {
+	max_file_size 10MB
+}
+`,
+			errorMsg: `invalid syntax`,
+		},
+		"unexpected_gbox_sse_subdirective": {
+			config: `
+sse {
+	unknown
+}
+`,
+			errorMsg: `unrecognized subdirective unknown`,
+		},
+		"invalid_syntax_gbox_sse_keep_alive_interval": {
+			config: `
+sse {
+	keep_alive_interval invalid
+}
+`,
+			errorMsg: `invalid syntax`,
+		},
+		"unexpected_gbox_connection_init_subdirective": {
+			config: `
+connection_init {
+	unknown
+}
+`,
+			errorMsg: `unrecognized subdirective unknown`,
+		},
+		"invalid_gbox_connection_init_claim": {
+			config: `
+connection_init {
+	claim sub
+}
+`,
+			errorMsg: `Wrong argument count`,
+		},
+		"unexpected_gbox_subscription_subdirective": {
+			config: `
+subscription {
+	unknown
+}
+`,
+			errorMsg: `unrecognized subdirective unknown`,
+		},
+		"invalid_syntax_gbox_subscription_max_subscriptions": {
+			config: `
+subscription {
+	max_subscriptions many
+}
+`,
+			errorMsg: `invalid syntax`,
+		},
 		"unexpected_gbox_caching_subdirective": {
 			config: `
 caching {
@@ -214,6 +367,26 @@ caching {
 `,
 			errorMsg: `unrecognized subdirective unknown`,
 		},
+		"unexpected_gbox_caching_errors_subdirective": {
+			config: `
+caching {
+	errors {
+		unknown
+	}
+}
+`,
+			errorMsg: `unrecognized subdirective unknown`,
+		},
+		"invalid_syntax_gbox_caching_compression_min_size": {
+			config: `
+caching {
+	compression {
+		min_size large
+	}
+}
+`,
+			errorMsg: `invalid syntax`,
+		},
 		"blank_gbox_caching_enabled": {
 			config: `
 caching {
@@ -283,6 +456,32 @@ caching {
 		}
 	}
 }
+`,
+			errorMsg: `unrecognized subdirective unknown`,
+		},
+		"unexpected_gbox_caching_vary_claims_subdirective": {
+			config: `
+caching {
+	varies {
+		a {
+			claims {
+				unknown
+			}
+		}
+	}
+}
+`,
+			errorMsg: `unrecognized subdirective unknown`,
+		},
+		"unexpected_gbox_caching_invalidation_subdirective": {
+			config: `
+caching {
+	invalidation {
+		a {
+			unknown
+		}
+	}
+}
 `,
 			errorMsg: `unrecognized subdirective unknown`,
 		},
@@ -0,0 +1,150 @@
+package gbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gobwas/ws"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	// wsStatusUnauthorized and wsStatusForbidden close codes are defined by graphql-transport-ws protocol.
+	wsStatusUnauthorized ws.StatusCode = 4401
+	wsStatusForbidden    ws.StatusCode = 4403
+
+	connectionInitStatusAccepted     = "accepted"
+	connectionInitStatusUnauthorized = "unauthorized"
+	connectionInitStatusForbidden    = "forbidden"
+)
+
+// wsCloseError closes websocket connection with the code given.
+type wsCloseError struct {
+	code   ws.StatusCode
+	reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return e.reason
+}
+
+// ConnectionInit authenticates websocket connections by payload of `connection_init` message.
+type ConnectionInit struct {
+	// Keys must be present in payload, connections missing them will be closed with 4401 code.
+	RequiredKeys []string `json:"required_keys,omitempty"`
+
+	// Payload key contains JWT (with or without `Bearer` prefix), token validation is disabled if not set.
+	JWTKey string `json:"jwt_key,omitempty"`
+
+	// JSON web key set file using to verify JWT signature.
+	JWKSFile string `json:"jwks_file,omitempty"`
+
+	// Expected `iss` claim of JWT, connections with unexpected issuer will be closed with 4403 code.
+	JWTIssuer string `json:"jwt_issuer,omitempty"`
+
+	// Expected `aud` claim of JWT, connections with unexpected audience will be closed with 4403 code.
+	JWTAudience []string `json:"jwt_audience,omitempty"`
+
+	// Claims of JWT will be set as headers of subscription requests, map key is claim name and value is header name,
+	// so they can be used by the same machinery as http request headers.
+	Claims map[string]string `json:"claims,omitempty"`
+
+	jwks *jose.JSONWebKeySet
+}
+
+func (c *ConnectionInit) provision() (err error) {
+	if c.JWKSFile == "" {
+		return nil
+	}
+
+	c.jwks, err = loadJSONWebKeySet(c.JWKSFile)
+
+	return err
+}
+
+func (c *ConnectionInit) validate() error {
+	if c.JWTKey != "" && c.JWKSFile == "" {
+		return errors.New("connection init jwks file must be set when jwt key is set")
+	}
+
+	if len(c.Claims) > 0 && c.JWTKey == "" {
+		return errors.New("connection init jwt key must be set when claims are set")
+	}
+
+	return nil
+}
+
+// authenticate validates payload of `connection_init` message, returns headers contains claims selected when succeed.
+func (c *ConnectionInit) authenticate(payload json.RawMessage) (http.Header, error) {
+	values := make(map[string]json.RawMessage)
+
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &values); err != nil {
+			return nil, &wsCloseError{code: wsStatusUnauthorized, reason: "invalid connection init payload"}
+		}
+	}
+
+	for _, key := range c.RequiredKeys {
+		if _, ok := values[key]; !ok {
+			return nil, &wsCloseError{code: wsStatusUnauthorized, reason: fmt.Sprintf("missing required key %s", key)}
+		}
+	}
+
+	header := make(http.Header)
+
+	if c.JWTKey == "" {
+		return header, nil
+	}
+
+	var token string
+
+	if err := json.Unmarshal(values[c.JWTKey], &token); err != nil || token == "" {
+		return nil, &wsCloseError{code: wsStatusUnauthorized, reason: "missing token"}
+	}
+
+	claims, err := verifyJWT(parseBearerToken(token), c.jwks, jwt.Expected{
+		Issuer:   c.JWTIssuer,
+		Audience: c.JWTAudience,
+	})
+
+	if errors.Is(err, jwt.ErrInvalidIssuer) || errors.Is(err, jwt.ErrInvalidAudience) {
+		return nil, &wsCloseError{code: wsStatusForbidden, reason: err.Error()}
+	}
+
+	if err != nil {
+		return nil, &wsCloseError{code: wsStatusUnauthorized, reason: err.Error()}
+	}
+
+	for claim, name := range c.Claims {
+		// header of missing claim is present without values, so the same header of handshake request will be removed.
+		header[http.CanonicalHeaderKey(name)] = claimValues(claims[claim])
+	}
+
+	return header, nil
+}
+
+func claimValues(claim interface{}) []string {
+	switch v := claim.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+
+		for _, item := range v {
+			values = append(values, claimValues(item)...)
+		}
+
+		return values
+	case map[string]interface{}:
+		data, _ := json.Marshal(v) // nolint:errchkjson
+
+		return []string{string(data)}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
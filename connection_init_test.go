@@ -0,0 +1,154 @@
+package gbox
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func newTestJWTSigner(t *testing.T) (jose.Signer, string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwk := jose.JSONWebKey{Key: key, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jwk}, (&jose.SignerOptions{}).WithType("JWT"))
+	require.NoError(t, err)
+
+	jwks, _ := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, ioutil.WriteFile(path, jwks, 0o600))
+
+	return signer, path
+}
+
+func newTestJWT(t *testing.T, signer jose.Signer, claims jwt.Claims, privateClaims map[string]interface{}) string {
+	t.Helper()
+
+	token, err := jwt.Signed(signer).Claims(claims).Claims(privateClaims).CompactSerialize()
+	require.NoError(t, err)
+
+	return token
+}
+
+func TestConnectionInit_Authenticate(t *testing.T) {
+	signer, jwksFile := newTestJWTSigner(t)
+	_, otherJWKSFile := newTestJWTSigner(t)
+	now := time.Now()
+	validToken := newTestJWT(t, signer, jwt.Claims{
+		Issuer: "gbox",
+		Expiry: jwt.NewNumericDate(now.Add(time.Hour)),
+	}, map[string]interface{}{"sub": "1", "roles": []string{"admin", "user"}})
+	otherClaimsToken := newTestJWT(t, signer, jwt.Claims{
+		Issuer: "gbox",
+		Expiry: jwt.NewNumericDate(now.Add(time.Hour)),
+	}, map[string]interface{}{"sub": "2"})
+	expiredToken := newTestJWT(t, signer, jwt.Claims{
+		Issuer: "gbox",
+		Expiry: jwt.NewNumericDate(now.Add(-time.Hour)),
+	}, nil)
+	otherIssuerToken := newTestJWT(t, signer, jwt.Claims{
+		Issuer: "other",
+		Expiry: jwt.NewNumericDate(now.Add(time.Hour)),
+	}, nil)
+
+	testCases := map[string]struct {
+		jwksFile       string
+		payload        string
+		expectedCode   int
+		expectedHeader map[string][]string
+	}{
+		"missing_required_key": {
+			payload:      `{"token": "` + validToken + `"}`,
+			expectedCode: int(wsStatusUnauthorized),
+		},
+		"missing_token": {
+			payload:      `{"tenant": "1"}`,
+			expectedCode: int(wsStatusUnauthorized),
+		},
+		"invalid_payload": {
+			payload:      `[]`,
+			expectedCode: int(wsStatusUnauthorized),
+		},
+		"expired_token": {
+			payload:      `{"tenant": "1", "token": "` + expiredToken + `"}`,
+			expectedCode: int(wsStatusUnauthorized),
+		},
+		"invalid_signature": {
+			jwksFile:     otherJWKSFile,
+			payload:      `{"tenant": "1", "token": "` + validToken + `"}`,
+			expectedCode: int(wsStatusUnauthorized),
+		},
+		"unexpected_issuer": {
+			payload:      `{"tenant": "1", "token": "` + otherIssuerToken + `"}`,
+			expectedCode: int(wsStatusForbidden),
+		},
+		"valid": {
+			payload: `{"tenant": "1", "token": "Bearer ` + validToken + `"}`,
+			expectedHeader: map[string][]string{
+				"X-User-Id":    {"1"},
+				"X-User-Roles": {"admin", "user"},
+			},
+		},
+		"missing_claim": {
+			payload: `{"tenant": "1", "token": "` + otherClaimsToken + `"}`,
+			expectedHeader: map[string][]string{
+				"X-User-Id":    {"2"},
+				"X-User-Roles": nil,
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		c := &ConnectionInit{
+			RequiredKeys: []string{"tenant"},
+			JWTKey:       "token",
+			JWKSFile:     jwksFile,
+			JWTIssuer:    "gbox",
+			Claims: map[string]string{
+				"sub":   "x-user-id",
+				"roles": "x-user-roles",
+			},
+		}
+
+		if testCase.jwksFile != "" {
+			c.JWKSFile = testCase.jwksFile
+		}
+
+		require.NoError(t, c.validate())
+		require.NoError(t, c.provision())
+
+		header, err := c.authenticate(json.RawMessage(testCase.payload))
+
+		if testCase.expectedCode != 0 {
+			closeErr := new(wsCloseError)
+			require.ErrorAsf(t, err, &closeErr, "case %s: should be close error", name)
+			require.Equalf(t, testCase.expectedCode, int(closeErr.code), "case %s: unexpected close code", name)
+
+			continue
+		}
+
+		require.NoErrorf(t, err, "case %s: unexpected error", name)
+
+		for headerName, values := range testCase.expectedHeader {
+			_, ok := header[headerName]
+			require.Truef(t, ok, "case %s: header %s should be present even when claim missing", name, headerName)
+			require.Equalf(t, values, header.Values(headerName), "case %s: unexpected header %s", name, headerName)
+		}
+	}
+}
+
+func TestConnectionInit_Validate(t *testing.T) {
+	require.Error(t, (&ConnectionInit{JWTKey: "token"}).validate())
+	require.Error(t, (&ConnectionInit{Claims: map[string]string{"sub": "x-user-id"}}).validate())
+	require.NoError(t, (&ConnectionInit{RequiredKeys: []string{"token"}}).validate())
+}
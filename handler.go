@@ -18,6 +18,7 @@ import (
 const (
 	errorReporterCtxKey caddy.CtxKey = "gbox_error_wrapper"
 	nextHandlerCtxKey   caddy.CtxKey = "gbox_caddy_handler"
+	upstreamWaitCtxKey  caddy.CtxKey = "gbox_upstream_wait"
 )
 
 func init() { // nolint:gochecknoinits
@@ -56,6 +57,27 @@ type Handler struct {
 	// Caching queries result settings, disabled by default.
 	Caching *Caching `json:"caching,omitempty"`
 
+	// Automatic persisted queries settings, disabled by default.
+	APQ *APQ `json:"apq,omitempty"`
+
+	// Batching settings, requests contain array of operations will be rejected if not set.
+	Batching *Batching `json:"batching,omitempty"`
+
+	// Trusted documents settings, only operations in allowlist can be executed, disabled by default.
+	Allowlist *Allowlist `json:"allowlist,omitempty"`
+
+	// File uploads settings, multipart requests will be rejected if not set.
+	Upload *Upload `json:"upload,omitempty"`
+
+	// Server-sent events settings, requests accept `text/event-stream` will be handled as normal requests if not set.
+	SSE *SSE `json:"sse,omitempty"`
+
+	// Websocket connection init payload authentication settings, disabled by default.
+	ConnectionInit *ConnectionInit `json:"connection_init,omitempty"`
+
+	// Subscriptions limits settings, disabled by default.
+	Subscription *Subscription `json:"subscription,omitempty"`
+
 	// Cors origins
 	CORSOrigins []string `json:"cors_origins,omitempty"`
 
@@ -121,6 +143,28 @@ func (h *Handler) Provision(ctx caddy.Context) (err error) {
 		h.Caching.withMetrics(h)
 	}
 
+	if h.APQ != nil {
+		if err = h.APQ.provision(h.Caching); err != nil {
+			return err
+		}
+	}
+
+	if h.Allowlist != nil {
+		if err = h.Allowlist.provision(); err != nil {
+			return err
+		}
+	}
+
+	if h.ConnectionInit != nil {
+		if err = h.ConnectionInit.provision(); err != nil {
+			return err
+		}
+	}
+
+	if h.Subscription != nil {
+		h.Subscription.provision()
+	}
+
 	if h.FetchSchemaTimeout == 0 {
 		timeout, _ := caddy.ParseDuration("30s")
 		h.FetchSchemaTimeout = caddy.Duration(timeout)
@@ -145,6 +189,18 @@ func (h *Handler) Provision(ctx caddy.Context) (err error) {
 }
 
 func (h *Handler) Validate() error {
+	if h.Allowlist != nil {
+		if err := h.Allowlist.validate(); err != nil {
+			return err
+		}
+	}
+
+	if h.ConnectionInit != nil {
+		if err := h.ConnectionInit.validate(); err != nil {
+			return err
+		}
+	}
+
 	if h.Caching != nil {
 		if err := h.Caching.Validate(); err != nil {
 			return err
@@ -161,7 +217,7 @@ func (h *Handler) onSchemaChanged(oldSchemaDocument, newSchemaDocument *ast.Docu
 	if h.Caching != nil && oldSchema != nil {
 		h.logger.Info("schema changed: purge all query result cached of old schema")
 
-		if err := h.Caching.PurgeQueryResultBySchema(h.ctxBackground, oldSchema); err != nil {
+		if err := h.Caching.PurgeQueryResultBySchema(h.ctxBackground, oldSchema, false); err != nil {
 			h.logger.Error("purge all query result failed", zap.Error(err))
 		}
 	}
@@ -170,6 +226,12 @@ func (h *Handler) onSchemaChanged(oldSchemaDocument, newSchemaDocument *ast.Docu
 func (h *Handler) Cleanup() error {
 	h.ctxBackgroundCancel()
 
+	if h.APQ != nil {
+		if err := h.APQ.cleanup(); err != nil {
+			return err
+		}
+	}
+
 	if h.Caching != nil {
 		return h.Caching.Cleanup()
 	}
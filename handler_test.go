@@ -1,11 +1,17 @@
 package gbox
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -445,7 +451,7 @@ func (s *HandlerIntegrationTestSuite) TestCachingEnabledAutoInvalidate() {
 		{
 			name:                "mutation_invalidate_query_result",
 			expectedBody:        `{"data":{"updateUsers":[{"id":1},{"id":2}]}}`,
-			expectedPurgingTags: `key:UserTest:id:1; key:UserTest:id:2`,
+			expectedPurgingTags: `key:UserTest:id:1, key:UserTest:id:2`,
 			payload:             mutationPayload,
 		},
 		{
@@ -965,6 +971,10 @@ func (s *HandlerIntegrationTestSuite) TestAdminPurgeQueryResult() {
 			name:       "purge_by_query_root_field",
 			mutationOp: `{"query": "mutation { result: purgeQueryRootField(field: \"users\") }"}`,
 		},
+		{
+			name:       "soft_purge_by_type",
+			mutationOp: `{"query": "mutation { result: purgeType(type: \"UserTest\", soft: true) }"}`,
+		},
 	}
 	tester := caddytest.NewTester(s.T())
 	tester.InitServer(pureCaddyfile, "caddyfile")
@@ -1148,6 +1158,424 @@ caching {
 	}
 }
 
+func (s *HandlerIntegrationTestSuite) TestAPQ() {
+	const hash = "f5b8bf4ecd9b8c5b1d4e5a2e7ee7fb3a1a2bbd6b58f1b1af01b3c0f1b2b44a3e"
+	query := `query GetUsers { users { name } }`
+	sum := sha256.Sum256([]byte(query))
+	validHash := hex.EncodeToString(sum[:])
+	testCases := []struct {
+		name         string
+		extraConfig  string
+		payload      string
+		expectedBody string
+	}{
+		{
+			name:         "not_found",
+			extraConfig:  `apq`,
+			payload:      fmt.Sprintf(`{"extensions":{"persistedQuery":{"version":1,"sha256Hash":"%s"}}}`, validHash),
+			expectedBody: `{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`,
+		},
+		{
+			name:         "hash_mismatch",
+			extraConfig:  `apq`,
+			payload:      fmt.Sprintf(`{"query":"%s","extensions":{"persistedQuery":{"version":1,"sha256Hash":"%s"}}}`, query, hash),
+			expectedBody: `{"errors":[{"message":"provided sha does not match query"}]}`,
+		},
+		{
+			name:         "register",
+			extraConfig:  `apq`,
+			payload:      fmt.Sprintf(`{"query":"%s","extensions":{"persistedQuery":{"version":1,"sha256Hash":"%s"}}}`, query, validHash),
+			expectedBody: `{"data":{"users":[{"name":"A"},{"name":"B"},{"name":"C"}]}}`,
+		},
+		{
+			name:         "found",
+			extraConfig:  `apq`,
+			payload:      fmt.Sprintf(`{"extensions":{"persistedQuery":{"version":1,"sha256Hash":"%s"}}}`, validHash),
+			expectedBody: `{"data":{"users":[{"name":"A"},{"name":"B"},{"name":"C"}]}}`,
+		},
+		{
+			name: "found_with_caching",
+			extraConfig: `
+apq
+caching {
+	rules {
+		default {
+			max_age 1h
+		}
+	}
+}
+`,
+			payload:      fmt.Sprintf(`{"extensions":{"persistedQuery":{"version":1,"sha256Hash":"%s"}}}`, validHash),
+			expectedBody: `{"data":{"users":[{"name":"A"},{"name":"B"},{"name":"C"}]}}`,
+		},
+	}
+
+	tester := caddytest.NewTester(s.T())
+	tester.InitServer(pureCaddyfile, "caddyfile")
+
+	for _, testCase := range testCases {
+		tester.InitServer(fmt.Sprintf(caddyfilePattern, testCase.extraConfig), "caddyfile")
+
+		r, _ := http.NewRequest(
+			"POST",
+			"http://localhost:9090/graphql",
+			strings.NewReader(testCase.payload),
+		)
+		r.Header.Add("content-type", "application/json")
+		resp := tester.AssertResponseCode(r, http.StatusOK)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		s.Require().Equalf(testCase.expectedBody, string(body), "case %s: unexpected response body", testCase.name)
+	}
+}
+
+func (s *HandlerIntegrationTestSuite) TestAllowlist() {
+	dir := s.T().TempDir()
+	manifest := filepath.Join(dir, "manifest.json")
+	s.Require().NoError(ioutil.WriteFile(manifest, []byte(`{"users": "query GetUsers { users { name } }"}`), 0o600))
+
+	testCases := []struct {
+		name         string
+		mode         string
+		payload      string
+		expectedBody string
+	}{
+		{
+			name:         "enforce_allowed",
+			mode:         AllowlistModeEnforce,
+			payload:      `{"query": "query GetUsers { users { name } }"}`,
+			expectedBody: `{"data":{"users":[{"name":"A"},{"name":"B"},{"name":"C"}]}}`,
+		},
+		{
+			name:         "enforce_allowed_by_document_id",
+			mode:         AllowlistModeEnforce,
+			payload:      `{"documentId": "users"}`,
+			expectedBody: `{"data":{"users":[{"name":"A"},{"name":"B"},{"name":"C"}]}}`,
+		},
+		{
+			name:         "enforce_rejected",
+			mode:         AllowlistModeEnforce,
+			payload:      `{"query": "query GetBooks { books { title } }"}`,
+			expectedBody: `{"errors":[{"message":"operation is not in allowlist"}]}`,
+		},
+		{
+			name:         "log_only_not_rejected",
+			mode:         AllowlistModeLogOnly,
+			payload:      `{"query": "query GetUserIds { users { id } }"}`,
+			expectedBody: `{"data":{"users":[{"id":1},{"id":2},{"id":3}]}}`,
+		},
+	}
+
+	tester := caddytest.NewTester(s.T())
+	tester.InitServer(pureCaddyfile, "caddyfile")
+
+	for _, testCase := range testCases {
+		tester.InitServer(fmt.Sprintf(caddyfilePattern, fmt.Sprintf(`
+allowlist {
+	mode %s
+	manifests %s
+}
+`, testCase.mode, manifest)), "caddyfile")
+
+		r, _ := http.NewRequest(
+			"POST",
+			"http://localhost:9090/graphql",
+			strings.NewReader(testCase.payload),
+		)
+		r.Header.Add("content-type", "application/json")
+		resp := tester.AssertResponseCode(r, http.StatusOK)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		s.Require().Equalf(testCase.expectedBody, string(body), "case %s: unexpected response body", testCase.name)
+	}
+
+	metric := &dto.Metric{}
+	metrics.allowlistRejectedCount.With(map[string]string{
+		"operation_name": "GetUserIds",
+		"mode":           AllowlistModeLogOnly,
+	}).Write(metric)
+
+	s.Require().Equal(1.0, metric.Counter.GetValue(), "unexpected allowlist rejected metrics")
+}
+
+func (s *HandlerIntegrationTestSuite) TestGETRequest() {
+	testCases := []struct {
+		name                  string
+		query                 url.Values
+		expectedStatus        int
+		expectedBody          string
+		expectedCachingStatus CachingStatus
+	}{
+		{
+			name: "query_first_time_cache_will_miss",
+			query: url.Values{
+				"query":         []string{`query GetUsers { users { name } }`},
+				"operationName": []string{"GetUsers"},
+				"variables":     []string{`{}`},
+			},
+			expectedStatus:        http.StatusOK,
+			expectedBody:          `{"data":{"users":[{"name":"A"},{"name":"B"},{"name":"C"}]}}`,
+			expectedCachingStatus: CachingStatusMiss,
+		},
+		{
+			name: "query_next_time_cache_will_hit",
+			query: url.Values{
+				"query":         []string{`query GetUsers { users { name } }`},
+				"operationName": []string{"GetUsers"},
+				"variables":     []string{`{}`},
+			},
+			expectedStatus:        http.StatusOK,
+			expectedBody:          `{"data":{"users":[{"name":"A"},{"name":"B"},{"name":"C"}]}}`,
+			expectedCachingStatus: CachingStatusHit,
+		},
+		{
+			name: "mutation_not_allowed",
+			query: url.Values{
+				"query": []string{`mutation { updateUsers { id } }`},
+			},
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   `{"errors":[{"message":"only query operations can be executed over GET request"}]}`,
+		},
+		{
+			name: "invalid_variables",
+			query: url.Values{
+				"query":     []string{`query GetUsers { users { name } }`},
+				"variables": []string{`{`},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"errors\":[{\"message\":\"`variables` param should be valid json\"}]}",
+		},
+	}
+
+	tester := caddytest.NewTester(s.T())
+	tester.InitServer(pureCaddyfile, "caddyfile")
+	tester.InitServer(fmt.Sprintf(caddyfilePattern, `
+caching {
+	rules {
+		default {
+			max_age 1h
+		}
+	}
+}
+`), "caddyfile")
+
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(
+			"GET",
+			"http://localhost:9090/graphql?"+testCase.query.Encode(),
+			nil,
+		)
+		resp := tester.AssertResponseCode(r, testCase.expectedStatus)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		s.Require().Equalf(testCase.expectedBody, string(body), "case %s: unexpected response body", testCase.name)
+		s.Require().Equalf(string(testCase.expectedCachingStatus), resp.Header.Get("x-cache"), "case %s: unexpected caching status", testCase.name)
+
+		if testCase.expectedCachingStatus == CachingStatusHit {
+			s.Require().Equalf("public, s-maxage=3600", resp.Header.Get("cache-control"), "case %s: unexpected cache control", testCase.name)
+			s.Require().NotEmptyf(resp.Header.Get("age"), "case %s: age should be set", testCase.name)
+		}
+	}
+}
+
+func (s *HandlerIntegrationTestSuite) TestBatching() {
+	const payload = `[
+	{"query": "query GetUsers { users { name } }"},
+	{"query": "query GetBooks { books { title } }"},
+	{"query": "query GetUsers { users { name } }"}
+]`
+	testCases := []struct {
+		name                   string
+		extraConfig            string
+		payload                string
+		expectedBody           string
+		expectedCachingStatues []string
+	}{
+		{
+			name: "max_size_exceeded",
+			extraConfig: `
+batching {
+	max_size 2
+}
+`,
+			payload:      payload,
+			expectedBody: `{"errors":[{"message":"batch max size is 2, current 3"}]}`,
+		},
+		{
+			name: "empty_batch",
+			extraConfig: `
+batching
+`,
+			payload:      `[]`,
+			expectedBody: `{"errors":[{"message":"batch request must contain at least one operation"}]}`,
+		},
+		{
+			name: "invalid_operation",
+			extraConfig: `
+batching
+`,
+			payload:      `[{"query": "query GetUsers { users { name } }"}, {"query": "query {"}]`,
+			expectedBody: `[{"data":{"users":[{"name":"A"},{"name":"B"},{"name":"C"}]}},{"errors":[{"message":"unexpected token - got: EOF want one of: [RBRACE IDENT SPREAD]","locations":[{"line":0,"column":0}]}]}]`,
+		},
+		{
+			name: "caching_first_time",
+			extraConfig: `
+batching
+caching {
+	rules {
+		users {
+			types {
+				UserTest
+			}
+			max_age 1h
+		}
+	}
+}
+`,
+			payload:                `[{"query": "query GetUsers { users { name } }"}]`,
+			expectedBody:           `[{"data":{"users":[{"name":"A"},{"name":"B"},{"name":"C"}]}}]`,
+			expectedCachingStatues: []string{"MISS"},
+		},
+		{
+			name:                   "caching_next_time",
+			payload:                `[{"query": "query GetBooks { books { title } }"}, {"query": "query GetUsers { users { name } }"}]`,
+			expectedBody:           `[{"data":{"books":[{"title":"A - Book 1"},{"title":"A - Book 2"},{"title":"B - Book 1"},{"title":"C - Book 1"}]}},{"data":{"users":[{"name":"A"},{"name":"B"},{"name":"C"}]}}]`,
+			expectedCachingStatues: []string{"PASS", "HIT"},
+		},
+	}
+
+	tester := caddytest.NewTester(s.T())
+	tester.InitServer(pureCaddyfile, "caddyfile")
+
+	for _, testCase := range testCases {
+		if testCase.extraConfig != "" {
+			tester.InitServer(fmt.Sprintf(caddyfilePattern, testCase.extraConfig), "caddyfile")
+		}
+
+		r, _ := http.NewRequest(
+			"POST",
+			"http://localhost:9090/graphql",
+			strings.NewReader(testCase.payload),
+		)
+		r.Header.Add("content-type", "application/json")
+		resp := tester.AssertResponseCode(r, http.StatusOK)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		s.Require().Equalf(testCase.expectedBody, string(body), "case %s: unexpected response body", testCase.name)
+
+		if testCase.expectedCachingStatues != nil {
+			s.Require().Equalf(testCase.expectedCachingStatues, resp.Header.Values("x-cache"), "case %s: unexpected caching statues", testCase.name)
+		}
+	}
+}
+
+func (s *HandlerIntegrationTestSuite) TestUpload() {
+	testCases := []struct {
+		name           string
+		extraConfig    string
+		operations     string
+		fileSize       int
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "disabled",
+			extraConfig:    `fetch_schema_interval 10m`,
+			operations:     `{"query": "query GetUsers { users { name } }", "variables": {"file": null}}`,
+			fileSize:       10,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name: "passthrough",
+			extraConfig: `
+upload {
+	max_file_size 1024
+	max_files 1
+}
+`,
+			operations:     `{"query": "query GetUsers { users { name } }", "variables": {"file": null}}`,
+			fileSize:       1024,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"users":[{"name":"A"},{"name":"B"},{"name":"C"}]}}`,
+		},
+		{
+			name:           "introspection",
+			operations:     `{"query": "query { __schema { queryType { name } } }", "variables": {"file": null}}`,
+			fileSize:       10,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"errors":[{"message":"introspection query is not allowed"}]}`,
+		},
+		{
+			name:           "max_file_size_exceeded",
+			operations:     `{"query": "query GetUsers { users { name } }", "variables": {"file": null}}`,
+			fileSize:       1025 * 1024,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   `{"errors":[{"message":"upload max file size is 1024 bytes, file file.txt exceeded"}]}`,
+		},
+	}
+
+	tester := caddytest.NewTester(s.T())
+	tester.InitServer(pureCaddyfile, "caddyfile")
+
+	for _, testCase := range testCases {
+		if testCase.extraConfig != "" {
+			tester.InitServer(fmt.Sprintf(caddyfilePattern, "disabled_introspection true\n"+testCase.extraConfig), "caddyfile")
+		}
+
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		mw.WriteField("operations", testCase.operations)
+		mw.WriteField("map", `{"0": ["variables.file"]}`)
+		fw, _ := mw.CreateFormFile("0", "file.txt")
+		fw.Write(bytes.Repeat([]byte("a"), testCase.fileSize))
+		mw.Close()
+
+		r, _ := http.NewRequest(
+			"POST",
+			"http://localhost:9090/graphql",
+			body,
+		)
+		r.Header.Add("content-type", mw.FormDataContentType())
+		resp := tester.AssertResponseCode(r, testCase.expectedStatus)
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if testCase.expectedBody != "" {
+			s.Require().Equalf(testCase.expectedBody, string(respBody), "case %s: unexpected response body", testCase.name)
+		}
+	}
+}
+
+func (s *HandlerIntegrationTestSuite) TestSSE() {
+	tester := caddytest.NewTester(s.T())
+	tester.InitServer(fmt.Sprintf(caddyfilePattern, `sse`), "caddyfile")
+
+	r, _ := http.NewRequest(
+		"GET",
+		"http://localhost:9090/graphql?query="+url.QueryEscape("query GetUsers { users { name } }"),
+		nil,
+	)
+	r.Header.Add("accept", "text/event-stream")
+	resp := tester.AssertResponseCode(r, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	s.Require().Equal("text/event-stream", resp.Header.Get("content-type"))
+	s.Require().Equal("event: next\ndata: {\"data\":{\"users\":[{\"name\":\"A\"},{\"name\":\"B\"},{\"name\":\"C\"}]}}\n\nevent: complete\ndata: \n\n", string(body))
+
+	r, _ = http.NewRequest(
+		"GET",
+		"http://localhost:9090/graphql?query="+url.QueryEscape("mutation { updateUsers { name } }"),
+		nil,
+	)
+	r.Header.Add("accept", "text/event-stream")
+	tester.AssertResponseCode(r, http.StatusMethodNotAllowed)
+}
+
 func TestHandlerIntegration(t *testing.T) {
 	h := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: &testserver.Resolver{}}))
 	s := &http.Server{
@@ -0,0 +1,138 @@
+package gbox
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+var (
+	ErrJWTKeyNotFound         = errors.New("jwt signing key not found")
+	ErrJWTInvalidSignature    = errors.New("jwt signature is invalid")
+	ErrJWTUnsupportedKeyUsage = errors.New("jwt signing key must be used for signature")
+	ErrJWTEmptyKey            = errors.New("jwt signing key is empty")
+)
+
+func loadJSONWebKeySet(path string) (*jose.JSONWebKeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := new(jose.JSONWebKeySet)
+
+	if err = json.Unmarshal(data, keys); err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			return nil, ErrJWTUnsupportedKeyUsage
+		}
+	}
+
+	return keys, nil
+}
+
+// loadJSONWebKey loads single key file as key set, PEM encoded RSA or EC public keys and certificates are supported,
+// otherwise content of file will be used as HMAC secret.
+func loadJSONWebKey(path string) (*jose.JSONWebKeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key interface{}
+
+	if block, _ := pem.Decode(data); block != nil {
+		switch block.Type {
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				key = cert.PublicKey
+			}
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		default:
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		secret := bytes.TrimSpace(data)
+
+		if len(secret) == 0 {
+			return nil, ErrJWTEmptyKey
+		}
+
+		key = secret
+	}
+
+	return &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: key, Use: "sig"}}}, nil
+}
+
+// parseBearerToken returns token without `Bearer` prefix.
+func parseBearerToken(value string) string {
+	value = strings.TrimSpace(value)
+
+	if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+		return strings.TrimSpace(value[7:])
+	}
+
+	return value
+}
+
+// verifyJWT verifies signature of token by keys given, validates registered claims and returns all claims of token.
+// Keys will be matched by `kid` header of token if it's present, otherwise all keys will be tried.
+func verifyJWT(token string, keys *jose.JSONWebKeySet, expected jwt.Expected) (map[string]interface{}, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := keys.Keys
+
+	for _, header := range parsed.Headers {
+		if header.KeyID != "" {
+			candidates = keys.Key(header.KeyID)
+
+			break
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrJWTKeyNotFound
+	}
+
+	registeredClaims := new(jwt.Claims)
+	claims := make(map[string]interface{})
+
+	for i := range candidates {
+		if err = parsed.Claims(&candidates[i], registeredClaims, &claims); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, ErrJWTInvalidSignature
+	}
+
+	expected.Time = time.Now()
+
+	if err = registeredClaims.Validate(expected); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
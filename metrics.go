@@ -1,6 +1,7 @@
 package gbox
 
 import (
+	"errors"
 	"sync"
 	"time"
 
@@ -45,6 +46,35 @@ func init() { // nolint:gochecknoinits
 			Name:      "caching_total",
 			Help:      "Counter of graphql query operations caching statues.",
 		}, cachingLabels)
+
+		metrics.cachingCoalescedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "caching_coalesced_total",
+			Help:      "Counter of graphql query operations missing cache served by identical in-flight requests.",
+		}, []string{"operation_name"})
+
+		allowlistLabels := []string{"operation_name", "mode"}
+		metrics.allowlistRejectedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "allowlist_rejected_total",
+			Help:      "Counter of graphql operations not in allowlist.",
+		}, allowlistLabels)
+
+		metrics.connectionInitCount = promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "ws_connection_init_total",
+			Help:      "Counter of websocket connection init authentication statuses.",
+		}, []string{"status"})
+
+		metrics.subscriptionLimitExceededCount = promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Subsystem: sub,
+			Name:      "subscription_limit_exceeded_total",
+			Help:      "Counter of subscription limits violations.",
+		}, []string{"limit"})
 	})
 }
 
@@ -54,10 +84,17 @@ type Metrics struct {
 	operationCount    *prometheus.CounterVec
 	operationDuration *prometheus.HistogramVec
 	cachingCount      *prometheus.CounterVec
+
+	cachingCoalescedCount  *prometheus.CounterVec
+	allowlistRejectedCount *prometheus.CounterVec
+	connectionInitCount    *prometheus.CounterVec
+
+	subscriptionLimitExceededCount *prometheus.CounterVec
 }
 
 type cachingMetrics interface {
 	addMetricsCaching(*graphql.Request, CachingStatus)
+	addMetricsCachingCoalesced(*graphql.Request)
 }
 
 func (h *Handler) addMetricsBeginRequest(request *graphql.Request) {
@@ -95,6 +132,36 @@ func (h *Handler) addMetricsCaching(request *graphql.Request, status CachingStat
 	h.metrics.cachingCount.With(labels).Inc()
 }
 
+func (h *Handler) addMetricsCachingCoalesced(request *graphql.Request) {
+	h.metrics.cachingCoalescedCount.With(map[string]string{"operation_name": request.OperationName}).Inc()
+}
+
+func (h *Handler) addMetricsAllowlistRejected(request *graphql.Request, mode string) {
+	labels := map[string]string{
+		"operation_name": request.OperationName,
+		"mode":           mode,
+	}
+
+	h.metrics.allowlistRejectedCount.With(labels).Inc()
+}
+
+func (h *Handler) addMetricsConnectionInit(err error) {
+	status := connectionInitStatusAccepted
+	closeErr := new(wsCloseError)
+
+	if errors.As(err, &closeErr) && closeErr.code == wsStatusForbidden {
+		status = connectionInitStatusForbidden
+	} else if err != nil {
+		status = connectionInitStatusUnauthorized
+	}
+
+	h.metrics.connectionInitCount.With(map[string]string{"status": status}).Inc()
+}
+
+func (h *Handler) addMetricsSubscriptionLimitExceeded(limit string) {
+	h.metrics.subscriptionLimitExceededCount.With(map[string]string{"limit": limit}).Inc()
+}
+
 func (h *Handler) metricsCachingLabels(request *graphql.Request, status CachingStatus) (map[string]string, error) {
 	if !request.IsNormalized() {
 		if result, _ := request.Normalize(h.schema); !result.Successful {
@@ -2,9 +2,12 @@ package gbox
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
@@ -25,17 +28,29 @@ const (
 	graphQLPath         = "/graphql"
 )
 
-var ErrNotAllowIntrospectionQuery = errors.New("introspection query is not allowed")
+var (
+	ErrNotAllowIntrospectionQuery  = errors.New("introspection query is not allowed")
+	ErrNotAllowOperation           = errors.New("operation is not in allowlist")
+	ErrNotAllowGETRequestOperation = errors.New("only query operations can be executed over GET request")
+)
 
 func (h *Handler) initRouter() {
 	router := mux.NewRouter()
 	router.Path(graphQLPath).HeadersRegexp(
 		"content-type", "application/json*",
 	).Methods("POST").HandlerFunc(h.GraphQLHandle)
+
+	if h.Upload != nil {
+		router.Path(graphQLPath).HeadersRegexp(
+			"content-type", "^multipart/form-data",
+		).Methods("POST").HandlerFunc(h.GraphQLHandle)
+	}
+
 	router.Path(graphQLPath).HeadersRegexp(
 		"upgrade", "^websocket$",
 		"sec-websocket-protocol", "^graphql-(transport-)?ws$",
 	).Methods("GET").HandlerFunc(h.GraphQLOverWebsocketHandle)
+	router.Path(graphQLPath).Methods("GET").HandlerFunc(h.GraphQLHandle)
 
 	if h.Caching != nil {
 		router.Path(adminGraphQLPath).HeadersRegexp(
@@ -76,8 +91,32 @@ func (h *Handler) GraphQLOverWebsocketHandle(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if h.Subscription != nil {
+		release, ok := h.Subscription.acquireConnection(r)
+
+		if !ok {
+			h.addMetricsSubscriptionLimitExceeded(subscriptionLimitMaxConnections)
+			reporter.error = writeResponseErrorsWithStatus(ErrSubscriptionMaxConnectionsExceeded, http.StatusTooManyRequests, w)
+
+			return
+		}
+
+		defer release()
+	}
+
+	header := r.Header.Clone()
+	translate := h.Subscription != nil && h.Subscription.TranslateLegacyProtocol &&
+		r.Header.Get("Sec-Websocket-Protocol") == wsLegacyProtocol
+
+	if translate {
+		r.Header.Set("Sec-Websocket-Protocol", wsTransportProtocol)
+	}
+
+	// compressed messages can not be inspected, so extensions will not be negotiated with upstream.
+	r.Header.Del("Sec-Websocket-Extensions")
+
 	n := r.Context().Value(nextHandlerCtxKey).(caddyhttp.Handler)
-	wsr := newWebsocketResponseWriter(w, h)
+	wsr := newWebsocketResponseWriter(w, h, header, h.Subscription, translate, h.ConnectionInit != nil)
 	reporter.error = h.ReverseProxy.ServeHTTP(wsr, r, n)
 }
 
@@ -91,18 +130,51 @@ func (h *Handler) GraphQLHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	n := r.Context().Value(nextHandlerCtxKey).(caddyhttp.Handler)
+	reverse := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return h.ReverseProxy.ServeHTTP(w, r, n)
+	})
+
+	if h.Upload != nil && isMultipartHTTPRequest(r) {
+		reporter.error = h.handleUploadRequest(w, r, reverse)
+
+		return
+	}
+
+	if h.SSE != nil && isSSEHTTPRequest(r) {
+		reporter.error = h.handleSSERequest(w, r, reverse)
+
+		return
+	}
+
+	if h.Batching != nil && isBatchHTTPRequest(r) {
+		reporter.error = h.handleBatchRequest(w, r, reverse)
+
+		return
+	}
+
+	reporter.error = h.handleRequest(w, r, reverse)
+}
+
+// handleRequest validate, collect metrics and caching GraphQL request before forwarding it to upstream via handler given.
+func (h *Handler) handleRequest(w http.ResponseWriter, r *http.Request, upstream caddyhttp.HandlerFunc) error {
+	isGETRequest := r.Method == http.MethodGet
 	gqlRequest, err := h.unmarshalHTTPRequest(r)
 	if err != nil {
 		h.logger.Debug("can not unmarshal graphql request from http request", zap.Error(err))
-		reporter.error = writeResponseErrors(err, w)
 
-		return
+		return writeResponseErrors(err, w)
 	}
 
-	if err = h.validateGraphqlRequest(gqlRequest); err != nil {
-		reporter.error = writeResponseErrors(err, w)
+	// https://github.com/graphql/graphql-over-http/blob/main/spec/GraphQLOverHTTP.md#get
+	if operationType, _ := gqlRequest.OperationType(); isGETRequest && operationType != graphql.OperationTypeQuery {
+		w.Header().Set("allow", http.MethodPost)
 
-		return
+		return writeResponseErrorsWithStatus(ErrNotAllowGETRequestOperation, http.StatusMethodNotAllowed, w)
+	}
+
+	if err = h.validateGraphqlRequest(gqlRequest); err != nil {
+		return writeResponseErrors(err, w)
 	}
 
 	h.addMetricsBeginRequest(gqlRequest)
@@ -110,27 +182,26 @@ func (h *Handler) GraphQLHandle(w http.ResponseWriter, r *http.Request) {
 		h.addMetricsEndRequest(gqlRequest, time.Since(startedAt))
 	}(time.Now())
 
-	n := r.Context().Value(nextHandlerCtxKey).(caddyhttp.Handler)
-
 	if h.Caching != nil {
 		cachingRequest := newCachingRequest(r, h.schemaDocument, h.schema, gqlRequest)
-		reverse := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
-			return h.ReverseProxy.ServeHTTP(w, r, n)
-		})
-
-		if err = h.Caching.HandleRequest(w, cachingRequest, reverse); err != nil {
-			reporter.error = writeResponseErrors(err, w)
 
-			return
+		if err = h.Caching.HandleRequest(w, cachingRequest, upstream); err != nil {
+			return writeResponseErrors(err, w)
 		}
 
-		return
+		return nil
 	}
 
-	reporter.error = h.ReverseProxy.ServeHTTP(w, r, n)
+	return upstream(w, r)
 }
 
 func (h *Handler) unmarshalHTTPRequest(r *http.Request) (*graphql.Request, error) {
+	if r.Method == http.MethodGet {
+		if err := convertGETRequest(r); err != nil {
+			return nil, err
+		}
+	}
+
 	gqlRequest := new(graphql.Request)
 	rawBody, _ := ioutil.ReadAll(r.Body)
 	r.Body = ioutil.NopCloser(bytes.NewBuffer(rawBody))
@@ -143,6 +214,10 @@ func (h *Handler) unmarshalHTTPRequest(r *http.Request) (*graphql.Request, error
 		return nil, err
 	}
 
+	if err = h.resolvePersistedQuery(r, rawBody, gqlRequest); err != nil {
+		return nil, err
+	}
+
 	if err = normalizeGraphqlRequest(h.schema, gqlRequest); err != nil {
 		return nil, err
 	}
@@ -150,7 +225,100 @@ func (h *Handler) unmarshalHTTPRequest(r *http.Request) (*graphql.Request, error
 	return gqlRequest, nil
 }
 
+// convertGETRequest convert GraphQL over http GET request to POST request with json body,
+// so it can be handled as same as POST request and upstream not need to support GET request.
+func convertGETRequest(r *http.Request) error {
+	query := r.URL.Query()
+	body := make(map[string]json.RawMessage)
+
+	for _, param := range []string{"query", "operationName"} {
+		if v := query.Get(param); v != "" {
+			body[param], _ = json.Marshal(v) // nolint:errchkjson
+		}
+	}
+
+	for _, param := range []string{"variables", "extensions"} {
+		v := query.Get(param)
+
+		if v == "" {
+			continue
+		}
+
+		if !json.Valid([]byte(v)) {
+			return fmt.Errorf("`%s` param should be valid json", param)
+		}
+
+		body[param] = json.RawMessage(v)
+	}
+
+	rawBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	r.Method = http.MethodPost
+	r.URL.RawQuery = ""
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(rawBody))
+	r.ContentLength = int64(len(rawBody))
+	r.Header.Set("content-type", "application/json")
+	r.Header.Set("content-length", strconv.Itoa(len(rawBody)))
+
+	return nil
+}
+
+// resolvePersistedQuery load query text of GraphQL request unmarshalled from raw body of http request
+// by document id or persisted query hash given, body will be replaced with full query text when query loaded,
+// so upstream not need to know about persisted queries.
+func (h *Handler) resolvePersistedQuery(r *http.Request, rawBody []byte, gqlRequest *graphql.Request) (err error) {
+	if h.APQ == nil && h.Allowlist == nil {
+		return nil
+	}
+
+	var loaded bool
+	body := make(map[string]json.RawMessage)
+
+	if err = json.Unmarshal(rawBody, &body); err != nil {
+		return err
+	}
+
+	if h.Allowlist != nil && gqlRequest.Query == "" {
+		loaded = h.Allowlist.resolveQuery(gqlRequest, body)
+	}
+
+	if h.APQ != nil && !loaded {
+		if loaded, err = h.APQ.resolveQuery(r.Context(), gqlRequest, body["extensions"]); err != nil {
+			return err
+		}
+	}
+
+	if !loaded {
+		return nil
+	}
+
+	body["query"], _ = json.Marshal(gqlRequest.Query) // nolint:errchkjson
+	newBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(newBody))
+	r.ContentLength = int64(len(newBody))
+	r.Header.Set("content-length", strconv.Itoa(len(newBody)))
+
+	return nil
+}
+
 func (h *Handler) validateGraphqlRequest(r *graphql.Request) error {
+	if h.Allowlist != nil && !h.Allowlist.allowed(r) {
+		h.addMetricsAllowlistRejected(r, h.Allowlist.Mode)
+
+		if h.Allowlist.Mode == AllowlistModeEnforce {
+			return ErrNotAllowOperation
+		}
+
+		h.logger.Warn("operation is not in allowlist", zap.String("operation_name", r.OperationName))
+	}
+
 	isIntrospectQuery, _ := r.IsIntrospectionQuery()
 
 	if isIntrospectQuery && h.DisabledIntrospection {
@@ -89,7 +89,54 @@ func (s *schemaFetcher) fetch() error {
 		return err
 	}
 
-	return s.fetchByIntrospectionData(data)
+	if err = s.fetchByIntrospectionData(data); err != nil {
+		return err
+	}
+
+	s.fetchCachingSchemaHints()
+
+	return nil
+}
+
+// fetchCachingSchemaHints fetches SDL of upstream supporting `_service { sdl }` query (like Apollo federation subgraphs)
+// to collect `@cacheControl` directives, since applied directives are not exposed by introspection schema gbox loaded,
+// a warning will be logged when hints can not be collected.
+func (s *schemaFetcher) fetchCachingSchemaHints() {
+	if s.caching == nil {
+		return
+	}
+
+	var responseBody struct {
+		Data *struct {
+			Service struct {
+				SDL string `json:"sdl"`
+			} `json:"_service"`
+		} `json:"data"`
+	}
+
+	if err := s.query(&graphql.Request{Query: "query { _service { sdl } }"}, &responseBody); err != nil || responseBody.Data == nil {
+		s.logger.Warn("upstream does not expose SDL via `_service { sdl }` query, schema `@cacheControl` hints will be ignored", zap.Error(err))
+
+		return
+	}
+
+	document, report := astparser.ParseGraphqlDocumentString(responseBody.Data.Service.SDL)
+
+	if report.HasErrors() {
+		s.logger.Warn("fail to parse upstream SDL", zap.Error(report))
+
+		return
+	}
+
+	hints := newCachingSchemaHints(&document)
+
+	if len(hints) == 0 {
+		s.logger.Warn("upstream SDL does not have any `@cacheControl` hints")
+	}
+
+	if err := s.caching.setSchemaHints(hints); err != nil {
+		s.logger.Warn("fail to set schema caching hints", zap.Error(err))
+	}
 }
 
 func (s *schemaFetcher) fetchByIntrospectionData(data *introspection.Data) (err error) {
@@ -126,31 +173,11 @@ func (s *schemaFetcher) fetchByIntrospectionData(data *introspection.Data) (err
 }
 
 func (s *schemaFetcher) introspect() (data *introspection.Data, err error) {
-	client := &http.Client{
-		Timeout: time.Duration(s.timeout),
-	}
-	requestBody, _ := json.Marshal(s.newIntrospectRequest()) // nolint:errchkjson
-	request, _ := http.NewRequestWithContext(s.context, "POST", s.upstream, bytes.NewBuffer(requestBody))
-	request.Header = s.header.Clone()
-	request.Header.Set("user-agent", "GBox Proxy")
-	request.Header.Set("content-type", "application/json")
-
-	var response *http.Response
-
-	response, err = client.Do(request)
-
-	if err != nil {
-		return nil, err
-	}
-
-	defer response.Body.Close()
-	rawResponseBody, _ := ioutil.ReadAll(response.Body)
-
 	var responseBody struct {
 		Data *introspection.Data `json:"data"`
 	}
 
-	if err = json.Unmarshal(rawResponseBody, &responseBody); err != nil {
+	if err = s.query(s.newIntrospectRequest(), &responseBody); err != nil {
 		return nil, err
 	}
 
@@ -216,6 +243,28 @@ func (s *schemaFetcher) schemaChanged(changedSchema *graphql.Schema) {
 	}
 }
 
+// query sends GraphQL request given to upstream and unmarshal response body to v.
+func (s *schemaFetcher) query(gqlRequest *graphql.Request, v interface{}) error {
+	client := &http.Client{
+		Timeout: time.Duration(s.timeout),
+	}
+	requestBody, _ := json.Marshal(gqlRequest) // nolint:errchkjson
+	request, _ := http.NewRequestWithContext(s.context, "POST", s.upstream, bytes.NewBuffer(requestBody))
+	request.Header = s.header.Clone()
+	request.Header.Set("user-agent", "GBox Proxy")
+	request.Header.Set("content-type", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+	rawResponseBody, _ := ioutil.ReadAll(response.Body)
+
+	return json.Unmarshal(rawResponseBody, v)
+}
+
 func (*schemaFetcher) newIntrospectRequest() *graphql.Request {
 	return &graphql.Request{
 		OperationName: "IntrospectionQuery",
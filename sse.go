@@ -0,0 +1,259 @@
+package gbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"go.uber.org/zap"
+)
+
+const (
+	sseContentType        = "text/event-stream"
+	sseSubscriptionID     = "1"
+	sseKeepAliveInterval  = 12 * time.Second
+	sseEventNext          = "next"
+	sseEventComplete      = "complete"
+	sseEventKeepAliveData = ":\n\n"
+)
+
+var ErrSSEStreamingNotSupported = errors.New("streaming is not supported")
+
+// SSE settings for GraphQL over Server-Sent Events (distinct connections mode), subscriptions will be forwarded
+// to upstream via graphql-transport-ws protocol, see https://github.com/enisdenjo/graphql-sse/blob/master/PROTOCOL.md
+type SSE struct {
+	// Interval to send keep alive comments to clients, "12s" by default.
+	KeepAliveInterval caddy.Duration `json:"keep_alive_interval,omitempty"`
+}
+
+func isSSEHTTPRequest(r *http.Request) bool {
+	for _, accept := range r.Header.Values("accept") {
+		if strings.Contains(accept, sseContentType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleSSERequest streaming result of GraphQL request as server-sent events, query and mutation operations will be
+// handled as same as normal request and result will be sent as single event.
+func (h *Handler) handleSSERequest(w http.ResponseWriter, r *http.Request, upstream caddyhttp.HandlerFunc) error {
+	isGETRequest := r.Method == http.MethodGet
+	gqlRequest, err := h.unmarshalHTTPRequest(r)
+	if err != nil {
+		h.logger.Debug("can not unmarshal graphql request from http request", zap.Error(err))
+
+		return writeResponseErrors(err, w)
+	}
+
+	operationType, _ := gqlRequest.OperationType()
+
+	if isGETRequest && operationType == graphql.OperationTypeMutation {
+		w.Header().Set("allow", http.MethodPost)
+
+		return writeResponseErrorsWithStatus(ErrNotAllowGETRequestOperation, http.StatusMethodNotAllowed, w)
+	}
+
+	if operationType == graphql.OperationTypeSubscription {
+		payload, _ := ioutil.ReadAll(r.Body)
+
+		return h.handleSSESubscription(w, r, upstream, h, gqlRequest, payload)
+	}
+
+	buff := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buff)
+	buff.Reset()
+	rw := newCachingResponseWriter(buff)
+	// result will be sent as event data, it must not be served compressed.
+	r.Header.Del("accept-encoding")
+
+	if err = h.handleRequest(rw, r, upstream); err != nil {
+		return err
+	}
+
+	if rw.Status() != 0 && rw.Status() != http.StatusOK {
+		// errors occurred before executing operation should be sent as normal response.
+		return rw.WriteResponse(w)
+	}
+
+	stream, err := newSSEStream(w)
+	if err != nil {
+		return rw.WriteResponse(w)
+	}
+
+	for name, values := range rw.Header() {
+		w.Header()[name] = values
+	}
+
+	stream.open()
+	stream.writeEvent(sseEventNext, buff.Bytes())
+	stream.writeEvent(sseEventComplete, nil)
+
+	return nil
+}
+
+// handleSSESubscription forward subscription to upstream via websocket and translate graphql-transport-ws messages
+// to server-sent events until subscription completed or client disconnected.
+func (h *Handler) handleSSESubscription(w http.ResponseWriter, r *http.Request, upstream caddyhttp.HandlerFunc, s wsSubscriber, gqlRequest *graphql.Request, payload json.RawMessage) error {
+	if h.Subscription != nil {
+		release, ok := h.Subscription.acquireConnection(r)
+
+		if !ok {
+			s.onWsLimitExceeded(subscriptionLimitMaxConnections)
+
+			return writeResponseErrorsWithStatus(ErrSubscriptionMaxConnectionsExceeded, http.StatusTooManyRequests, w)
+		}
+
+		defer release()
+	}
+
+	if err := s.onWsSubscribe(gqlRequest); err != nil {
+		return writeResponseErrors(err, w)
+	}
+
+	defer func(startedAt time.Time) {
+		s.onWsClose(gqlRequest, time.Since(startedAt))
+	}(time.Now())
+
+	stream, err := newSSEStream(w)
+	if err != nil {
+		return writeResponseErrors(err, w)
+	}
+
+	conn, err := dialWsUpstream(r, upstream, nil)
+	if err != nil {
+		h.logger.Warn("fail to open websocket connection to upstream", zap.Error(err))
+
+		return writeResponseErrorsWithStatus(err, http.StatusBadGateway, w)
+	}
+
+	defer conn.Close()
+
+	if err = conn.writeMessage(&wsMessage{ID: sseSubscriptionID, Type: "subscribe", Payload: payload}); err != nil {
+		return writeResponseErrorsWithStatus(err, http.StatusBadGateway, w)
+	}
+
+	messages := make(chan *wsMessage)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			msg, e := conn.readMessage()
+			if e != nil {
+				readErr <- e
+
+				return
+			}
+
+			select {
+			case messages <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	keepAliveInterval := sseKeepAliveInterval
+
+	if h.SSE != nil && h.SSE.KeepAliveInterval > 0 {
+		keepAliveInterval = time.Duration(h.SSE.KeepAliveInterval)
+	}
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	stream.open()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			conn.writeMessage(&wsMessage{ID: sseSubscriptionID, Type: "complete"}) // nolint:errcheck
+
+			return nil
+		case <-ticker.C:
+			stream.write([]byte(sseEventKeepAliveData))
+		case e := <-readErr:
+			h.logger.Debug("upstream websocket connection closed unexpectedly", zap.Error(e))
+			stream.writeErrors(graphql.RequestErrorsFromError(e))
+			stream.writeEvent(sseEventComplete, nil)
+
+			return nil
+		case msg := <-messages:
+			switch msg.Type {
+			case "next":
+				stream.writeEvent(sseEventNext, msg.Payload)
+			case "error":
+				stream.writeErrors(msg.Payload)
+				stream.writeEvent(sseEventComplete, nil)
+
+				return nil
+			case "complete":
+				stream.writeEvent(sseEventComplete, nil)
+
+				return nil
+			case "ping":
+				conn.writeMessage(&wsMessage{Type: "pong"}) // nolint:errcheck
+			}
+		}
+	}
+}
+
+type sseStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEStream(w http.ResponseWriter) (*sseStream, error) {
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		return nil, ErrSSEStreamingNotSupported
+	}
+
+	return &sseStream{w: w, flusher: flusher}, nil
+}
+
+func (s *sseStream) open() {
+	s.w.Header().Del("content-length")
+	s.w.Header().Set("content-type", sseContentType)
+	s.w.Header().Set("cache-control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+	s.flusher.Flush()
+}
+
+func (s *sseStream) write(data []byte) {
+	if _, err := s.w.Write(data); err == nil {
+		s.flusher.Flush()
+	}
+}
+
+func (s *sseStream) writeEvent(event string, data []byte) {
+	buff := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buff)
+	buff.Reset()
+
+	// data must be in single line.
+	if err := json.Compact(buff, data); err != nil {
+		buff.Reset()
+		buff.Write(bytes.ReplaceAll(bytes.TrimSpace(data), []byte("\n"), nil))
+	}
+
+	s.write([]byte(fmt.Sprintf("event: %s\ndata: %s\n\n", event, buff.Bytes())))
+}
+
+func (s *sseStream) writeErrors(errs interface{}) {
+	data, _ := json.Marshal(map[string]interface{}{"errors": errs}) // nolint:errchkjson
+
+	s.writeEvent(sseEventNext, data)
+}
@@ -0,0 +1,217 @@
+package gbox
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/jensneuse/graphql-go-tools/pkg/astparser"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestWsUpstream(t *testing.T, messages ...string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-reject") != "" {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		conn, _, _, err := ws.UpgradeHTTP(r, w)
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		for {
+			data, err := wsutil.ReadClientText(conn)
+			if err != nil {
+				return
+			}
+
+			msg := new(wsMessage)
+			json.Unmarshal(data, msg)
+
+			switch msg.Type {
+			case "connection_init":
+				wsutil.WriteServerText(conn, []byte(`{"type":"connection_ack"}`))
+			case "subscribe":
+				for _, m := range messages {
+					wsutil.WriteServerText(conn, []byte(m))
+				}
+			}
+		}
+	}))
+}
+
+// newTestReverseProxy forwards requests to upstream given like reverse proxy handler of gbox.
+func newTestReverseProxy(upstream *httptest.Server) caddyhttp.HandlerFunc {
+	u, _ := url.Parse(upstream.URL)
+	proxy := httputil.NewSingleHostReverseProxy(u)
+
+	return func(w http.ResponseWriter, r *http.Request) error {
+		proxy.ServeHTTP(w, r)
+
+		return nil
+	}
+}
+
+func TestNewWsUpstreamHandshakeRequest(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodPost, "http://localhost/graphql", strings.NewReader("{}")) // nolint:noctx
+	r.Header.Set("content-type", "application/json")
+	r.Header.Set("accept", "text/event-stream")
+	r.Header.Set("authorization", "Bearer test")
+
+	handshake, err := newWsUpstreamHandshakeRequest(r)
+
+	require.NoError(t, err)
+	require.Equal(t, http.MethodGet, handshake.Method)
+	require.Equal(t, r.URL.String(), handshake.URL.String(), "handshake request should be sent to upstream of http requests")
+	require.Empty(t, handshake.Header.Get("content-type"))
+	require.Empty(t, handshake.Header.Get("accept"))
+	require.Equal(t, "Bearer test", handshake.Header.Get("authorization"), "headers rules of reverse proxy should be applied")
+	require.Equal(t, "websocket", handshake.Header.Get("upgrade"))
+	require.Equal(t, wsTransportProtocol, handshake.Header.Get("sec-websocket-protocol"))
+	require.NotEmpty(t, handshake.Header.Get("sec-websocket-key"))
+}
+
+func TestIsSSEHTTPRequest(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodGet, "http://localhost/graphql", nil) // nolint:noctx
+	require.False(t, isSSEHTTPRequest(r))
+
+	r.Header.Set("accept", "text/event-stream")
+	require.True(t, isSSEHTTPRequest(r))
+}
+
+func TestHandler_HandleSSESubscription(t *testing.T) {
+	testCases := map[string]struct {
+		messages     []string
+		header       http.Header
+		subscribeErr error
+		expectedCode int
+		expectedBody string
+	}{
+		"next_and_complete": {
+			messages: []string{
+				`{"id":"1","type":"next","payload":{"data":{"users":[{"id": 1}]}}}`,
+				`{"id":"1","type":"next","payload":{"data":{"users":[{"id": 2}]}}}`,
+				`{"id":"1","type":"complete"}`,
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "event: next\ndata: {\"data\":{\"users\":[{\"id\":1}]}}\n\n" +
+				"event: next\ndata: {\"data\":{\"users\":[{\"id\":2}]}}\n\n" +
+				"event: complete\ndata: \n\n",
+		},
+		"error": {
+			messages: []string{
+				`{"id":"1","type":"error","payload":[{"message":"test"}]}`,
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: "event: next\ndata: {\"errors\":[{\"message\":\"test\"}]}\n\n" +
+				"event: complete\ndata: \n\n",
+		},
+		"invalid_subscription": {
+			subscribeErr: errors.New("test"),
+			expectedCode: http.StatusOK,
+			expectedBody: `{"errors":[{"message":"test"}]}`,
+		},
+		"upstream_rejected": {
+			header:       http.Header{"X-Reject": []string{"1"}},
+			expectedCode: http.StatusBadGateway,
+			expectedBody: `{"errors":[{"message":"upstream websocket handshake failed: unexpected status 403"}]}`,
+		},
+	}
+
+	for name, testCase := range testCases {
+		upstream := newTestWsUpstream(t, testCase.messages...)
+		h := &Handler{
+			SSE:    &SSE{},
+			logger: zap.NewNop(),
+		}
+		s := newTestWsSubscriber(t, testCase.subscribeErr)
+		gqlRequest := &graphql.Request{Query: "subscription { users { id } }"}
+		r, _ := http.NewRequest(http.MethodPost, "http://localhost/graphql", nil) // nolint:noctx
+		w := httptest.NewRecorder()
+
+		for name, values := range testCase.header {
+			r.Header[name] = values
+		}
+
+		err := h.handleSSESubscription(w, r, newTestReverseProxy(upstream), s, gqlRequest, json.RawMessage(`{"query":"subscription { users { id } }"}`))
+		upstream.Close()
+
+		require.NoErrorf(t, err, "case %s: unexpected error", name)
+		require.Equalf(t, testCase.expectedCode, w.Code, "case %s: unexpected status code", name)
+		require.Equalf(t, testCase.expectedBody, w.Body.String(), "case %s: unexpected body", name)
+
+		if testCase.subscribeErr == nil && testCase.expectedCode == http.StatusOK {
+			require.Equalf(t, "text/event-stream", w.Header().Get("content-type"), "case %s: unexpected content type", name)
+			require.Greaterf(t, s.d, time.Duration(0), "case %s: subscription should be closed", name)
+		}
+	}
+}
+
+func TestHandler_HandleSSERequestCompressedCachingResult(t *testing.T) {
+	s, err := graphql.NewSchemaFromString(`
+type Query {
+	users: [User!]!
+}
+
+type User {
+	name: String!
+}
+`)
+	require.NoError(t, err)
+	s.Normalize()
+
+	d, _ := astparser.ParseGraphqlDocumentBytes(s.Document())
+	c := newTestCaching(t, CachingRules{
+		"default": &CachingRule{
+			MaxAge: caddy.Duration(time.Hour),
+		},
+	})
+	c.Compression = &CachingCompression{Algorithm: CachingCompressionGzip, MinSize: 1}
+	h := &Handler{
+		SSE:            &SSE{},
+		Caching:        c,
+		schema:         s,
+		schemaDocument: &d,
+		metrics:        metrics,
+		logger:         zap.NewNop(),
+	}
+	upstream := func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"data":{"users":[{"name":"A"}]}}`))
+
+		return err
+	}
+
+	for _, status := range []CachingStatus{CachingStatusMiss, CachingStatusHit} {
+		r, _ := http.NewRequest(http.MethodPost, "http://localhost/graphql", strings.NewReader(`{"query": "query { users { name } }"}`)) // nolint:noctx
+		r.Header.Set("accept", sseContentType)
+		r.Header.Set("accept-encoding", "gzip")
+		w := httptest.NewRecorder()
+
+		require.NoError(t, h.handleSSERequest(w, r, upstream))
+		require.Equal(t, string(status), w.Header().Get("x-cache"))
+		require.Equal(t, sseContentType, w.Header().Get("content-type"))
+		require.Empty(t, w.Header().Get("content-encoding"), "event stream should not be compressed")
+		require.Equal(t, "event: next\ndata: {\"data\":{\"users\":[{\"name\":\"A\"}]}}\n\nevent: complete\ndata: \n\n", w.Body.String())
+	}
+}
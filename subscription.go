@@ -0,0 +1,99 @@
+package gbox
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/gobwas/ws"
+)
+
+const (
+	defaultSubscriptionClientKey = "{http.request.remote.host}"
+
+	// wsStatusIdleTimeout and wsStatusTooManyMessages close codes are in range reserved for applications.
+	wsStatusIdleTimeout     ws.StatusCode = 4408
+	wsStatusTooManyMessages ws.StatusCode = 4429
+
+	subscriptionLimitMaxSubscriptions     = "max_subscriptions"
+	subscriptionLimitMaxConnections       = "max_connections_per_client"
+	subscriptionLimitIdleTimeout          = "idle_timeout"
+	subscriptionLimitMaxMessagesPerSecond = "max_messages_per_second"
+)
+
+var (
+	ErrSubscriptionMaxSubscriptionsExceeded = errors.New("max subscriptions per connection exceeded")
+	ErrSubscriptionMaxConnectionsExceeded   = errors.New("max connections per client exceeded")
+	ErrSubscriptionIdleTimeout              = &wsCloseError{code: wsStatusIdleTimeout, reason: "connection idle timeout"}
+	ErrSubscriptionTooManyMessages          = &wsCloseError{code: wsStatusTooManyMessages, reason: "too many messages"}
+)
+
+// Subscription settings limit resources used by subscriptions and translate legacy protocol,
+// all of them are disabled by default.
+type Subscription struct {
+	// Max number of active subscriptions per websocket connection,
+	// subscribe messages exceeded will be rejected with error messages.
+	MaxSubscriptions int `json:"max_subscriptions,omitempty"`
+
+	// Max number of websocket and server-sent events subscription connections per client key,
+	// connections exceeded will be rejected with 429 status code.
+	MaxConnectionsPerClient int `json:"max_connections_per_client,omitempty"`
+
+	// Placeholder using to identify client, "{http.request.remote.host}" by default.
+	ClientKey string `json:"client_key,omitempty"`
+
+	// Websocket connections will be closed with 4408 code when no messages (including ping) received from client
+	// in this duration.
+	IdleTimeout caddy.Duration `json:"idle_timeout,omitempty"`
+
+	// Max number of messages client can send per second, websocket connections exceeded will be closed with 4429 code.
+	MaxMessagesPerSecond int `json:"max_messages_per_second,omitempty"`
+
+	// Translate legacy subscriptions-transport-ws (graphql-ws sub-protocol) messages of clients to graphql-transport-ws
+	// messages and back, so upstream only need to support graphql-transport-ws protocol.
+	TranslateLegacyProtocol bool `json:"translate_legacy_protocol,omitempty"`
+
+	connectionsMu sync.Mutex
+	connections   map[string]int
+}
+
+func (s *Subscription) provision() {
+	s.connections = make(map[string]int)
+
+	if s.ClientKey == "" {
+		s.ClientKey = defaultSubscriptionClientKey
+	}
+}
+
+// acquireConnection counts connection of client sent request given, returns false when client connections exceeded.
+// Release function must be called when connection closed if acquiring succeed.
+func (s *Subscription) acquireConnection(r *http.Request) (release func(), ok bool) {
+	if s.MaxConnectionsPerClient <= 0 {
+		return func() {}, true
+	}
+
+	key := s.ClientKey
+
+	if repl, isReplacer := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer); isReplacer {
+		key = repl.ReplaceAll(key, "")
+	}
+
+	s.connectionsMu.Lock()
+	defer s.connectionsMu.Unlock()
+
+	if s.connections[key] >= s.MaxConnectionsPerClient {
+		return nil, false
+	}
+
+	s.connections[key]++
+
+	return func() {
+		s.connectionsMu.Lock()
+		defer s.connectionsMu.Unlock()
+
+		if s.connections[key]--; s.connections[key] <= 0 {
+			delete(s.connections, key)
+		}
+	}, true
+}
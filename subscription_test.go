@@ -0,0 +1,52 @@
+package gbox
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSubscriptionRequest(client string) *http.Request {
+	repl := caddy.NewReplacer()
+	repl.Set("client", client)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	return r.WithContext(context.WithValue(r.Context(), caddy.ReplacerCtxKey, repl))
+}
+
+func TestSubscriptionAcquireConnection(t *testing.T) {
+	s := &Subscription{MaxConnectionsPerClient: 1, ClientKey: "{client}"}
+	s.provision()
+
+	release, ok := s.acquireConnection(newTestSubscriptionRequest("a"))
+	require.True(t, ok)
+
+	_, ok = s.acquireConnection(newTestSubscriptionRequest("a"))
+	require.False(t, ok, "connections exceeded should be rejected")
+
+	releaseB, ok := s.acquireConnection(newTestSubscriptionRequest("b"))
+	require.True(t, ok, "connections of other clients should not be affected")
+
+	release()
+	releaseB()
+	require.Empty(t, s.connections)
+
+	release, ok = s.acquireConnection(newTestSubscriptionRequest("a"))
+	require.True(t, ok, "connection should be acquired after released")
+	release()
+}
+
+func TestSubscriptionProvision(t *testing.T) {
+	s := &Subscription{}
+	s.provision()
+
+	require.Equal(t, defaultSubscriptionClientKey, s.ClientKey)
+
+	release, ok := s.acquireConnection(newTestSubscriptionRequest("a"))
+	require.True(t, ok, "connections should not be limited by default")
+	release()
+}
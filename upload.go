@@ -0,0 +1,314 @@
+package gbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
+	"go.uber.org/zap"
+)
+
+const (
+	uploadOperationsField = "operations"
+	uploadMapField        = "map"
+
+	// max size of `operations` and `map` fields, files are not limited by it.
+	uploadMaxFieldSize = 10 << 20
+)
+
+var (
+	ErrUploadInvalidRequest = errors.New("invalid multipart request, `operations` and `map` fields must be sent before files")
+	ErrUploadFieldTooLarge  = fmt.Errorf("`operations` and `map` fields of multipart request must not exceed %d bytes", uploadMaxFieldSize)
+)
+
+// Upload settings for GraphQL multipart requests, see https://github.com/jaydenseric/graphql-multipart-request-spec
+type Upload struct {
+	// Max size in bytes of each file, unlimited if not set.
+	MaxFileSize int64 `json:"max_file_size,omitempty"`
+
+	// Max number of files per request, unlimited if not set.
+	MaxFiles int `json:"max_files,omitempty"`
+}
+
+func isMultipartHTTPRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("content-type"))
+
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// uploadRequest holds operations of multipart request, body of it will be replaced by the reader
+// streaming original body and enforcing file limits while upstream consuming it.
+type uploadRequest struct {
+	operations []*graphql.Request
+	limiter    *uploadLimiter
+}
+
+// newUploadRequest read `operations` and `map` fields of multipart request, files still be kept in body.
+func (u *Upload) newUploadRequest(r *http.Request) (*uploadRequest, error) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("content-type"))
+	if err != nil {
+		return nil, err
+	}
+
+	boundary := params["boundary"]
+
+	if boundary == "" {
+		return nil, http.ErrMissingBoundary
+	}
+
+	// keep bytes had been read to replay them to upstream.
+	head := new(bytes.Buffer)
+	reader := multipart.NewReader(io.TeeReader(r.Body, head), boundary)
+	fields := make(map[string][]byte, 2)
+
+	for _, name := range []string{uploadOperationsField, uploadMapField} {
+		var part *multipart.Part
+		part, err = reader.NextPart()
+
+		if err != nil || part.FormName() != name {
+			return nil, ErrUploadInvalidRequest
+		}
+
+		var value []byte
+		value, err = ioutil.ReadAll(io.LimitReader(part, uploadMaxFieldSize+1))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(value) > uploadMaxFieldSize {
+			return nil, ErrUploadFieldTooLarge
+		}
+
+		fields[name] = value
+	}
+
+	filesMap := make(map[string][]string)
+
+	if err = json.Unmarshal(fields[uploadMapField], &filesMap); err != nil {
+		return nil, fmt.Errorf("`map` field should be valid json: %w", err)
+	}
+
+	if u.MaxFiles > 0 && len(filesMap) > u.MaxFiles {
+		return nil, fmt.Errorf("upload max files is %d, current %d", u.MaxFiles, len(filesMap))
+	}
+
+	operations, err := unmarshalUploadOperations(fields[uploadOperationsField])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, operation := range operations {
+		operation.SetHeader(r.Header)
+	}
+
+	limiter := newUploadLimiter(u, boundary)
+	r.Body = limiter.wrap(io.MultiReader(head, r.Body), r.Body)
+
+	return &uploadRequest{
+		operations: operations,
+		limiter:    limiter,
+	}, nil
+}
+
+func unmarshalUploadOperations(data []byte) ([]*graphql.Request, error) {
+	var operations []*graphql.Request
+	trimmed := bytes.TrimSpace(data)
+
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &operations); err != nil {
+			return nil, fmt.Errorf("`operations` field should be valid json: %w", err)
+		}
+
+		return operations, nil
+	}
+
+	operation := new(graphql.Request)
+
+	if err := json.Unmarshal(trimmed, operation); err != nil {
+		return nil, fmt.Errorf("`operations` field should be valid json: %w", err)
+	}
+
+	return append(operations, operation), nil
+}
+
+// uploadLimiter parse multipart body in background while upstream consuming it,
+// reading body will be failed as soon as a file exceeded limits.
+type uploadLimiter struct {
+	upload   *Upload
+	boundary string
+	pr       *io.PipeReader
+	pw       *io.PipeWriter
+	done     chan struct{}
+	mu       sync.Mutex
+	err      error
+}
+
+func newUploadLimiter(u *Upload, boundary string) *uploadLimiter {
+	pr, pw := io.Pipe()
+
+	return &uploadLimiter{
+		upload:   u,
+		boundary: boundary,
+		pr:       pr,
+		pw:       pw,
+		done:     make(chan struct{}),
+	}
+}
+
+func (l *uploadLimiter) wrap(body io.Reader, closer io.Closer) io.ReadCloser {
+	go l.inspect()
+
+	return &uploadLimiterBody{
+		tee:     io.TeeReader(body, l.pw),
+		limiter: l,
+		closer:  closer,
+	}
+}
+
+// uploadLimiterBody stream body to upstream and inspector, reading will be failed when inspector aborted.
+type uploadLimiterBody struct {
+	tee     io.Reader
+	limiter *uploadLimiter
+	closer  io.Closer
+}
+
+func (b *uploadLimiterBody) Read(p []byte) (int, error) {
+	n, err := b.tee.Read(p)
+
+	if errors.Is(err, io.EOF) {
+		// let inspector knows no more parts and wait for its result,
+		// the last chunk may contain exceeded bytes had not been inspected yet.
+		b.limiter.pw.Close()
+		<-b.limiter.done
+
+		if limitErr := b.limiter.error(); limitErr != nil {
+			return n, limitErr
+		}
+	}
+
+	return n, err
+}
+
+func (b *uploadLimiterBody) Close() error {
+	return b.closer.Close()
+}
+
+func (l *uploadLimiter) inspect() {
+	defer close(l.done)
+
+	reader := multipart.NewReader(l.pr, l.boundary)
+	files := 0
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+
+		if name := part.FormName(); name == uploadOperationsField || name == uploadMapField {
+			continue
+		}
+
+		files++
+
+		if l.upload.MaxFiles > 0 && files > l.upload.MaxFiles {
+			l.abort(fmt.Errorf("upload max files is %d, current %d", l.upload.MaxFiles, files))
+
+			return
+		}
+
+		var src io.Reader = part
+
+		if l.upload.MaxFileSize > 0 {
+			src = io.LimitReader(part, l.upload.MaxFileSize+1)
+		}
+
+		n, err := io.Copy(ioutil.Discard, src)
+		if err != nil {
+			break
+		}
+
+		if l.upload.MaxFileSize > 0 && n > l.upload.MaxFileSize {
+			l.abort(fmt.Errorf("upload max file size is %d bytes, file %s exceeded", l.upload.MaxFileSize, part.FileName()))
+
+			return
+		}
+	}
+
+	// drain remaining bytes, so body reader not be blocked.
+	io.Copy(ioutil.Discard, l.pr) // nolint:errcheck
+}
+
+func (l *uploadLimiter) abort(err error) {
+	l.mu.Lock()
+	l.err = err
+	l.mu.Unlock()
+
+	l.pr.CloseWithError(err)
+}
+
+func (l *uploadLimiter) error() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+func (l *uploadLimiter) close() {
+	l.pr.Close()
+}
+
+// handleUploadRequest validate and collect metrics of operations of multipart request before streaming it to upstream.
+func (h *Handler) handleUploadRequest(w http.ResponseWriter, r *http.Request, upstream caddyhttp.HandlerFunc) error {
+	upload, err := h.Upload.newUploadRequest(r)
+	if err != nil {
+		h.logger.Debug("can not read graphql operations from multipart request", zap.Error(err))
+
+		return writeResponseErrors(err, w)
+	}
+
+	defer upload.limiter.close()
+
+	for _, operation := range upload.operations {
+		if err = normalizeGraphqlRequest(h.schema, operation); err != nil {
+			return writeResponseErrors(err, w)
+		}
+
+		if err = h.validateGraphqlRequest(operation); err != nil {
+			return writeResponseErrors(err, w)
+		}
+	}
+
+	for _, operation := range upload.operations {
+		h.addMetricsBeginRequest(operation)
+	}
+
+	defer func(startedAt time.Time) {
+		for _, operation := range upload.operations {
+			h.addMetricsEndRequest(operation, time.Since(startedAt))
+		}
+	}(time.Now())
+
+	if err = upstream(w, r); err != nil {
+		if limitErr := upload.limiter.error(); limitErr != nil {
+			h.logger.Debug("multipart request exceeded upload limits", zap.Error(limitErr))
+
+			return writeResponseErrorsWithStatus(limitErr, http.StatusRequestEntityTooLarge, w)
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package gbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMultipartRequest(t *testing.T, operations, filesMap string, files map[string]string) (*http.Request, []byte) {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+
+	require.NoError(t, mw.WriteField("operations", operations))
+	require.NoError(t, mw.WriteField("map", filesMap))
+
+	for name, content := range files {
+		fw, err := mw.CreateFormFile(name, name+".txt")
+		require.NoError(t, err)
+
+		_, err = fw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, mw.Close())
+
+	raw := body.Bytes()
+	r, _ := http.NewRequest(http.MethodPost, "http://localhost/graphql", bytes.NewReader(raw)) // nolint:noctx
+	r.Header.Set("content-type", mw.FormDataContentType())
+
+	return r, raw
+}
+
+func TestIsMultipartHTTPRequest(t *testing.T) {
+	r, _ := newTestMultipartRequest(t, `{}`, `{}`, nil)
+	require.True(t, isMultipartHTTPRequest(r))
+
+	r.Header.Set("content-type", "application/json")
+	require.False(t, isMultipartHTTPRequest(r))
+}
+
+func TestUpload_NewUploadRequest(t *testing.T) {
+	const operations = `{"query": "mutation ($file: Upload!) { upload(file: $file) }", "variables": {"file": null}}`
+	u := &Upload{}
+	r, raw := newTestMultipartRequest(t, operations, `{"0": ["variables.file"]}`, map[string]string{
+		"0": strings.Repeat("a", 8192),
+	})
+
+	upload, err := u.newUploadRequest(r)
+	require.NoError(t, err)
+	require.Len(t, upload.operations, 1)
+	require.Equal(t, "mutation ($file: Upload!) { upload(file: $file) }", upload.operations[0].Query)
+
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(t, err)
+	require.Equal(t, raw, body, "body streamed to upstream should be the original")
+	require.NoError(t, upload.limiter.error())
+	upload.limiter.close()
+}
+
+func TestUpload_NewUploadRequestBatchOperations(t *testing.T) {
+	u := &Upload{}
+	r, _ := newTestMultipartRequest(t, `[{"query": "query { a }"}, {"query": "query { b }"}]`, `{}`, nil)
+
+	upload, err := u.newUploadRequest(r)
+	require.NoError(t, err)
+	require.Len(t, upload.operations, 2)
+	upload.limiter.close()
+}
+
+func TestUpload_NewUploadRequestInvalid(t *testing.T) {
+	testCases := map[string]struct {
+		upload     *Upload
+		operations string
+		filesMap   string
+		files      map[string]string
+		err        string
+	}{
+		"invalid_operations": {
+			upload:     &Upload{},
+			operations: `{`,
+			filesMap:   `{}`,
+			err:        "`operations` field should be valid json",
+		},
+		"invalid_map": {
+			upload:     &Upload{},
+			operations: `{"query": "query { a }"}`,
+			filesMap:   `[`,
+			err:        "`map` field should be valid json",
+		},
+		"max_files_exceeded": {
+			upload:     &Upload{MaxFiles: 1},
+			operations: `{"query": "query { a }"}`,
+			filesMap:   `{"0": ["variables.a"], "1": ["variables.b"]}`,
+			files:      map[string]string{"0": "a", "1": "b"},
+			err:        "upload max files is 1, current 2",
+		},
+	}
+
+	for name, testCase := range testCases {
+		r, _ := newTestMultipartRequest(t, testCase.operations, testCase.filesMap, testCase.files)
+		_, err := testCase.upload.newUploadRequest(r)
+
+		require.Errorf(t, err, "case %s: should be error", name)
+		require.Containsf(t, err.Error(), testCase.err, "case %s: unexpected error", name)
+	}
+
+	r, _ := http.NewRequest(http.MethodPost, "http://localhost/graphql", strings.NewReader("--x\r\n\r\nfile\r\n--x--")) // nolint:noctx
+	r.Header.Set("content-type", "multipart/form-data; boundary=x")
+	_, err := new(Upload).newUploadRequest(r)
+
+	require.ErrorIs(t, err, ErrUploadInvalidRequest)
+}
+
+func TestUploadLimiter(t *testing.T) {
+	testCases := map[string]struct {
+		upload *Upload
+		files  map[string]string
+		err    string
+	}{
+		"max_file_size_exceeded": {
+			upload: &Upload{MaxFileSize: 1024},
+			files:  map[string]string{"0": strings.Repeat("a", 1025)},
+			err:    "upload max file size is 1024 bytes, file 0.txt exceeded",
+		},
+		"max_files_exceeded": {
+			upload: &Upload{MaxFiles: 1},
+			files:  map[string]string{"0": "a", "1": "b"},
+			err:    "upload max files is 1, current 2",
+		},
+		"not_exceeded": {
+			upload: &Upload{MaxFileSize: 1024, MaxFiles: 2},
+			files:  map[string]string{"0": strings.Repeat("a", 1024), "1": "b"},
+		},
+	}
+
+	for name, testCase := range testCases {
+		// map not declared all files to test limiter on real parts.
+		r, _ := newTestMultipartRequest(t, `{"query": "query { a }"}`, `{}`, testCase.files)
+		upload, err := testCase.upload.newUploadRequest(r)
+		require.NoErrorf(t, err, "case %s: unexpected error", name)
+
+		_, err = ioutil.ReadAll(r.Body)
+		upload.limiter.close()
+
+		if testCase.err == "" {
+			require.NoErrorf(t, err, "case %s: unexpected error", name)
+			require.NoErrorf(t, upload.limiter.error(), "case %s: unexpected limiter error", name)
+
+			continue
+		}
+
+		require.Errorf(t, err, "case %s: reading body should be failed", name)
+		require.EqualErrorf(t, upload.limiter.error(), testCase.err, "case %s: unexpected limiter error", name)
+	}
+}
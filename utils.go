@@ -2,10 +2,16 @@ package gbox
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
 
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"github.com/jensneuse/graphql-go-tools/pkg/astparser"
 	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
 	"github.com/jensneuse/graphql-go-tools/pkg/operationreport"
@@ -17,15 +23,63 @@ var bufferPool = sync.Pool{
 	},
 }
 
+// prepareHTTPRequest clone http request with new context and replacer, so it can be handled
+// concurrently with (or after) the original request.
+func prepareHTTPRequest(ctx context.Context, r *http.Request, w http.ResponseWriter) *http.Request {
+	s := r.Context().Value(caddyhttp.ServerCtxKey).(*caddyhttp.Server)
+
+	return caddyhttp.PrepareRequest(r.Clone(ctx), caddy.NewReplacer(), w, s)
+}
+
+// codedError is error will be written with `extensions.code`, so clients can recognize it without matching message.
+type codedError struct {
+	message string
+	code    string
+}
+
+func (e *codedError) Error() string {
+	return e.message
+}
+
 func writeResponseErrors(errors error, w http.ResponseWriter) error {
-	gqlErrors := graphql.RequestErrorsFromError(errors)
 	w.Header().Set("Content-Type", "application/json")
 
-	if _, err := gqlErrors.WriteResponse(w); err != nil {
+	return writeErrors(errors, w)
+}
+
+func writeResponseErrorsWithStatus(errors error, status int, w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	return writeErrors(errors, w)
+}
+
+func writeErrors(err error, w io.Writer) error {
+	var coded *codedError
+
+	if errors.As(err, &coded) {
+		type responseError struct {
+			Message    string `json:"message"`
+			Extensions struct {
+				Code string `json:"code"`
+			} `json:"extensions"`
+		}
+
+		response := struct {
+			Errors []responseError `json:"errors"`
+		}{
+			Errors: []responseError{{Message: coded.message}},
+		}
+		response.Errors[0].Extensions.Code = coded.code
+		data, _ := json.Marshal(response) // nolint:errchkjson
+		_, err = w.Write(data)
+
 		return err
 	}
 
-	return nil
+	_, err = graphql.RequestErrorsFromError(err).WriteResponse(w)
+
+	return err
 }
 
 func normalizeGraphqlRequest(schema *graphql.Schema, gqlRequest *graphql.Request) error {
@@ -4,19 +4,56 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
 )
 
+const (
+	// wsMaxInspectFrameSize is max payload size of messages will be inspected,
+	// client messages larger than it will be rejected, upstream messages will be passed through.
+	wsMaxInspectFrameSize = 1 << 20
+
+	// wsMaxControlFrameSize is max payload size of control frames defined by RFC 6455.
+	wsMaxControlFrameSize = 125
+
+	// wsStatusBadRequest closes connections sent messages can not be inspected.
+	wsStatusBadRequest ws.StatusCode = 4400
+)
+
+var (
+	errWsInvalidFrame           = &wsCloseError{code: wsStatusBadRequest, reason: "invalid frame"}
+	errWsCompressedMessage      = &wsCloseError{code: wsStatusBadRequest, reason: "compressed messages are not supported"}
+	errWsMessageTooLarge        = &wsCloseError{code: wsStatusBadRequest, reason: "message too large"}
+	errWsUnexpectedContinuation = &wsCloseError{code: wsStatusBadRequest, reason: "unexpected continuation frame"}
+	errWsUninitialized          = &wsCloseError{code: wsStatusUnauthorized, reason: "unauthorized"}
+)
+
 type wsSubscriber interface {
+	onWsConnectionInit(json.RawMessage) (http.Header, error)
 	onWsSubscribe(*graphql.Request) error
 	onWsClose(*graphql.Request, time.Duration)
+	onWsLimitExceeded(limit string)
+}
+
+func (h *Handler) onWsConnectionInit(payload json.RawMessage) (http.Header, error) {
+	if h.ConnectionInit == nil {
+		return nil, nil
+	}
+
+	header, err := h.ConnectionInit.authenticate(payload)
+	h.addMetricsConnectionInit(err)
+
+	return header, err
 }
 
 func (h *Handler) onWsSubscribe(r *graphql.Request) (err error) {
@@ -37,17 +74,29 @@ func (h *Handler) onWsClose(r *graphql.Request, d time.Duration) {
 	h.addMetricsEndRequest(r, d)
 }
 
+func (h *Handler) onWsLimitExceeded(limit string) {
+	h.addMetricsSubscriptionLimitExceeded(limit)
+}
+
 type wsResponseWriter struct {
 	*caddyhttp.ResponseWriterWrapper
-	subscriber wsSubscriber
+	subscriber  wsSubscriber
+	header      http.Header
+	limits      *Subscription
+	translate   bool
+	requireInit bool
 }
 
-func newWebsocketResponseWriter(w http.ResponseWriter, s wsSubscriber) *wsResponseWriter {
+func newWebsocketResponseWriter(w http.ResponseWriter, s wsSubscriber, header http.Header, limits *Subscription, translate, requireInit bool) *wsResponseWriter {
 	return &wsResponseWriter{
 		ResponseWriterWrapper: &caddyhttp.ResponseWriterWrapper{
 			ResponseWriter: w,
 		},
-		subscriber: s,
+		subscriber:  s,
+		header:      header,
+		limits:      limits,
+		translate:   translate,
+		requireInit: requireInit,
 	}
 }
 
@@ -56,18 +105,65 @@ func (r *wsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	c, w, e := r.ResponseWriterWrapper.Hijack()
 
 	if c != nil {
-		c = &wsConn{
-			Conn:         c,
-			wsSubscriber: r.subscriber,
-		}
+		c = newWsConn(c, r.subscriber, r.header, r.limits, r.translate, r.requireInit)
+	}
+
+	if w != nil && r.translate {
+		w = newWsHandshakeReadWriter(w, wsTransportProtocol, wsLegacyProtocol)
 	}
 
 	return c, w, e
 }
 
+// wsConn inspects frames between client and upstream, client frames are read by reverse proxy
+// and forwarded to upstream, upstream frames are written back to client.
 type wsConn struct {
 	net.Conn
 	wsSubscriber
+
+	operationsMu sync.Mutex
+	operations   map[string]*wsOperation
+
+	// headers of handshake request and claims of connection init payload, will be set to subscription requests.
+	header http.Header
+
+	// initialized reports whether connection init message accepted or it is not required,
+	// subscriptions before it will be rejected.
+	initialized bool
+
+	limits              *Subscription
+	messagesWindowStart time.Time
+	messagesCount       int
+
+	// translate subscriptions-transport-ws messages of client to graphql-transport-ws messages of upstream and back.
+	translate bool
+
+	// inbound frames from client, fragments of message will be reassembled before inspecting.
+	in           bytes.Buffer
+	inFragmented bool
+	inOpCode     ws.OpCode
+	inMessage    []byte
+	out          bytes.Buffer
+	readErr      error
+	readOnce     sync.Once
+	rejected     bool
+
+	// outbound frames from upstream.
+	writeMu           sync.Mutex
+	outboundHeader    []byte
+	outboundRemaining int64
+	outboundInspect   bool
+	outboundPayload   []byte
+	outboundBuf       bytes.Buffer
+	pendingFrames     [][]byte
+
+	// fragments of upstream message will be reassembled before translating.
+	outboundFragmented bool
+	outboundOpCode     ws.OpCode
+	outboundMessage    []byte
+}
+
+type wsOperation struct {
 	request     *graphql.Request
 	subscribeAt time.Time
 }
@@ -78,88 +174,596 @@ type wsMessage struct {
 	Payload json.RawMessage `json:"payload,omitempty"`
 }
 
+func newWsConn(c net.Conn, s wsSubscriber, header http.Header, limits *Subscription, translate, requireInit bool) *wsConn {
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &wsConn{
+		Conn:         c,
+		wsSubscriber: s,
+		operations:   make(map[string]*wsOperation),
+		header:       header,
+		limits:       limits,
+		translate:    translate,
+		initialized:  !requireInit,
+	}
+}
+
 func (c *wsConn) Read(b []byte) (n int, err error) {
-	n, err = c.Conn.Read(b)
+	if len(b) == 0 {
+		return c.Conn.Read(b)
+	}
 
-	if c.request != nil && err != nil {
-		c.onWsClose(c.request, time.Since(c.subscribeAt))
-		c.request = nil
+	for c.out.Len() == 0 && c.readErr == nil {
+		if c.limits != nil && c.limits.IdleTimeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(time.Duration(c.limits.IdleTimeout))) // nolint:errcheck
+		}
+
+		n, err = c.Conn.Read(b)
+
+		if netErr := net.Error(nil); errors.As(err, &netErr) && netErr.Timeout() && c.limits != nil && c.limits.IdleTimeout > 0 {
+			c.onWsLimitExceeded(subscriptionLimitIdleTimeout)
+			c.reject(ErrSubscriptionIdleTimeout)
+
+			break
+		}
+
+		c.in.Write(b[:n])
+		c.readErr = err
+		c.inspectInbound()
 	}
 
-	if c.request != nil || err != nil {
-		return n, err
+	if c.out.Len() > 0 {
+		return c.out.Read(b)
 	}
 
-	buff := bufferPool.Get().(*bytes.Buffer)
-	defer bufferPool.Put(buff)
-	buff.Reset()
-	buff.Write(b[:n])
+	c.readOnce.Do(c.closeOperations)
 
-	for {
-		msg := new(wsMessage)
-		request := new(graphql.Request)
-		data, _, e := wsutil.ReadClientData(buff)
+	return 0, c.readErr
+}
 
-		if e != nil {
-			return n, err
+// inspectInbound moves complete messages from inbound buffer to output buffer, messages of rejected operations will be dropped.
+// Fragmented messages are forwarded as single frames after reassembled, connection will be closed with 4400 code
+// when client sent message can not be inspected.
+func (c *wsConn) inspectInbound() {
+	for c.in.Len() > 0 && !c.rejected {
+		data := c.in.Bytes()
+		reader := bytes.NewReader(data)
+		header, err := ws.ReadHeader(reader)
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break // wait for more data.
 		}
 
-		if e = json.Unmarshal(data, msg); e != nil {
+		if err != nil {
+			c.reject(errWsInvalidFrame)
+
+			break
+		}
+
+		if err = c.checkInboundFrame(header); err != nil {
+			c.reject(err)
+
+			break
+		}
+
+		headerSize := int64(len(data) - reader.Len())
+		frameSize := headerSize + header.Length
+
+		if int64(len(data)) < frameSize {
+			break // wait for more data.
+		}
+
+		if header.OpCode.IsControl() {
+			if c.allowMessage() {
+				c.out.Write(c.in.Next(int(frameSize)))
+			}
+
+			continue
+		}
+
+		payload := data[headerSize:frameSize]
+		start := len(c.inMessage)
+		c.inMessage = append(c.inMessage, payload...)
+
+		if header.Masked {
+			ws.Cipher(c.inMessage[start:], header.Mask, 0)
+		}
+
+		frame := c.in.Next(int(frameSize))
+
+		if !c.inFragmented {
+			c.inOpCode = header.OpCode
+		}
+
+		if !header.Fin {
+			c.inFragmented = true
+
 			continue
 		}
 
-		if msg.Type != "subscribe" && msg.Type != "start" {
+		if c.inFragmented {
+			frame = ws.MustCompileFrame(ws.MaskFrameInPlace(ws.NewFrame(c.inOpCode, true, append([]byte(nil), c.inMessage...))))
+		}
+
+		payload = c.inMessage
+		c.inMessage = nil
+		c.inFragmented = false
+
+		if !c.allowMessage() || !c.inspectClientMessage(payload) {
 			continue
 		}
 
-		if e = json.Unmarshal(msg.Payload, request); e != nil {
+		if c.translate {
+			c.translateClientMessage(payload, frame)
+
 			continue
 		}
 
-		if e = c.onWsSubscribe(request); e != nil {
-			c.writeErrorMessage(msg.ID, e)
+		c.out.Write(frame)
+	}
+
+	if c.rejected {
+		c.in.Reset()
+
+		return
+	}
+
+	if c.readErr != nil && c.in.Len() > 0 {
+		c.out.Write(c.in.Next(c.in.Len()))
+	}
+}
+
+// checkInboundFrame returns error when frame given can not be inspected.
+func (c *wsConn) checkInboundFrame(h ws.Header) error {
+	if h.OpCode.IsControl() {
+		if h.Length > wsMaxControlFrameSize {
+			return errWsInvalidFrame
+		}
+
+		return nil
+	}
+
+	if h.Rsv != 0 {
+		return errWsCompressedMessage
+	}
+
+	if (h.OpCode == ws.OpContinuation) != c.inFragmented {
+		return errWsUnexpectedContinuation
+	}
+
+	if int64(len(c.inMessage))+h.Length > wsMaxInspectFrameSize {
+		return errWsMessageTooLarge
+	}
+
+	return nil
+}
+
+// allowMessage counts messages received in current second, connection will be rejected when it exceeded limit.
+func (c *wsConn) allowMessage() bool {
+	if c.limits == nil || c.limits.MaxMessagesPerSecond <= 0 {
+		return true
+	}
+
+	if now := time.Now(); now.Sub(c.messagesWindowStart) >= time.Second {
+		c.messagesWindowStart = now
+		c.messagesCount = 0
+	}
+
+	c.messagesCount++
+
+	if c.messagesCount <= c.limits.MaxMessagesPerSecond {
+		return true
+	}
+
+	c.onWsLimitExceeded(subscriptionLimitMaxMessagesPerSecond)
+	c.reject(ErrSubscriptionTooManyMessages)
+
+	return false
+}
+
+// inspectClientMessage validates and tracks operations subscribed by client, returns false when message should be dropped.
+func (c *wsConn) inspectClientMessage(data []byte) bool {
+	msg := new(wsMessage)
+
+	if err := json.Unmarshal(data, msg); err != nil {
+		return true
+	}
+
+	id := fmt.Sprint(msg.ID)
+
+	switch msg.Type {
+	case "connection_init":
+		header, err := c.onWsConnectionInit(msg.Payload)
+		if err != nil {
+			c.reject(err)
+
+			return false
+		}
+
+		// headers of claims replace the same headers of handshake request even when claims missing,
+		// so client can not spoof them.
+		for name, values := range header {
+			c.header.Del(name)
+
+			for _, value := range values {
+				c.header.Add(name, value)
+			}
+		}
+
+		c.initialized = true
+	case "subscribe", "start":
+		if !c.initialized {
+			c.reject(errWsUninitialized)
+
+			return false
+		}
+
+		request := new(graphql.Request)
+
+		if err := json.Unmarshal(msg.Payload, request); err != nil {
+			return true
+		}
+
+		request.SetHeader(c.header)
+
+		c.operationsMu.Lock()
+		_, exists := c.operations[id]
+		active := len(c.operations)
+		c.operationsMu.Unlock()
+
+		if exists {
+			return true // let upstream handle duplicated id.
+		}
+
+		if c.limits != nil && c.limits.MaxSubscriptions > 0 && active >= c.limits.MaxSubscriptions {
+			c.onWsLimitExceeded(subscriptionLimitMaxSubscriptions)
+			c.writeErrorMessage(msg.ID, ErrSubscriptionMaxSubscriptionsExceeded)
+			c.writeCompleteMessage(msg.ID)
+
+			return false
+		}
+
+		if err := c.onWsSubscribe(request); err != nil {
+			c.writeErrorMessage(msg.ID, err)
 			c.writeCompleteMessage(msg.ID)
 
-			return n, io.EOF
+			return false
 		}
 
-		c.request = request
-		c.subscribeAt = time.Now()
+		c.operationsMu.Lock()
+		c.operations[id] = &wsOperation{
+			request:     request,
+			subscribeAt: time.Now(),
+		}
+		c.operationsMu.Unlock()
+	case "complete", "stop":
+		c.closeOperation(id)
+	}
+
+	return true
+}
 
-		return n, err
+// translateClientMessage writes subscriptions-transport-ws message as graphql-transport-ws message to upstream.
+func (c *wsConn) translateClientMessage(payload, frame []byte) {
+	msgType, translated := translateWsMessage(payload, wsLegacyClientMessageTypes)
+
+	switch {
+	case msgType == "connection_terminate":
+		closeFrame := ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusNormalClosure, ""))
+		ws.WriteFrame(&c.out, ws.MaskFrameInPlace(closeFrame)) // nolint:errcheck
+	case translated != nil:
+		ws.WriteFrame(&c.out, ws.MaskFrameInPlace(ws.NewTextFrame(translated))) // nolint:errcheck
+	default:
+		c.out.Write(frame)
 	}
 }
 
-func (c *wsConn) writeErrorMessage(id interface{}, errMsg error) error {
-	errMsgRaw, errMsgErr := json.Marshal(graphql.RequestErrorsFromError(errMsg))
+// reject closes connection with close code of error given, 4403 code will be used for other errors.
+func (c *wsConn) reject(err error) {
+	code := wsStatusForbidden
+	closeErr := new(wsCloseError)
 
-	if errMsgErr != nil {
-		return errMsgErr
+	if errors.As(err, &closeErr) {
+		code = closeErr.code
 	}
 
-	msg := &wsMessage{
-		ID:      id,
-		Type:    "error",
-		Payload: json.RawMessage(errMsgRaw),
+	frame := new(bytes.Buffer)
+
+	if e := ws.WriteFrame(frame, ws.NewCloseFrame(ws.NewCloseFrameBody(code, err.Error()))); e == nil {
+		c.writeFrame(frame.Bytes()) // nolint:errcheck
+	}
+
+	c.rejected = true
+	c.readErr = err
+}
+
+// inspectServerMessage closes operations completed by upstream.
+func (c *wsConn) inspectServerMessage(data []byte) {
+	msg := new(wsMessage)
+
+	if err := json.Unmarshal(data, msg); err != nil {
+		return
+	}
+
+	if msg.Type == "complete" || msg.Type == "error" {
+		c.closeOperation(fmt.Sprint(msg.ID))
 	}
+}
+
+func (c *wsConn) closeOperation(id string) {
+	c.operationsMu.Lock()
+	defer c.operationsMu.Unlock()
+
+	if operation, ok := c.operations[id]; ok {
+		delete(c.operations, id)
+		c.onWsClose(operation.request, time.Since(operation.subscribeAt))
+	}
+}
+
+func (c *wsConn) closeOperations() {
+	c.operationsMu.Lock()
+	defer c.operationsMu.Unlock()
+
+	for id, operation := range c.operations {
+		delete(c.operations, id)
+		c.onWsClose(operation.request, time.Since(operation.subscribeAt))
+	}
+}
+
+func (c *wsConn) Write(b []byte) (n int, err error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.translate {
+		return c.writeTranslated(b)
+	}
+
+	n, err = c.Conn.Write(b)
+	c.trackOutbound(b[:n])
+
+	if err == nil && c.isOutboundFrameBoundary() {
+		err = c.flushPendingFrames()
+	}
+
+	return n, err
+}
+
+// writeTranslated writes graphql-transport-ws messages of upstream as subscriptions-transport-ws messages to client,
+// fragmented messages will be reassembled before translating, compressed frames will be passed through.
+// Note that pong messages will not be sent to upstream on behalf of client, ping messages are translated to keep alive.
+func (c *wsConn) writeTranslated(b []byte) (int, error) {
+	c.outboundBuf.Write(b)
+
+	for c.outboundBuf.Len() > 0 {
+		if c.outboundRemaining > 0 {
+			chunk := c.outboundBuf.Next(int(minInt64(c.outboundRemaining, int64(c.outboundBuf.Len()))))
+			c.outboundRemaining -= int64(len(chunk))
+
+			if _, err := c.Conn.Write(chunk); err != nil {
+				return 0, err
+			}
+
+			continue
+		}
+
+		data := c.outboundBuf.Bytes()
+		reader := bytes.NewReader(data)
+		header, err := ws.ReadHeader(reader)
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break // wait for more data.
+		}
+
+		if err != nil {
+			if _, err = c.Conn.Write(c.outboundBuf.Next(c.outboundBuf.Len())); err != nil {
+				return 0, err
+			}
+
+			break
+		}
+
+		headerSize := int64(len(data) - reader.Len())
 
+		if header.Rsv != 0 || header.Masked {
+			c.outboundRemaining = header.Length
+
+			if _, err = c.Conn.Write(c.outboundBuf.Next(int(headerSize))); err != nil {
+				return 0, err
+			}
+
+			continue
+		}
+
+		frameSize := headerSize + header.Length
+
+		if int64(len(data)) < frameSize {
+			break // wait for more data.
+		}
+
+		frame := c.outboundBuf.Next(int(frameSize))
+
+		if header.OpCode.IsControl() {
+			if _, err = c.Conn.Write(frame); err != nil {
+				return 0, err
+			}
+
+			continue
+		}
+
+		c.outboundMessage = append(c.outboundMessage, frame[headerSize:]...)
+
+		if !c.outboundFragmented {
+			c.outboundOpCode = header.OpCode
+		}
+
+		if !header.Fin {
+			c.outboundFragmented = true
+
+			continue
+		}
+
+		if err = c.writeTranslatedMessage(c.outboundOpCode, c.outboundMessage); err != nil {
+			return 0, err
+		}
+
+		c.outboundMessage = nil
+		c.outboundFragmented = false
+	}
+
+	if c.isOutboundFrameBoundary() {
+		if err := c.flushPendingFrames(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// writeTranslatedMessage writes whole upstream message given as single frame to client.
+func (c *wsConn) writeTranslatedMessage(opCode ws.OpCode, payload []byte) error {
+	if opCode == ws.OpText {
+		c.inspectServerMessage(payload)
+		msgType, translated := translateWsMessage(payload, wsLegacyServerMessageTypes)
+
+		switch msgType {
+		case "pong":
+			return nil
+		case "error":
+			translated = translateWsErrorMessage(payload)
+		}
+
+		if translated != nil {
+			payload = translated
+		}
+	}
+
+	return ws.WriteFrame(c.Conn, ws.NewFrame(opCode, true, payload))
+}
+
+// trackOutbound tracks frame boundaries of upstream data, so frames written by gbox will not be interleaved with them.
+func (c *wsConn) trackOutbound(b []byte) {
+	for len(b) > 0 {
+		if c.outboundRemaining > 0 {
+			k := minInt64(c.outboundRemaining, int64(len(b)))
+
+			if c.outboundInspect {
+				c.outboundPayload = append(c.outboundPayload, b[:k]...)
+			}
+
+			c.outboundRemaining -= k
+			b = b[k:]
+
+			if c.outboundRemaining == 0 && c.outboundInspect {
+				c.inspectServerMessage(c.outboundPayload)
+				c.outboundPayload = c.outboundPayload[:0]
+			}
+
+			continue
+		}
+
+		c.outboundHeader = append(c.outboundHeader, b[0])
+		b = b[1:]
+		header, err := ws.ReadHeader(bytes.NewReader(c.outboundHeader))
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			continue
+		}
+
+		c.outboundHeader = c.outboundHeader[:0]
+
+		if err != nil {
+			continue
+		}
+
+		c.outboundRemaining = header.Length
+		c.outboundInspect = isInspectableWsFrame(header) && !header.Masked
+	}
+}
+
+func (c *wsConn) isOutboundFrameBoundary() bool {
+	return c.outboundRemaining == 0 && len(c.outboundHeader) == 0
+}
+
+func (c *wsConn) flushPendingFrames() error {
+	for len(c.pendingFrames) > 0 {
+		frame := c.pendingFrames[0]
+		c.pendingFrames = c.pendingFrames[1:]
+
+		if _, err := c.Conn.Write(frame); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFrame writes frame to client immediately if upstream frame is not in progress, otherwise after it.
+func (c *wsConn) writeFrame(frame []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if !c.isOutboundFrameBoundary() {
+		c.pendingFrames = append(c.pendingFrames, frame)
+
+		return nil
+	}
+
+	_, err := c.Conn.Write(frame)
+
+	return err
+}
+
+func (c *wsConn) writeMessage(msg *wsMessage) error {
 	payload, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
-	return wsutil.WriteServerText(c, payload)
+	frame := new(bytes.Buffer)
+
+	if err = wsutil.WriteServerText(frame, payload); err != nil {
+		return err
+	}
+
+	return c.writeFrame(frame.Bytes())
+}
+
+func (c *wsConn) writeErrorMessage(id interface{}, errMsg error) error {
+	errMsgRaw, errMsgErr := json.Marshal(graphql.RequestErrorsFromError(errMsg))
+
+	if errMsgErr != nil {
+		return errMsgErr
+	}
+
+	if c.translate {
+		errMsgRaw, _ = wsLegacyErrorPayload(errMsgRaw)
+	}
+
+	return c.writeMessage(&wsMessage{
+		ID:      id,
+		Type:    "error",
+		Payload: json.RawMessage(errMsgRaw),
+	})
 }
 
 func (c *wsConn) writeCompleteMessage(id interface{}) error {
-	msg := &wsMessage{
+	return c.writeMessage(&wsMessage{
 		ID:   id,
 		Type: "complete",
-	}
-	payload, err := json.Marshal(msg)
-	if err != nil {
-		return err
+	})
+}
+
+// isInspectableWsFrame reports whether frame is a whole text message not compressed and small enough to be inspected.
+func isInspectableWsFrame(h ws.Header) bool {
+	return h.OpCode == ws.OpText && h.Fin && h.Rsv == 0 && h.Length <= wsMaxInspectFrameSize
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
 	}
 
-	return wsutil.WriteServerText(c, payload)
+	return b
 }
@@ -0,0 +1,218 @@
+package gbox
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/gobwas/ws/wsutil"
+)
+
+const (
+	wsTransportProtocol  = "graphql-transport-ws"
+	wsUpstreamAckTimeout = 10 * time.Second
+)
+
+var (
+	ErrWsUpstreamConnectionNotAcknowledged = errors.New("upstream websocket connection not acknowledged")
+	ErrWsUpstreamHandshakeFailed           = errors.New("upstream websocket handshake failed")
+)
+
+// wsUpstreamSkipHeaders of client request will not be forwarded to upstream in websocket handshake,
+// other headers are filtered by reverse proxy as same as http requests.
+var wsUpstreamSkipHeaders = []string{
+	"Accept",
+	"Accept-Encoding",
+	"Content-Length",
+	"Content-Type",
+	"Sec-Websocket-Extensions",
+}
+
+// wsUpstreamConn is a graphql-transport-ws protocol client connection to upstream.
+type wsUpstreamConn struct {
+	conn   net.Conn
+	reader io.Reader
+	mu     sync.Mutex
+}
+
+// wsUpstreamResponseWriter hands over connection hijacked by reverse proxy after upstream switched protocols.
+type wsUpstreamResponseWriter struct {
+	header http.Header
+	status int
+	conn   net.Conn
+}
+
+func (w *wsUpstreamResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *wsUpstreamResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil // discard body of upstream response not switching protocols.
+}
+
+func (w *wsUpstreamResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *wsUpstreamResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
+
+// newWsUpstreamHandshakeRequest creates websocket handshake request from client request given,
+// it will be sent to the same upstream of http requests.
+func newWsUpstreamHandshakeRequest(r *http.Request) (*http.Request, error) {
+	key := make([]byte, 16)
+
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	handshake := r.Clone(r.Context())
+	handshake.Method = http.MethodGet
+	handshake.Body = http.NoBody
+	handshake.ContentLength = 0
+
+	for _, name := range wsUpstreamSkipHeaders {
+		handshake.Header.Del(name)
+	}
+
+	handshake.Header.Set("Connection", "Upgrade")
+	handshake.Header.Set("Upgrade", "websocket")
+	handshake.Header.Set("Sec-Websocket-Version", "13")
+	handshake.Header.Set("Sec-Websocket-Key", base64.StdEncoding.EncodeToString(key))
+	handshake.Header.Set("Sec-Websocket-Protocol", wsTransportProtocol)
+
+	return handshake, nil
+}
+
+// dialWsUpstream open graphql-transport-ws connection to upstream via handler given, so the connection uses
+// the same transport, upstream and headers rules of http requests, and wait for connection acknowledged.
+func dialWsUpstream(r *http.Request, upstream caddyhttp.HandlerFunc, initPayload json.RawMessage) (*wsUpstreamConn, error) {
+	handshake, err := newWsUpstreamHandshakeRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, proxyConn := net.Pipe()
+	w := &wsUpstreamResponseWriter{header: make(http.Header), conn: proxyConn}
+	proxyErr := make(chan error, 1)
+
+	go func() {
+		// reverse proxy blocks until upgraded connection closed.
+		proxyErr <- upstream(w, handshake)
+		proxyConn.Close()
+	}()
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, handshake)
+
+	if err != nil {
+		conn.Close()
+
+		if err = <-proxyErr; err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrWsUpstreamHandshakeFailed, w.status)
+	}
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrWsUpstreamHandshakeFailed, res.StatusCode)
+	}
+
+	c := &wsUpstreamConn{
+		conn:   conn,
+		reader: br,
+	}
+
+	if err = c.init(initPayload); err != nil {
+		c.Close()
+
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *wsUpstreamConn) init(payload json.RawMessage) error {
+	if err := c.writeMessage(&wsMessage{Type: "connection_init", Payload: payload}); err != nil {
+		return err
+	}
+
+	if err := c.conn.SetReadDeadline(time.Now().Add(wsUpstreamAckTimeout)); err != nil {
+		return err
+	}
+
+	msg, err := c.readMessage()
+	if err != nil {
+		return err
+	}
+
+	if msg.Type != "connection_ack" {
+		return ErrWsUpstreamConnectionNotAcknowledged
+	}
+
+	return c.conn.SetReadDeadline(time.Time{})
+}
+
+func (c *wsUpstreamConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *wsUpstreamConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn.Write(b)
+}
+
+func (c *wsUpstreamConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *wsUpstreamConn) readMessage() (*wsMessage, error) {
+	data, _, err := wsutil.ReadServerData(c)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(wsMessage)
+
+	if err = json.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (c *wsUpstreamConn) writeMessage(msg *wsMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	// write whole frame at once, so it will not be interleaved with control frames.
+	buff := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buff)
+	buff.Reset()
+
+	if err = wsutil.WriteClientText(buff, data); err != nil {
+		return err
+	}
+
+	_, err = c.Write(buff.Bytes())
+
+	return err
+}
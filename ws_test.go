@@ -8,48 +8,80 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"os"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
+	"github.com/caddyserver/caddy/v2"
+	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	"github.com/jensneuse/graphql-go-tools/pkg/graphql"
 	"github.com/stretchr/testify/require"
 )
 
 type testWsSubscriber struct {
-	t *testing.T
-	r *graphql.Request
-	d time.Duration
-	e error
+	t          *testing.T
+	r          *graphql.Request
+	d          time.Duration
+	e          error
+	subscribed int
+	closed     int
+	initHeader http.Header
+	initErr    error
+	exceeded   map[string]int
+}
+
+func (t *testWsSubscriber) onWsConnectionInit(json.RawMessage) (http.Header, error) {
+	return t.initHeader, t.initErr
 }
 
 func (t *testWsSubscriber) onWsSubscribe(request *graphql.Request) error {
 	t.r = request
 
-	return t.e
+	if t.e != nil {
+		return t.e
+	}
+
+	t.subscribed++
+
+	return nil
 }
 
 func (t *testWsSubscriber) onWsClose(request *graphql.Request, duration time.Duration) {
-	require.Equal(t.t, t.r, request)
+	require.NotNil(t.t, request)
 	t.d = duration
+	t.closed++
+}
+
+func (t *testWsSubscriber) onWsLimitExceeded(limit string) {
+	if t.exceeded == nil {
+		t.exceeded = make(map[string]int)
+	}
+
+	t.exceeded[limit]++
 }
 
 type testWsResponseWriter struct {
 	http.ResponseWriter
 	wsConnBuff *bytes.Buffer
+	clientData io.Reader
+	limits     *Subscription
 }
 
 type testWsConn struct {
 	net.Conn
+	reader io.Reader
 	buffer *bytes.Buffer
 }
 
 func (c *testWsConn) Read(b []byte) (n int, err error) {
-	if b == nil {
-		return 0, errors.New("end")
-	}
+	return c.reader.Read(b)
+}
 
-	return len(b), nil
+func (c *testWsConn) SetReadDeadline(time.Time) error {
+	return nil
 }
 
 func (c *testWsConn) Write(b []byte) (n int, err error) {
@@ -58,6 +90,7 @@ func (c *testWsConn) Write(b []byte) (n int, err error) {
 
 func (t *testWsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return &testWsConn{
+		reader: t.clientData,
 		buffer: t.wsConnBuff,
 	}, nil, nil
 }
@@ -71,24 +104,74 @@ func newTestWsSubscriber(t *testing.T, err error) *testWsSubscriber {
 	}
 }
 
-func TestWsMetricsConn(t *testing.T) {
-	s := newTestWsSubscriber(t, nil)
-	w := newWebsocketResponseWriter(&testWsResponseWriter{wsConnBuff: new(bytes.Buffer)}, s)
+func newTestWsConn(t *testing.T, s wsSubscriber, clientData io.Reader, wsConnBuff *bytes.Buffer) net.Conn {
+	t.Helper()
+
+	return newTestWsConnWithLimits(t, s, clientData, wsConnBuff, nil)
+}
+
+func newTestWsConnWithLimits(t *testing.T, s wsSubscriber, clientData io.Reader, wsConnBuff *bytes.Buffer, limits *Subscription) net.Conn {
+	t.Helper()
+
+	w := newWebsocketResponseWriter(&testWsResponseWriter{wsConnBuff: wsConnBuff, clientData: clientData}, s, nil, limits, false, false)
 	conn, _, _ := w.Hijack()
+
+	return conn
+}
+
+func newTestWsClientFrames(messages ...string) []byte {
 	buff := new(bytes.Buffer)
-	wsutil.WriteClientText(buff, []byte(`{"type": "start", "payload":{"query": "subscription { users { id } }"}}`))
 
-	n, err := conn.Read(buff.Bytes()) // subscribe
+	for _, message := range messages {
+		wsutil.WriteClientText(buff, []byte(message))
+	}
 
-	require.NoError(t, err)
-	require.Greater(t, n, 0)
-	require.NotNil(t, s.r)
-	require.Equal(t, s.d, time.Duration(0))
+	return buff.Bytes()
+}
 
-	conn.Read(nil) // end
+func TestWsMetricsConn(t *testing.T) {
+	s := newTestWsSubscriber(t, nil)
+	frames := newTestWsClientFrames(
+		`{"type": "connection_init"}`,
+		`{"id": "1", "type": "subscribe", "payload":{"query": "subscription { users { id } }"}}`,
+		`{"id": "2", "type": "subscribe", "payload":{"query": "subscription { books { id } }"}}`,
+		`{"id": "1", "type": "complete"}`,
+	)
+	conn := newTestWsConn(t, s, iotest.OneByteReader(bytes.NewReader(frames)), new(bytes.Buffer))
+	forwarded, err := io.ReadAll(conn)
+
+	require.NoError(t, err)
+	require.Equal(t, frames, forwarded, "all frames should be forwarded")
+	require.Equal(t, 2, s.subscribed)
+	require.Equal(t, 2, s.closed, "all operations should be closed when connection dropped")
 	require.Greater(t, s.d, time.Duration(0))
 }
 
+func TestWsMetricsConnServerComplete(t *testing.T) {
+	s := newTestWsSubscriber(t, nil)
+	frames := newTestWsClientFrames(
+		`{"type": "connection_init"}`,
+		`{"id": "1", "type": "subscribe", "payload":{"query": "subscription { users { id } }"}}`,
+	)
+	conn := newTestWsConn(t, s, bytes.NewReader(frames), new(bytes.Buffer))
+	b := make([]byte, 1024)
+	_, err := conn.Read(b)
+
+	require.NoError(t, err)
+	require.Equal(t, 1, s.subscribed)
+
+	serverFrames := new(bytes.Buffer)
+	wsutil.WriteServerText(serverFrames, []byte(`{"id": "1", "type": "next", "payload": {"data": {}}}`))
+	wsutil.WriteServerText(serverFrames, []byte(`{"id": "1", "type": "complete"}`))
+
+	for _, c := range serverFrames.Bytes() {
+		_, err = conn.Write([]byte{c})
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, 1, s.closed, "operation should be closed when upstream completed it")
+}
+
 func TestWsMetricsConnBadCases(t *testing.T) {
 	testCases := map[string]struct {
 		message string
@@ -105,7 +188,7 @@ func TestWsMetricsConnBadCases(t *testing.T) {
 		},
 		"invalid_ws_message": {},
 		"invalid_query": {
-			message: `{"type": "start", "payload": {"query": "query { user { id } }"}}`,
+			message: `{"id": "1", "type": "start", "payload": {"query": "query { user { id } }"}}`,
 			err:     errors.New("test"),
 		},
 	}
@@ -113,38 +196,508 @@ func TestWsMetricsConnBadCases(t *testing.T) {
 	for name, testCase := range testCases {
 		wsConnBuff := new(bytes.Buffer)
 		s := newTestWsSubscriber(t, testCase.err)
-		w := newWebsocketResponseWriter(&testWsResponseWriter{wsConnBuff: wsConnBuff}, s)
-		conn, _, _ := w.Hijack()
-		buff := new(bytes.Buffer)
+		var frames []byte
 
-		if testCase.message != "invalid_ws_message" {
-			wsutil.WriteClientText(buff, []byte(testCase.message))
+		initFrame := newTestWsClientFrames(`{"type": "connection_init"}`)
+
+		if name != "invalid_ws_message" {
+			frames = append(initFrame, newTestWsClientFrames(testCase.message)...) // nolint:gocritic
 		} else {
-			buff.Write([]byte(name))
+			frames = []byte(name)
 		}
 
-		n, err := conn.Read(buff.Bytes())
+		conn := newTestWsConn(t, s, bytes.NewReader(frames), wsConnBuff)
+		forwarded, err := io.ReadAll(conn)
 
-		require.Greaterf(t, n, 0, "case %s: read bytes should greater than 0", name)
-		require.Equalf(t, s.d, time.Duration(0), "case %s: duration should be 0", name)
+		require.NoErrorf(t, err, "case %s: err should be nil", name)
+		require.Equalf(t, 0, s.closed, "case %s: should not have operation closed", name)
 
 		if s.e == nil {
+			require.Equalf(t, frames, forwarded, "case %s: frames should be forwarded", name)
 			require.Nilf(t, s.r, "case %s: request should be nil", name)
-			require.Nilf(t, err, "case %s: err should be nil", name)
-		} else {
-			require.Equalf(t, io.EOF, err, "case %s: should be EOF", name)
-			require.NotNilf(t, s.r, "case %s: request should not be nil", name)
-			data, _ := wsutil.ReadServerText(wsConnBuff)
-			msg := &wsMessage{}
-			json.Unmarshal(data, msg)
 
-			require.Equalf(t, "error", msg.Type, "case %s: unexpected error type", name)
+			continue
+		}
+
+		require.Equalf(t, initFrame, forwarded, "case %s: frames of rejected operation should not be forwarded", name)
+		require.NotNilf(t, s.r, "case %s: request should not be nil", name)
+		data, _ := wsutil.ReadServerText(wsConnBuff)
+		msg := &wsMessage{}
+		json.Unmarshal(data, msg)
+
+		require.Equalf(t, "error", msg.Type, "case %s: unexpected error type", name)
+		require.Equalf(t, "1", msg.ID, "case %s: unexpected message id", name)
+
+		data, _ = wsutil.ReadServerText(wsConnBuff)
+		msg = &wsMessage{}
+		json.Unmarshal(data, msg)
+
+		require.Equalf(t, "complete", msg.Type, "case %s: msg type should be complete, but got %s", name, msg.Type)
+	}
+}
+
+func TestWsConnWriteFrameAfterUpstreamFrame(t *testing.T) {
+	wsConnBuff := new(bytes.Buffer)
+	s := newTestWsSubscriber(t, errors.New("test"))
+	frames := newTestWsClientFrames(
+		`{"type": "connection_init"}`,
+		`{"id": "1", "type": "subscribe", "payload":{"query": "subscription { users { id } }"}}`,
+	)
+	conn := newTestWsConn(t, s, bytes.NewReader(frames), wsConnBuff)
+	serverFrame := new(bytes.Buffer)
+	wsutil.WriteServerText(serverFrame, []byte(`{"id": "2", "type": "next", "payload": {"data": {}}}`))
+	half := serverFrame.Len() / 2
+
+	conn.Write(serverFrame.Bytes()[:half])
+	io.ReadAll(conn) // error message of rejected subscription will be written after upstream frame.
+	conn.Write(serverFrame.Bytes()[half:])
+
+	for _, expected := range []string{"next", "error", "complete"} {
+		data, err := wsutil.ReadServerText(wsConnBuff)
+		require.NoError(t, err)
+
+		msg := &wsMessage{}
+		json.Unmarshal(data, msg)
+
+		require.Equal(t, expected, msg.Type)
+	}
+}
+
+func TestWsConnFragmentedMessage(t *testing.T) {
+	wsConnBuff := new(bytes.Buffer)
+	s := newTestWsSubscriber(t, nil)
+	message := []byte(`{"id": "1", "type": "subscribe", "payload":{"query": "subscription { users { id } }"}}`)
+	initFrame := newTestWsClientFrames(`{"type": "connection_init"}`)
+	frames := bytes.NewBuffer(initFrame)
+	ws.WriteFrame(frames, ws.MaskFrameInPlace(ws.NewFrame(ws.OpText, false, append([]byte(nil), message[:10]...))))
+	ws.WriteFrame(frames, ws.MaskFrameInPlace(ws.NewPingFrame(nil)))
+	ws.WriteFrame(frames, ws.MaskFrameInPlace(ws.NewFrame(ws.OpContinuation, true, append([]byte(nil), message[10:]...))))
+	conn := newTestWsConn(t, s, iotest.OneByteReader(frames), wsConnBuff)
+	forwarded, err := io.ReadAll(conn)
+
+	require.NoError(t, err)
+	require.Equal(t, 1, s.subscribed, "fragmented message should be inspected")
+
+	require.Equal(t, initFrame, forwarded[:len(initFrame)])
+
+	forwardedReader := bytes.NewReader(forwarded[len(initFrame):])
+	frame, err := ws.ReadFrame(forwardedReader)
+	require.NoError(t, err)
+	require.Equal(t, ws.OpPing, frame.Header.OpCode, "control frames should be forwarded as is")
+
+	frame, err = ws.ReadFrame(forwardedReader)
+	require.NoError(t, err)
+	require.True(t, frame.Header.Fin, "fragmented message should be forwarded as single frame")
+	require.True(t, frame.Header.Masked)
+
+	ws.Cipher(frame.Payload, frame.Header.Mask, 0)
+	require.Equal(t, message, frame.Payload)
+	require.Zero(t, forwardedReader.Len())
+}
+
+func TestWsConnFragmentedMessageRejected(t *testing.T) {
+	message := []byte(`{"id": "1", "type": "subscribe", "payload":{"query": "query { user { id } }"}}`)
+	initFrame := newTestWsClientFrames(`{"type": "connection_init"}`)
+	frames := bytes.NewBuffer(initFrame)
+	ws.WriteFrame(frames, ws.MaskFrameInPlace(ws.NewFrame(ws.OpText, false, append([]byte(nil), message[:10]...))))
+	ws.WriteFrame(frames, ws.MaskFrameInPlace(ws.NewFrame(ws.OpContinuation, true, append([]byte(nil), message[10:]...))))
+	wsConnBuff := new(bytes.Buffer)
+	s := newTestWsSubscriber(t, errors.New("test"))
+	conn := newTestWsConn(t, s, frames, wsConnBuff)
+	forwarded, err := io.ReadAll(conn)
+
+	require.NoError(t, err)
+	require.Equal(t, initFrame, forwarded, "fragments of rejected operation should not be forwarded")
+
+	for _, expected := range []string{"error", "complete"} {
+		data, err := wsutil.ReadServerText(wsConnBuff)
+		require.NoError(t, err)
+
+		msg := &wsMessage{}
+		json.Unmarshal(data, msg)
+
+		require.Equal(t, expected, msg.Type)
+	}
+}
+
+func TestWsConnUninspectableMessageRejected(t *testing.T) {
+	testCases := map[string]struct {
+		frames   []ws.Frame
+		expected error
+	}{
+		"compressed": {
+			frames: []ws.Frame{
+				{Header: ws.Header{OpCode: ws.OpText, Fin: true, Rsv: ws.Rsv(true, false, false)}, Payload: []byte(`{}`)},
+			},
+			expected: errWsCompressedMessage,
+		},
+		"too_large": {
+			frames: []ws.Frame{
+				ws.NewTextFrame(bytes.Repeat([]byte(" "), wsMaxInspectFrameSize+1)),
+			},
+			expected: errWsMessageTooLarge,
+		},
+		"fragments_too_large": {
+			frames: []ws.Frame{
+				ws.NewFrame(ws.OpText, false, bytes.Repeat([]byte(" "), wsMaxInspectFrameSize)),
+				ws.NewFrame(ws.OpContinuation, true, []byte(" ")),
+			},
+			expected: errWsMessageTooLarge,
+		},
+		"unexpected_continuation": {
+			frames: []ws.Frame{
+				ws.NewFrame(ws.OpContinuation, true, []byte(`{}`)),
+			},
+			expected: errWsUnexpectedContinuation,
+		},
+		"missing_continuation": {
+			frames: []ws.Frame{
+				ws.NewFrame(ws.OpText, false, []byte(`{`)),
+				ws.NewTextFrame([]byte(`{}`)),
+			},
+			expected: errWsUnexpectedContinuation,
+		},
+	}
+
+	for name, testCase := range testCases {
+		frames := new(bytes.Buffer)
+
+		for _, frame := range testCase.frames {
+			ws.WriteFrame(frames, ws.MaskFrameInPlace(frame))
+		}
+
+		wsConnBuff := new(bytes.Buffer)
+		s := newTestWsSubscriber(t, nil)
+		conn := newTestWsConn(t, s, frames, wsConnBuff)
+		forwarded, err := io.ReadAll(conn)
+
+		require.ErrorIsf(t, err, testCase.expected, "case %s: unexpected error", name)
+		require.Emptyf(t, forwarded, "case %s: frames should not be forwarded", name)
+
+		frame, err := ws.ReadFrame(wsConnBuff)
+		require.NoErrorf(t, err, "case %s: unexpected error", name)
+
+		code, _ := ws.ParseCloseFrameData(frame.Payload)
+		require.Equalf(t, wsStatusBadRequest, code, "case %s: unexpected close code", name)
+	}
+}
+
+func TestWsConnConnectionInit(t *testing.T) {
+	s := newTestWsSubscriber(t, nil)
+	s.initHeader = http.Header{"X-User-Id": []string{"1"}}
+	frames := newTestWsClientFrames(
+		`{"type": "connection_init", "payload": {"token": "test"}}`,
+		`{"id": "1", "type": "subscribe", "payload":{"query": "subscription { users { id } }"}}`,
+	)
+	conn := newTestWsConn(t, s, bytes.NewReader(frames), new(bytes.Buffer))
+	forwarded, err := io.ReadAll(conn)
+
+	require.NoError(t, err)
+	require.Equal(t, frames, forwarded)
+	require.Equal(t, 1, s.subscribed)
+	require.Equal(t, "1", conn.(*wsConn).header.Get("x-user-id"), "claims should be set to headers of subscription requests")
+}
+
+func TestWsConnConnectionInitReplaceClaimHeaders(t *testing.T) {
+	s := newTestWsSubscriber(t, nil)
+	s.initHeader = http.Header{"X-User-Id": []string{"1"}, "X-User-Roles": nil}
+	frames := newTestWsClientFrames(
+		`{"type": "connection_init", "payload": {"token": "test"}}`,
+	)
+	header := http.Header{"X-User-Id": []string{"2"}, "X-User-Roles": []string{"admin"}, "X-Tenant": []string{"1"}}
+	w := newWebsocketResponseWriter(&testWsResponseWriter{wsConnBuff: new(bytes.Buffer), clientData: bytes.NewReader(frames)}, s, header, nil, false, false)
+	conn, _, _ := w.Hijack()
+	_, err := io.ReadAll(conn)
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"1"}, conn.(*wsConn).header.Values("x-user-id"))
+	require.Empty(t, conn.(*wsConn).header.Values("x-user-roles"), "spoofed header of missing claim should be removed")
+	require.Equal(t, "1", conn.(*wsConn).header.Get("x-tenant"))
+}
+
+func TestWsConnSubscribeBeforeConnectionInit(t *testing.T) {
+	wsConnBuff := new(bytes.Buffer)
+	s := newTestWsSubscriber(t, nil)
+	frames := newTestWsClientFrames(
+		`{"id": "1", "type": "subscribe", "payload":{"query": "subscription { users { id } }"}}`,
+		`{"type": "connection_init"}`,
+	)
+	w := newWebsocketResponseWriter(&testWsResponseWriter{wsConnBuff: wsConnBuff, clientData: bytes.NewReader(frames)}, s, nil, nil, false, true)
+	conn, _, _ := w.Hijack()
+	forwarded, err := io.ReadAll(conn)
+
+	require.ErrorIs(t, err, errWsUninitialized)
+	require.Empty(t, forwarded)
+	require.Equal(t, 0, s.subscribed)
+
+	frame, err := ws.ReadFrame(wsConnBuff)
+	require.NoError(t, err)
+
+	code, _ := ws.ParseCloseFrameData(frame.Payload)
+	require.Equal(t, wsStatusUnauthorized, code)
+
+	// connection init is not required when it is not configured.
+	s = newTestWsSubscriber(t, nil)
+	frames = newTestWsClientFrames(`{"id": "1", "type": "subscribe", "payload":{"query": "subscription { users { id } }"}}`)
+	conn = newTestWsConn(t, s, bytes.NewReader(frames), new(bytes.Buffer))
+	forwarded, err = io.ReadAll(conn)
+
+	require.NoError(t, err)
+	require.Equal(t, frames, forwarded)
+	require.Equal(t, 1, s.subscribed)
+}
+
+func TestWsConnConnectionInitRejected(t *testing.T) {
+	testCases := map[string]struct {
+		err          error
+		expectedCode ws.StatusCode
+	}{
+		"unauthorized": {
+			err:          &wsCloseError{code: wsStatusUnauthorized, reason: "missing token"},
+			expectedCode: wsStatusUnauthorized,
+		},
+		"forbidden": {
+			err:          &wsCloseError{code: wsStatusForbidden, reason: "invalid issuer"},
+			expectedCode: wsStatusForbidden,
+		},
+		"unknown": {
+			err:          errors.New("unknown"),
+			expectedCode: wsStatusForbidden,
+		},
+	}
+
+	for name, testCase := range testCases {
+		wsConnBuff := new(bytes.Buffer)
+		s := newTestWsSubscriber(t, nil)
+		s.initErr = testCase.err
+		frames := newTestWsClientFrames(
+			`{"type": "connection_init", "payload": {}}`,
+			`{"id": "1", "type": "subscribe", "payload":{"query": "subscription { users { id } }"}}`,
+		)
+		conn := newTestWsConn(t, s, bytes.NewReader(frames), wsConnBuff)
+		forwarded, err := io.ReadAll(conn)
+
+		require.ErrorIsf(t, err, testCase.err, "case %s: unexpected error", name)
+		require.Emptyf(t, forwarded, "case %s: frames should not be forwarded", name)
+		require.Equalf(t, 0, s.subscribed, "case %s: should not have operation subscribed", name)
+
+		frame, err := ws.ReadFrame(wsConnBuff)
+		require.NoErrorf(t, err, "case %s: unexpected error", name)
+		require.Equalf(t, ws.OpClose, frame.Header.OpCode, "case %s: should be close frame", name)
+
+		code, reason := ws.ParseCloseFrameData(frame.Payload)
+		require.Equalf(t, testCase.expectedCode, code, "case %s: unexpected close code", name)
+		require.Equalf(t, testCase.err.Error(), reason, "case %s: unexpected close reason", name)
+	}
+}
+
+func TestWsConnMaxSubscriptions(t *testing.T) {
+	wsConnBuff := new(bytes.Buffer)
+	s := newTestWsSubscriber(t, nil)
+	allowed := newTestWsClientFrames(
+		`{"type": "connection_init"}`,
+		`{"id": "1", "type": "subscribe", "payload":{"query": "subscription { users { id } }"}}`,
+	)
+	frames := append(allowed, newTestWsClientFrames( // nolint:gocritic
+		`{"id": "2", "type": "subscribe", "payload":{"query": "subscription { books { id } }"}}`,
+	)...)
+	conn := newTestWsConnWithLimits(t, s, bytes.NewReader(frames), wsConnBuff, &Subscription{MaxSubscriptions: 1})
+	forwarded, err := io.ReadAll(conn)
+
+	require.NoError(t, err)
+	require.Equal(t, allowed, forwarded, "subscription exceeded should not be forwarded")
+	require.Equal(t, 1, s.subscribed)
+	require.Equal(t, 1, s.exceeded[subscriptionLimitMaxSubscriptions])
+
+	for _, expected := range []string{"error", "complete"} {
+		data, err := wsutil.ReadServerText(wsConnBuff)
+		require.NoError(t, err)
+
+		msg := &wsMessage{}
+		json.Unmarshal(data, msg)
+
+		require.Equal(t, expected, msg.Type)
+		require.Equal(t, "2", msg.ID)
+	}
+}
+
+func TestWsConnMaxMessagesPerSecond(t *testing.T) {
+	wsConnBuff := new(bytes.Buffer)
+	s := newTestWsSubscriber(t, nil)
+	allowed := newTestWsClientFrames(`{"type": "connection_init"}`, `{"type": "ping"}`)
+	frames := append(allowed, newTestWsClientFrames(`{"type": "ping"}`)...) // nolint:gocritic
+	conn := newTestWsConnWithLimits(t, s, bytes.NewReader(frames), wsConnBuff, &Subscription{MaxMessagesPerSecond: 2})
+	forwarded, err := io.ReadAll(conn)
+
+	require.ErrorIs(t, err, ErrSubscriptionTooManyMessages)
+	require.Equal(t, allowed, forwarded)
+	require.Equal(t, 1, s.exceeded[subscriptionLimitMaxMessagesPerSecond])
+
+	frame, err := ws.ReadFrame(wsConnBuff)
+	require.NoError(t, err)
+
+	code, _ := ws.ParseCloseFrameData(frame.Payload)
+	require.Equal(t, wsStatusTooManyMessages, code)
+}
+
+type testWsTimeoutReader struct{}
+
+func (testWsTimeoutReader) Read([]byte) (int, error) {
+	return 0, os.ErrDeadlineExceeded
+}
+
+func TestWsConnIdleTimeout(t *testing.T) {
+	wsConnBuff := new(bytes.Buffer)
+	s := newTestWsSubscriber(t, nil)
+	frames := newTestWsClientFrames(`{"type": "connection_init"}`)
+	limits := &Subscription{IdleTimeout: caddy.Duration(time.Second)}
+	conn := newTestWsConnWithLimits(t, s, io.MultiReader(bytes.NewReader(frames), testWsTimeoutReader{}), wsConnBuff, limits)
+	forwarded, err := io.ReadAll(conn)
+
+	require.ErrorIs(t, err, ErrSubscriptionIdleTimeout)
+	require.Equal(t, frames, forwarded)
+	require.Equal(t, 1, s.exceeded[subscriptionLimitIdleTimeout])
+
+	frame, err := ws.ReadFrame(wsConnBuff)
+	require.NoError(t, err)
+
+	code, _ := ws.ParseCloseFrameData(frame.Payload)
+	require.Equal(t, wsStatusIdleTimeout, code)
+}
+
+func TestWsConnTranslateLegacyProtocol(t *testing.T) {
+	wsConnBuff := new(bytes.Buffer)
+	s := newTestWsSubscriber(t, nil)
+	frames := newTestWsClientFrames(
+		`{"type": "connection_init"}`,
+		`{"id": "1", "type": "start", "payload":{"query": "subscription { users { id } }"}}`,
+		`{"id": "1", "type": "stop"}`,
+		`{"type": "connection_terminate"}`,
+	)
+	w := newWebsocketResponseWriter(&testWsResponseWriter{wsConnBuff: wsConnBuff, clientData: bytes.NewReader(frames)}, s, nil, nil, true, false)
+	conn, _, _ := w.Hijack()
+	forwarded, err := io.ReadAll(conn)
+
+	require.NoError(t, err)
+	require.Equal(t, 1, s.subscribed)
+	require.Equal(t, 1, s.closed)
+
+	forwardedReader := bytes.NewReader(forwarded)
+
+	for _, expected := range []string{"connection_init", "subscribe", "complete"} {
+		frame, err := ws.ReadFrame(forwardedReader)
+		require.NoError(t, err)
+		require.True(t, frame.Header.Masked, "client frames should be masked")
+
+		ws.Cipher(frame.Payload, frame.Header.Mask, 0)
+		msg := &wsMessage{}
+		json.Unmarshal(frame.Payload, msg)
+
+		require.Equal(t, expected, msg.Type)
+	}
+
+	frame, err := ws.ReadFrame(forwardedReader)
+	require.NoError(t, err)
+	require.Equal(t, ws.OpClose, frame.Header.OpCode, "connection terminate should be translated to close frame")
+
+	serverFrames := new(bytes.Buffer)
+	wsutil.WriteServerText(serverFrames, []byte(`{"type": "connection_ack"}`))
+	wsutil.WriteServerText(serverFrames, []byte(`{"type": "ping"}`))
+	wsutil.WriteServerText(serverFrames, []byte(`{"type": "pong"}`))
+	wsutil.WriteServerText(serverFrames, []byte(`{"id": "2", "type": "next", "payload": {"data": {}}}`))
+	wsutil.WriteServerText(serverFrames, []byte(`{"id": "2", "type": "complete"}`))
+
+	for _, c := range serverFrames.Bytes() {
+		n, err := conn.Write([]byte{c})
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	}
+
+	for _, expected := range []string{"connection_ack", "ka", "data", "complete"} {
+		data, err := wsutil.ReadServerText(wsConnBuff)
+		require.NoError(t, err)
+
+		msg := &wsMessage{}
+		json.Unmarshal(data, msg)
+
+		require.Equal(t, expected, msg.Type)
+	}
 
-			data, _ = wsutil.ReadServerText(wsConnBuff)
-			msg = &wsMessage{}
-			json.Unmarshal(data, msg)
+	require.Zero(t, wsConnBuff.Len(), "pong should be dropped")
+}
+
+func TestWsConnTranslateLegacyProtocolServerMessages(t *testing.T) {
+	wsConnBuff := new(bytes.Buffer)
+	s := newTestWsSubscriber(t, errors.New("test"))
+	frames := newTestWsClientFrames(
+		`{"type": "connection_init"}`,
+		`{"id": "1", "type": "start", "payload":{"query": "subscription { users { id } }"}}`,
+	)
+	w := newWebsocketResponseWriter(&testWsResponseWriter{wsConnBuff: wsConnBuff, clientData: bytes.NewReader(frames)}, s, nil, nil, true, false)
+	conn, _, _ := w.Hijack()
+	io.ReadAll(conn)
+
+	for _, expected := range []string{"error", "complete"} {
+		data, err := wsutil.ReadServerText(wsConnBuff)
+		require.NoError(t, err)
 
-			require.Equalf(t, "complete", msg.Type, "case %s: msg type should be complete, but got %s", name, msg.Type)
+		msg := &wsMessage{}
+		json.Unmarshal(data, msg)
+
+		require.Equal(t, expected, msg.Type)
+
+		if expected == "error" {
+			require.JSONEq(t, `{"message": "test", "errors": [{"message": "test"}]}`, string(msg.Payload), "error of rejected subscription should be in legacy shape")
 		}
 	}
+
+	large := `{"id": "2", "type": "next", "payload": {"data": {"name": "` + strings.Repeat("a", wsMaxInspectFrameSize) + `"}}}`
+	fragmented := []byte(`{"id": "2", "type": "next", "payload": {"data": {}}}`)
+	serverFrames := new(bytes.Buffer)
+	ws.WriteFrame(serverFrames, ws.NewFrame(ws.OpText, false, fragmented[:10]))
+	ws.WriteFrame(serverFrames, ws.NewPingFrame(nil))
+	ws.WriteFrame(serverFrames, ws.NewFrame(ws.OpContinuation, true, fragmented[10:]))
+	wsutil.WriteServerText(serverFrames, []byte(large))
+	wsutil.WriteServerText(serverFrames, []byte(`{"id": "2", "type": "error", "payload": [{"message": "a"}, {"message": "b"}]}`))
+
+	_, err := conn.Write(serverFrames.Bytes())
+	require.NoError(t, err)
+
+	frame, err := ws.ReadFrame(wsConnBuff)
+	require.NoError(t, err)
+	require.Equal(t, ws.OpPing, frame.Header.OpCode, "control frames should be passed through")
+
+	for _, expected := range []string{"data", "data", "error"} {
+		data, err := wsutil.ReadServerText(wsConnBuff)
+		require.NoError(t, err)
+
+		msg := &wsMessage{}
+		json.Unmarshal(data, msg)
+
+		require.Equal(t, expected, msg.Type, "fragmented and large messages should be translated")
+
+		if expected == "error" {
+			require.JSONEq(t, `{"message": "a", "errors": [{"message": "a"}, {"message": "b"}]}`, string(msg.Payload))
+		}
+	}
+
+	require.Zero(t, wsConnBuff.Len())
+}
+
+func TestWsHandshakeReadWriter(t *testing.T) {
+	buff := new(bytes.Buffer)
+	rw := newWsHandshakeReadWriter(bufio.NewReadWriter(nil, bufio.NewWriter(buff)), wsTransportProtocol, wsLegacyProtocol)
+	response := "HTTP/1.1 101 Switching Protocols\r\nSec-Websocket-Protocol: graphql-transport-ws\r\nUpgrade: websocket\r\n\r\n"
+
+	rw.WriteString(response[:20])
+	rw.Flush()
+	rw.WriteString(response[20:])
+	rw.Flush()
+
+	require.Equal(t, "HTTP/1.1 101 Switching Protocols\r\nSec-Websocket-Protocol: graphql-ws\r\nUpgrade: websocket\r\n\r\n", buff.String())
+
+	rw.WriteString("data")
+	rw.Flush()
+
+	require.Equal(t, "data", buff.String()[len(response)-10:], "data after handshake response should be passed through")
 }
@@ -0,0 +1,174 @@
+package gbox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+)
+
+// wsLegacyProtocol is sub-protocol of legacy subscriptions-transport-ws protocol.
+const wsLegacyProtocol = "graphql-ws"
+
+var (
+	// wsLegacyClientMessageTypes maps subscriptions-transport-ws client messages to graphql-transport-ws.
+	wsLegacyClientMessageTypes = map[string]string{
+		"start": "subscribe",
+		"stop":  "complete",
+	}
+
+	// wsLegacyServerMessageTypes maps graphql-transport-ws server messages to subscriptions-transport-ws.
+	wsLegacyServerMessageTypes = map[string]string{
+		"next": "data",
+		"ping": "ka",
+	}
+)
+
+// translateWsMessage returns type of message given and message with type translated by types mapping,
+// translated message will be nil if its type is not mapped.
+func translateWsMessage(data []byte, types map[string]string) (msgType string, translated []byte) {
+	msg := make(map[string]json.RawMessage)
+
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return "", nil
+	}
+
+	if err := json.Unmarshal(msg["type"], &msgType); err != nil {
+		return "", nil
+	}
+
+	newType, ok := types[msgType]
+
+	if !ok {
+		return msgType, nil
+	}
+
+	msg["type"], _ = json.Marshal(newType) // nolint:errchkjson
+
+	translated, err := json.Marshal(msg)
+	if err != nil {
+		return msgType, nil
+	}
+
+	return msgType, translated
+}
+
+// translateWsErrorMessage returns graphql-transport-ws error message given with payload in shape of
+// subscriptions-transport-ws, it will be nil if payload is not errors list.
+func translateWsErrorMessage(data []byte) []byte {
+	msg := make(map[string]json.RawMessage)
+
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil
+	}
+
+	payload, ok := wsLegacyErrorPayload(msg["payload"])
+
+	if !ok {
+		return nil
+	}
+
+	msg["payload"] = payload
+
+	translated, err := json.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+
+	return translated
+}
+
+// wsLegacyErrorPayload converts errors list payload to single error object expected by subscriptions-transport-ws clients,
+// message of the first error will be used and all errors are kept in `errors` field.
+func wsLegacyErrorPayload(payload json.RawMessage) (json.RawMessage, bool) {
+	var errs []json.RawMessage
+
+	if err := json.Unmarshal(payload, &errs); err != nil {
+		return nil, false
+	}
+
+	legacy := struct {
+		Message string            `json:"message"`
+		Errors  []json.RawMessage `json:"errors"`
+	}{
+		Errors: errs,
+	}
+
+	if len(errs) > 0 {
+		first := struct {
+			Message string `json:"message"`
+		}{}
+
+		json.Unmarshal(errs[0], &first) // nolint:errcheck
+
+		legacy.Message = first.Message
+	}
+
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// wsHandshakeRewriter rewrites sub-protocol selected by upstream in handshake response written by reverse proxy,
+// data written after handshake response will be passed through.
+type wsHandshakeRewriter struct {
+	w        *bufio.Writer
+	from, to string
+	head     []byte
+	done     bool
+}
+
+func newWsHandshakeReadWriter(rw *bufio.ReadWriter, from, to string) *bufio.ReadWriter {
+	rewriter := &wsHandshakeRewriter{
+		w:    rw.Writer,
+		from: from,
+		to:   to,
+	}
+
+	return bufio.NewReadWriter(rw.Reader, bufio.NewWriter(rewriter))
+}
+
+func (h *wsHandshakeRewriter) Write(b []byte) (n int, err error) {
+	if h.done {
+		if n, err = h.w.Write(b); err != nil {
+			return n, err
+		}
+
+		return n, h.w.Flush()
+	}
+
+	h.head = append(h.head, b...)
+	end := bytes.Index(h.head, []byte("\r\n\r\n"))
+
+	if end < 0 {
+		return len(b), nil
+	}
+
+	lines := bytes.Split(h.head[:end], []byte("\r\n"))
+
+	for i, line := range lines {
+		colon := bytes.IndexByte(line, ':')
+
+		if colon < 0 {
+			continue
+		}
+
+		name, value := line[:colon], bytes.TrimSpace(line[colon+1:])
+
+		if bytes.EqualFold(bytes.TrimSpace(name), []byte("Sec-Websocket-Protocol")) && string(value) == h.from {
+			lines[i] = []byte(string(name) + ": " + h.to)
+		}
+	}
+
+	rewritten := append(bytes.Join(lines, []byte("\r\n")), h.head[end:]...)
+	h.head = nil
+	h.done = true
+
+	if _, err = h.w.Write(rewritten); err != nil {
+		return 0, err
+	}
+
+	return len(b), h.w.Flush()
+}